@@ -0,0 +1,159 @@
+// Command cmdconfig-lint checks cmdconfig files for likely mistakes and
+// style problems, see package lint for the rules.
+//
+// Without an explicit path it checks standard input. Given a file it checks
+// that file, given a directory it checks all .conf files in that
+// directory, recursively. It exits with status 1 if any errors or warnings
+// were found.
+//
+// Rules are configured by a .cmdconfig-lint file in the current directory,
+// if there is one:
+//
+//	rule quote-style off
+//	rule trailing-whitespace error
+//	rule nesting {
+//	    max 3
+//	}
+//
+// Usage:
+//
+//	cmdconfig-lint [flags] [path ...]
+//
+// The flags are:
+//
+//	-config path
+//		Read the rule configuration from path instead of .cmdconfig-lint.
+//	-format format
+//		Output format: text, json or sarif (default text). SARIF output
+//		can be uploaded to code scanning services.
+//	-rules
+//		List the rules and exit.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/client9/cmdconfig/lint"
+)
+
+var (
+	configPath = flag.String("config", "", "rule configuration file (default "+lint.ConfigFile+")")
+	format     = flag.String("format", "text", "output format: text, json or sarif")
+	listRules  = flag.Bool("rules", false, "list the rules and exit")
+)
+
+const stdinName = "<standard input>"
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: cmdconfig-lint [flags] [path ...]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	os.Exit(run(flag.Args(), os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run checks each path, or stdin if there are none, and returns the exit
+// code
+func run(paths []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	write, ok := writers[*format]
+	if !ok {
+		fmt.Fprintf(stderr, "error: unknown format %q\n", *format)
+		return 2
+	}
+	linter, err := newLinter(stderr)
+	if err != nil {
+		return 2
+	}
+	if *listRules {
+		for _, r := range linter.Rules() {
+			fmt.Fprintf(stdout, "%-20s %s\n", r.Name(), r.Description())
+		}
+		return 0
+	}
+
+	code := 0
+	var diags []lint.Diagnostic
+	check := func(name string, in io.Reader) {
+		src, err := readFile(name, in)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", name, err)
+			code = 2
+			return
+		}
+		diags = append(diags, linter.Check(name, src)...)
+	}
+	if len(paths) == 0 {
+		check(stdinName, stdin)
+	}
+	for _, path := range paths {
+		err := filepath.WalkDir(path, func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			base := d.Name()
+			if d.IsDir() || (name != path && (strings.HasPrefix(base, ".") || !strings.HasSuffix(base, ".conf"))) {
+				return nil
+			}
+			check(name, nil)
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			code = 2
+		}
+	}
+
+	if err := write(stdout, linter, diags); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	for _, d := range diags {
+		if code == 0 && d.Severity != lint.Info {
+			code = 1
+		}
+	}
+	return code
+}
+
+// newLinter returns a Linter configured by the config file, reporting
+// errors to stderr
+func newLinter(stderr io.Writer) (*lint.Linter, error) {
+	name := *configPath
+	if name == "" {
+		name = lint.ConfigFile
+		if _, err := os.Stat(name); errors.Is(err, fs.ErrNotExist) {
+			return lint.New(nil)
+		}
+	}
+	data, err := os.ReadFile(name)
+	var cfg *lint.Config
+	if err == nil {
+		cfg, err = lint.ParseConfigFile(name, data)
+	}
+	var linter *lint.Linter
+	if err == nil {
+		linter, err = lint.New(cfg)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+	}
+	return linter, err
+}
+
+// readFile reads in, or the file name if in is nil
+func readFile(name string, in io.Reader) ([]byte, error) {
+	if in == nil {
+		return os.ReadFile(name)
+	}
+	return io.ReadAll(in)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		format string
+		input  string
+		code   int
+		want   string
+	}{
+		{"text", "port 80\n", 0, ""},
+		{"text", "port 80\nport 'x'\n", 1, "<standard input>:2:1: warning: port repeated, first at line 1 (duplicate)\n" +
+			"<standard input>:2:6: warning: unnecessary quotes around x (unnecessary-quotes)\n"},
+		{"json", "a 'b\n", 1, `[
+  {
+    "file": "<standard input>",
+    "line": 1,
+    "column": 3,
+    "endLine": 1,
+    "endColumn": 3,
+    "rule": "syntax",
+    "severity": "error",
+    "message": "got EOF in single quote"
+  }
+]
+`},
+	}
+	for i, tc := range tests {
+		*format = tc.format
+		var stdout, stderr bytes.Buffer
+		if code := run(nil, strings.NewReader(tc.input), &stdout, &stderr); code != tc.code {
+			t.Errorf("case %d: expected exit code %d got %d: %s", i, tc.code, code, stderr.String())
+		}
+		if stdout.String() != tc.want {
+			t.Errorf("case %d: expected %q got %q", i, tc.want, stdout.String())
+		}
+	}
+	*format = "text"
+}
+
+func TestRunSARIF(t *testing.T) {
+	*format = "sarif"
+	defer func() { *format = "text" }()
+	var stdout, stderr bytes.Buffer
+	if code := run(nil, strings.NewReader("a  \n"), &stdout, &stderr); code != 1 {
+		t.Fatalf("expected exit code 1 got %d: %s", code, stderr.String())
+	}
+	var log sarifLog
+	if err := json.Unmarshal(stdout.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 || len(log.Runs[0].Results) != 1 {
+		t.Fatalf("unexpected log %s", stdout.String())
+	}
+	res := log.Runs[0].Results[0]
+	region := res.Locations[0].PhysicalLocation.Region
+	if res.RuleID != "trailing-whitespace" || res.Level != "warning" || region.StartColumn != 2 || region.EndColumn != 4 {
+		t.Errorf("unexpected result %+v", res)
+	}
+}
+
+func TestRunConfig(t *testing.T) {
+	dir := t.TempDir()
+	cfg := filepath.Join(dir, "lint.conf")
+	conf := filepath.Join(dir, "app.conf")
+	os.WriteFile(cfg, []byte("rule duplicate off\nrule unnecessary-quotes info\n"), 0o644)
+	os.WriteFile(conf, []byte("port 80\nport '81'\n"), 0o644)
+
+	*configPath = cfg
+	defer func() { *configPath = "" }()
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{dir}, nil, &stdout, &stderr); code != 0 {
+		t.Errorf("expected exit code 0 got %d: %s", code, stderr.String())
+	}
+	want := conf + ":2:6: info: unnecessary quotes around 81 (unnecessary-quotes)\n"
+	if stdout.String() != want {
+		t.Errorf("expected %q got %q", want, stdout.String())
+	}
+
+	os.WriteFile(cfg, []byte("rule duplicate\nrule duplicate off\n"), 0o644)
+	stdout.Reset()
+	if code := run([]string{dir}, nil, &stdout, &stderr); code != 2 {
+		t.Errorf("expected exit code 2 got %d", code)
+	}
+	if want := cfg + ":2:1: rule duplicate configured twice\n"; stderr.String() != want {
+		t.Errorf("expected %q got %q", want, stderr.String())
+	}
+
+	// errors from the parser and from configuring the rules name the file
+	for _, tc := range []struct{ cfg, want string }{
+		{"rule 'duplicate\n", cfg + ":2:1: got EOF in single quote\n"},
+		{"\nrule spelling\n", cfg + ":2:1: unknown rule \"spelling\"\n"},
+	} {
+		os.WriteFile(cfg, []byte(tc.cfg), 0o644)
+		stderr.Reset()
+		if code := run([]string{dir}, nil, &stdout, &stderr); code != 2 {
+			t.Errorf("expected exit code 2 got %d", code)
+		}
+		if stderr.String() != tc.want {
+			t.Errorf("expected %q got %q", tc.want, stderr.String())
+		}
+	}
+}
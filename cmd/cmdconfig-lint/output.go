@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/client9/cmdconfig/lint"
+)
+
+// writers print diagnostics in each output format
+var writers = map[string]func(w io.Writer, l *lint.Linter, diags []lint.Diagnostic) error{
+	"text":  writeText,
+	"json":  writeJSON,
+	"sarif": writeSARIF,
+}
+
+func writeText(w io.Writer, l *lint.Linter, diags []lint.Diagnostic) error {
+	for _, d := range diags {
+		if _, err := fmt.Fprintln(w, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type jsonDiagnostic struct {
+	File      string `json:"file"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+	EndLine   int    `json:"endLine"`
+	EndColumn int    `json:"endColumn"`
+	Rule      string `json:"rule"`
+	Severity  string `json:"severity"`
+	Message   string `json:"message"`
+}
+
+func writeJSON(w io.Writer, l *lint.Linter, diags []lint.Diagnostic) error {
+	out := []jsonDiagnostic{}
+	for _, d := range diags {
+		out = append(out, jsonDiagnostic{
+			File:      d.Pos.Filename,
+			Line:      d.Pos.Line,
+			Column:    d.Pos.Column,
+			EndLine:   d.End.Line,
+			EndColumn: d.End.Column,
+			Rule:      d.Rule,
+			Severity:  d.Severity.String(),
+			Message:   d.Message,
+		})
+	}
+	return encode(w, out)
+}
+
+// The subset of SARIF 2.1.0 used for results, see
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+		Region struct {
+			StartLine   int `json:"startLine"`
+			StartColumn int `json:"startColumn"`
+			EndLine     int `json:"endLine"`
+			EndColumn   int `json:"endColumn"`
+		} `json:"region"`
+	} `json:"physicalLocation"`
+}
+
+// sarifLevels maps severities to SARIF result levels
+var sarifLevels = map[lint.Severity]string{
+	lint.Error:   "error",
+	lint.Warning: "warning",
+	lint.Info:    "note",
+}
+
+func writeSARIF(w io.Writer, l *lint.Linter, diags []lint.Diagnostic) error {
+	driver := sarifDriver{
+		Name:           "cmdconfig-lint",
+		InformationURI: "https://github.com/client9/cmdconfig",
+		Rules:          []sarifRule{{ID: "syntax", ShortDescription: sarifMessage{"syntax error"}}},
+	}
+	for _, r := range l.Rules() {
+		driver.Rules = append(driver.Rules, sarifRule{ID: r.Name(), ShortDescription: sarifMessage{r.Description()}})
+	}
+
+	results := []sarifResult{}
+	for _, d := range diags {
+		var loc sarifLocation
+		p := &loc.PhysicalLocation
+		p.ArtifactLocation.URI = filepath.ToSlash(d.Pos.Filename)
+		p.Region.StartLine, p.Region.StartColumn = d.Pos.Line, d.Pos.Column
+		p.Region.EndLine, p.Region.EndColumn = d.End.Line, d.End.Column
+		results = append(results, sarifResult{
+			RuleID:    d.Rule,
+			Level:     sarifLevels[d.Severity],
+			Message:   sarifMessage{d.Message},
+			Locations: []sarifLocation{loc},
+		})
+	}
+
+	return encode(w, sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs:    []sarifRun{{Tool: sarifTool{Driver: driver}, Results: results}},
+	})
+}
+
+func encode(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
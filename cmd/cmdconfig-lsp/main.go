@@ -0,0 +1,65 @@
+// Command cmdconfig-lsp is a Language Server Protocol server for cmdconfig
+// files, for use with editors such as VS Code and Neovim.
+//
+// It talks JSON-RPC over standard input and output. It reports syntax
+// errors as diagnostics, formats documents like cmdconfigfmt, lists
+// blocks such as "server web01" as document symbols and folds brace and
+// heredoc bodies. Given a schema, see cmdconfig.ParseSchema, it also
+// reports violations of it and completes directive names.
+//
+// Usage:
+//
+//	cmdconfig-lsp [flags]
+//
+// The flags are:
+//
+//	-schema path
+//		Validate documents against the schema in path and complete the
+//		directives it declares.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/client9/cmdconfig"
+)
+
+var schemaPath = flag.String("schema", "", "schema file for validation and completion")
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: cmdconfig-lsp [flags]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 0 {
+		usage()
+		os.Exit(2)
+	}
+	os.Exit(run(os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run serves a client on stdin and stdout and returns the exit code
+func run(stdin io.Reader, stdout, stderr io.Writer) int {
+	var schema *cmdconfig.Schema
+	if *schemaPath != "" {
+		data, err := os.ReadFile(*schemaPath)
+		if err == nil {
+			schema, err = cmdconfig.ParseSchemaFile(*schemaPath, data)
+		}
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+	}
+	if err := newServer(stdin, stdout, schema).serve(); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/client9/cmdconfig"
+)
+
+// server is a language server talking JSON-RPC over a pair of streams.
+// Documents are synchronized in full on every change.
+type server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	// schema enables completion and validation, if not nil
+	schema *cmdconfig.Schema
+
+	// text of each open document by URI
+	docs map[string]string
+
+	initialized bool
+	shutdown    bool
+}
+
+func newServer(in io.Reader, out io.Writer, schema *cmdconfig.Schema) *server {
+	return &server{
+		in:     bufio.NewReader(in),
+		out:    out,
+		schema: schema,
+		docs:   map[string]string{},
+	}
+}
+
+// serve handles messages until the exit notification or the end of the
+// input. It returns nil if the client asked for a shutdown first.
+func (s *server) serve() error {
+	for {
+		msg, err := s.read()
+		if err == io.EOF {
+			return errors.New("connection closed without shutdown")
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("exit without shutdown")
+			}
+			return nil
+		}
+		if err := s.handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// read reads one message with its Content-Length header
+func (s *server) read() (*message, error) {
+	header, err := textproto.NewReader(s.in).ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid Content-Length %q", header.Get("Content-Length"))
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, err
+	}
+	msg := &message{}
+	if err := json.Unmarshal(body, msg); err != nil {
+		return &message{ID: nullID, Error: &responseError{Code: codeParseError, Message: err.Error()}}, nil
+	}
+	return msg, nil
+}
+
+var nullID = func() *json.RawMessage { id := json.RawMessage("null"); return &id }()
+
+// write sends msg with its Content-Length header
+func (s *server) write(msg *message) error {
+	msg.JSONRPC = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+// reply sends the result of the request id, or an error
+func (s *server) reply(id *json.RawMessage, result any, rpcErr *responseError) error {
+	msg := &message{ID: id, Error: rpcErr}
+	if rpcErr == nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		msg.Result = data
+	}
+	return s.write(msg)
+}
+
+// notify sends a notification to the client
+func (s *server) notify(method string, params any) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return s.write(&message{Method: method, Params: data})
+}
+
+// handle dispatches a request or notification. Errors in a request are
+// sent to the client, only errors writing to it are returned.
+func (s *server) handle(msg *message) error {
+	if msg.Error != nil {
+		return s.reply(msg.ID, nil, msg.Error)
+	}
+	isRequest := msg.ID != nil
+	result, rpcErr := s.dispatch(msg)
+	if !isRequest {
+		return nil
+	}
+	return s.reply(msg.ID, result, rpcErr)
+}
+
+// dispatch runs the handler for msg.Method
+func (s *server) dispatch(msg *message) (any, *responseError) {
+	switch {
+	case msg.Method == "initialize":
+		s.initialized = true
+		return s.capabilities(), nil
+	case !s.initialized:
+		return nil, &responseError{Code: codeServerNotStarted, Message: "server not initialized"}
+	case msg.Method == "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case s.shutdown:
+		return nil, &responseError{Code: codeInvalidRequest, Message: "server is shutting down"}
+	}
+
+	var err error
+	var result any
+	switch msg.Method {
+	case "initialized":
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if err = json.Unmarshal(msg.Params, &p); err == nil {
+			err = s.update(p.TextDocument.URI, p.TextDocument.Text)
+		}
+	case "textDocument/didChange":
+		var p didChangeParams
+		if err = json.Unmarshal(msg.Params, &p); err == nil && len(p.ContentChanges) > 0 {
+			err = s.update(p.TextDocument.URI, p.ContentChanges[len(p.ContentChanges)-1].Text)
+		}
+	case "textDocument/didClose":
+		var p didCloseParams
+		if err = json.Unmarshal(msg.Params, &p); err == nil {
+			delete(s.docs, p.TextDocument.URI)
+			err = s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []diagnostic{}})
+		}
+	case "textDocument/formatting":
+		var p formattingParams
+		if err = json.Unmarshal(msg.Params, &p); err == nil {
+			result = s.formatting(p)
+		}
+	case "textDocument/documentSymbol":
+		var p documentParams
+		if err = json.Unmarshal(msg.Params, &p); err == nil {
+			result = s.symbols(p.TextDocument.URI)
+		}
+	case "textDocument/foldingRange":
+		var p documentParams
+		if err = json.Unmarshal(msg.Params, &p); err == nil {
+			result = s.folding(p.TextDocument.URI)
+		}
+	case "textDocument/completion":
+		var p positionParams
+		if err = json.Unmarshal(msg.Params, &p); err == nil {
+			result = s.completion(p)
+		}
+	default:
+		return nil, &responseError{Code: codeMethodNotFound, Message: "method not found: " + msg.Method}
+	}
+	if err != nil {
+		return nil, &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return result, nil
+}
+
+func (s *server) capabilities() any {
+	caps := map[string]any{
+		"textDocumentSync":           1, // full
+		"documentFormattingProvider": true,
+		"documentSymbolProvider":     true,
+		"foldingRangeProvider":       true,
+	}
+	if s.schema != nil {
+		caps["completionProvider"] = map[string]any{}
+	}
+	return map[string]any{
+		"capabilities": caps,
+		"serverInfo":   map[string]string{"name": "cmdconfig-lsp"},
+	}
+}
+
+// update stores the text of a document and publishes its diagnostics
+func (s *server) update(uri, text string) error {
+	s.docs[uri] = text
+	return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: uri, Diagnostics: s.diagnostics(text)})
+}
+
+// parse parses text with error recovery, returning the commands that did
+// parse along with every syntax error
+func parse(text string) (*cmdconfig.Document, cmdconfig.ErrorList) {
+	p := cmdconfig.Parser{MaxErrors: -1}
+	doc, err := p.Parse([]byte(text))
+	var errs cmdconfig.ErrorList
+	if err != nil && !errors.As(err, &errs) {
+		var scanErr *cmdconfig.ScanError
+		if errors.As(err, &scanErr) {
+			errs = cmdconfig.ErrorList{scanErr}
+		}
+	}
+	if doc == nil {
+		doc = &cmdconfig.Document{}
+	}
+	return doc, errs
+}
+
+// diagnostics returns the syntax errors in text and, with a schema, the
+// violations of it
+func (s *server) diagnostics(text string) []diagnostic {
+	doc, errs := parse(text)
+	if len(errs) == 0 && s.schema != nil {
+		var verrs cmdconfig.ErrorList
+		if errors.As(cmdconfig.Validate(doc, s.schema), &verrs) {
+			errs = verrs
+		}
+	}
+	diags := []diagnostic{}
+	for _, e := range errs {
+		diags = append(diags, diagnostic{
+			Range:    tokenRange(text, e.Pos.Offset),
+			Severity: severityError,
+			Source:   "cmdconfig",
+			Message:  e.Msg,
+		})
+	}
+	return diags
+}
+
+// tokenRange returns the range of the word starting at offset, or an
+// empty range at the end of a line
+func tokenRange(text string, offset int) lspRange {
+	offset = min(max(offset, 0), len(text))
+	end := offset
+	for end < len(text) && !strings.ContainsRune(" \t\r\n", rune(text[end])) {
+		end++
+	}
+	return lspRange{Start: lspPos(text, offset), End: lspPos(text, end)}
+}
+
+func (s *server) formatting(p formattingParams) []textEdit {
+	text, ok := s.docs[p.TextDocument.URI]
+	if !ok {
+		return nil
+	}
+	indent := "\t"
+	if p.Options.InsertSpaces {
+		indent = strings.Repeat(" ", max(p.Options.TabSize, 1))
+	}
+	out, err := cmdconfig.FormatSource([]byte(text), indent)
+	if err != nil || string(out) == text {
+		return []textEdit{}
+	}
+	return []textEdit{{
+		Range:   lspRange{Start: position{}, End: lspPos(text, len(text))},
+		NewText: string(out),
+	}}
+}
+
+// symbols returns a symbol for each block, named by its command line
+func (s *server) symbols(uri string) []documentSymbol {
+	text := s.docs[uri]
+	doc, _ := parse(text)
+	return blockSymbols(text, doc.Children)
+}
+
+func blockSymbols(text string, nodes []*cmdconfig.Node) []documentSymbol {
+	symbols := []documentSymbol{}
+	for _, n := range nodes {
+		if !n.HasBody() || len(n.Args) == 0 {
+			continue
+		}
+		symbols = append(symbols, documentSymbol{
+			Name:  cmdconfig.Format(n.Args, ""),
+			Kind:  symbolKindObject,
+			Range: lspRange{Start: lspPos(text, n.Pos.Offset), End: lspPos(text, n.BodyEnd.Offset)},
+			SelectionRange: lspRange{
+				Start: lspPos(text, n.Pos.Offset),
+				End:   lspPos(text, argEnd(text, n)),
+			},
+			Children: blockSymbols(text, n.Children),
+		})
+	}
+	return symbols
+}
+
+// argEnd returns the offset just past the arguments of a block
+func argEnd(text string, n *cmdconfig.Node) int {
+	end := min(n.BodyStart.Offset, len(text))
+	for end > n.Pos.Offset && (text[end-1] == ' ' || text[end-1] == '\t') {
+		end--
+	}
+	return end
+}
+
+// folding returns a range for each body that spans lines, leaving the
+// closing line visible
+func (s *server) folding(uri string) []foldingRange {
+	text := s.docs[uri]
+	doc, _ := parse(text)
+	ranges := []foldingRange{}
+	doc.Walk(func(n *cmdconfig.Node) bool {
+		if n.HasBody() {
+			start := lspPos(text, n.BodyStart.Offset).Line
+			end := lspPos(text, n.BodyEnd.Offset).Line - 1
+			if end > start {
+				ranges = append(ranges, foldingRange{StartLine: start, EndLine: end})
+			}
+		}
+		return true
+	})
+	return ranges
+}
+
+// completion offers the directives of the schema for the block at the
+// cursor, if the cursor is in the first word of a line
+func (s *server) completion(p positionParams) completionList {
+	list := completionList{Items: []completionItem{}}
+	text, ok := s.docs[p.TextDocument.URI]
+	if !ok || s.schema == nil {
+		return list
+	}
+	offset := p.Position.offset(text)
+	lineStart := strings.LastIndexByte(text[:offset], '\n') + 1
+	word := strings.TrimLeft(text[lineStart:offset], " \t")
+	if strings.ContainsAny(word, " \t\"'{};#") {
+		return list
+	}
+
+	doc, _ := parse(text)
+	schema, nodes := s.schema, doc.Children
+	for {
+		n := enclosing(nodes, offset)
+		if n == nil {
+			break
+		}
+		d := schema.Lookup(n.Name())
+		if d == nil || d.Block == nil {
+			return list
+		}
+		schema, nodes = d.Block, n.Children
+	}
+
+	used := map[string]bool{}
+	for _, n := range nodes {
+		used[n.Name()] = true
+	}
+	for _, d := range schema.Directives {
+		if used[d.Name] && !d.Repeatable {
+			continue
+		}
+		list.Items = append(list.Items, completionItem{Label: d.Name, Kind: completionKindKeyword, Detail: signature(d)})
+	}
+	return list
+}
+
+// enclosing returns the block in nodes whose braces contain offset
+func enclosing(nodes []*cmdconfig.Node, offset int) *cmdconfig.Node {
+	for _, n := range nodes {
+		if n.HasBody() && !n.Raw && n.BodyStart.Offset < offset && offset < n.BodyEnd.Offset {
+			return n
+		}
+	}
+	return nil
+}
+
+// signature returns a summary of the arguments and body of d
+func signature(d *cmdconfig.Directive) string {
+	parts := []string{d.Name}
+	for _, a := range d.Args {
+		t := string(a.Type)
+		if t == "" {
+			t = string(cmdconfig.TypeString)
+		}
+		parts = append(parts, t)
+	}
+	if d.MaxArgs < 0 {
+		parts = append(parts, "...")
+	}
+	if d.Block != nil || d.Body == cmdconfig.BodyRequired {
+		parts = append(parts, "{ }")
+	}
+	return strings.Join(parts, " ")
+}
+
+// lspPos returns the position of a byte offset in text
+func lspPos(text string, offset int) position {
+	offset = min(max(offset, 0), len(text))
+	start := strings.LastIndexByte(text[:offset], '\n') + 1
+	return position{
+		Line:      strings.Count(text[:start], "\n"),
+		Character: utf16Len(text[start:offset]),
+	}
+}
+
+// offset returns the byte offset of p in text
+func (p position) offset(text string) int {
+	start := 0
+	for i := 0; i < p.Line; i++ {
+		j := strings.IndexByte(text[start:], '\n')
+		if j < 0 {
+			return len(text)
+		}
+		start += j + 1
+	}
+	n := 0
+	for i, r := range text[start:] {
+		if r == '\n' || n >= p.Character {
+			return start + i
+		}
+		n += utf16RuneLen(r)
+	}
+	return len(text)
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16RuneLen(r)
+	}
+	return n
+}
+
+func utf16RuneLen(r rune) int {
+	if r >= 0x10000 && r <= utf8.MaxRune {
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/client9/cmdconfig"
+)
+
+// client drives a server over in-memory pipes
+type client struct {
+	t    *testing.T
+	in   io.WriteCloser
+	out  *server // reads the server's messages
+	id   int
+	done chan error
+}
+
+func newClient(t *testing.T, schema *cmdconfig.Schema) *client {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	c := &client{t: t, in: inW, out: newServer(outR, nil, nil), done: make(chan error, 1)}
+	go func() {
+		c.done <- newServer(inR, outW, schema).serve()
+		outW.Close()
+	}()
+	c.call("initialize", map[string]any{}, nil)
+	c.notify("initialized", map[string]any{})
+	return c
+}
+
+func (c *client) send(msg *message) {
+	c.t.Helper()
+	s := &server{out: c.in}
+	if err := s.write(msg); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// recv returns the next message from the server
+func (c *client) recv() *message {
+	c.t.Helper()
+	msg, err := c.out.read()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return msg
+}
+
+func (c *client) notify(method string, params any) {
+	c.t.Helper()
+	data, _ := json.Marshal(params)
+	c.send(&message{Method: method, Params: data})
+}
+
+// call sends a request and decodes its result into result
+func (c *client) call(method string, params any, result any) *responseError {
+	c.t.Helper()
+	c.id++
+	id := json.RawMessage(fmtInt(c.id))
+	data, _ := json.Marshal(params)
+	c.send(&message{ID: &id, Method: method, Params: data})
+	msg := c.recv()
+	if msg.ID == nil || string(*msg.ID) != string(id) {
+		c.t.Fatalf("%s: expected response %s got %+v", method, id, msg)
+	}
+	if msg.Error == nil && result != nil {
+		if err := json.Unmarshal(msg.Result, result); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	return msg.Error
+}
+
+// diagnostics returns the diagnostics published for uri
+func (c *client) diagnostics(uri string) []diagnostic {
+	c.t.Helper()
+	msg := c.recv()
+	var p publishDiagnosticsParams
+	if err := json.Unmarshal(msg.Params, &p); err != nil || msg.Method != "textDocument/publishDiagnostics" || p.URI != uri {
+		c.t.Fatalf("expected diagnostics for %s got %+v", uri, msg)
+	}
+	return p.Diagnostics
+}
+
+func (c *client) open(uri, text string) []diagnostic {
+	c.t.Helper()
+	c.notify("textDocument/didOpen", didOpenParams{TextDocument: textDocumentItem{URI: uri, Text: text}})
+	return c.diagnostics(uri)
+}
+
+func (c *client) close() error {
+	c.t.Helper()
+	if err := c.call("shutdown", nil, nil); err != nil {
+		c.t.Fatal(err.Message)
+	}
+	c.notify("exit", nil)
+	return <-c.done
+}
+
+func fmtInt(i int) string {
+	data, _ := json.Marshal(i)
+	return string(data)
+}
+
+func rng(l1, c1, l2, c2 int) lspRange {
+	return lspRange{Start: position{l1, c1}, End: position{l2, c2}}
+}
+
+const uri = "file:///app.conf"
+
+func TestDiagnostics(t *testing.T) {
+	c := newClient(t, nil)
+	diags := c.open(uri, "ok 1\nname \"é\" bad'quote\n")
+	want := []diagnostic{{Range: rng(1, 12, 1, 18), Severity: severityError, Source: "cmdconfig", Message: "got EOF in single quote"}}
+	if !reflect.DeepEqual(diags, want) {
+		t.Errorf("expected %+v got %+v", want, diags)
+	}
+
+	c.notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": uri, "version": 2},
+		"contentChanges": []map[string]string{{"text": "ok 1\nserver {\n  x 1\n"}},
+	})
+	diags = c.diagnostics(uri)
+	want = []diagnostic{{Range: rng(1, 7, 1, 8), Severity: severityError, Source: "cmdconfig", Message: "got EOF in opening brace"}}
+	if !reflect.DeepEqual(diags, want) {
+		t.Errorf("expected %+v got %+v", want, diags)
+	}
+
+	c.notify("textDocument/didClose", didCloseParams{TextDocument: textDocumentIdentifier{URI: uri}})
+	if diags := c.diagnostics(uri); len(diags) != 0 {
+		t.Errorf("expected no diagnostics after close got %+v", diags)
+	}
+	if err := c.close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFeatures(t *testing.T) {
+	c := newClient(t, nil)
+	text := "server web01 {\n  location /api {\n      proxy x\n  }\n}\nscript <<EOF\necho\nEOF\nport 80\n"
+	c.open(uri, text)
+
+	var edits []textEdit
+	params := map[string]any{"textDocument": map[string]string{"uri": uri}, "options": map[string]any{"tabSize": 4, "insertSpaces": true}}
+	if err := c.call("textDocument/formatting", params, &edits); err != nil {
+		t.Fatal(err.Message)
+	}
+	want := []textEdit{{Range: rng(0, 0, 9, 0), NewText: "server web01 {\n    location /api {\n        proxy x\n    }\n}\nscript <<EOF\necho\nEOF\nport 80\n"}}
+	if !reflect.DeepEqual(edits, want) {
+		t.Errorf("formatting expected %+v got %+v", want, edits)
+	}
+
+	var symbols []documentSymbol
+	if err := c.call("textDocument/documentSymbol", map[string]any{"textDocument": map[string]string{"uri": uri}}, &symbols); err != nil {
+		t.Fatal(err.Message)
+	}
+	wantSymbols := []documentSymbol{
+		{Name: "server web01", Kind: symbolKindObject, Range: rng(0, 0, 4, 1), SelectionRange: rng(0, 0, 0, 12), Children: []documentSymbol{
+			{Name: "location /api", Kind: symbolKindObject, Range: rng(1, 2, 3, 3), SelectionRange: rng(1, 2, 1, 15)},
+		}},
+		{Name: "script", Kind: symbolKindObject, Range: rng(5, 0, 7, 3), SelectionRange: rng(5, 0, 5, 6)},
+	}
+	if !reflect.DeepEqual(symbols, wantSymbols) {
+		t.Errorf("symbols expected %+v got %+v", wantSymbols, symbols)
+	}
+
+	var folds []foldingRange
+	if err := c.call("textDocument/foldingRange", map[string]any{"textDocument": map[string]string{"uri": uri}}, &folds); err != nil {
+		t.Fatal(err.Message)
+	}
+	wantFolds := []foldingRange{{0, 3}, {1, 2}, {5, 6}}
+	if !reflect.DeepEqual(folds, wantFolds) {
+		t.Errorf("folding expected %+v got %+v", wantFolds, folds)
+	}
+
+	if err := c.call("textDocument/hover", map[string]any{}, nil); err == nil || err.Code != codeMethodNotFound {
+		t.Errorf("expected method not found got %+v", err)
+	}
+	if err := c.close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	schema, err := cmdconfig.ParseSchema([]byte(`
+directive port {
+    arg uint16
+}
+directive server {
+    repeatable
+    args 1 *
+    block {
+        directive listen {
+            arg uint16
+        }
+        directive tls
+    }
+}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newClient(t, schema)
+	c.open(uri, "port 80\nserver web {\n  listen 80\n  \n}\nse\n")
+
+	tests := []struct {
+		pos  position
+		want []completionItem
+	}{
+		{position{5, 2}, []completionItem{{Label: "server", Kind: completionKindKeyword, Detail: "server ... { }"}}},
+		{position{3, 2}, []completionItem{{Label: "tls", Kind: completionKindKeyword, Detail: "tls"}}},
+		{position{0, 6}, []completionItem{}},
+	}
+	for i, tc := range tests {
+		var list completionList
+		params := map[string]any{"textDocument": map[string]string{"uri": uri}, "position": tc.pos}
+		if err := c.call("textDocument/completion", params, &list); err != nil {
+			t.Fatal(err.Message)
+		}
+		if !reflect.DeepEqual(list.Items, tc.want) {
+			t.Errorf("case %d: expected %+v got %+v", i, tc.want, list.Items)
+		}
+	}
+
+	c.notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": uri},
+		"contentChanges": []map[string]string{{"text": "server web {\n  listen x\n}\n"}},
+	})
+	diags := c.diagnostics(uri)
+	if len(diags) != 1 || diags[0].Range != rng(1, 9, 1, 10) {
+		t.Errorf("expected a schema diagnostic for x got %+v", diags)
+	}
+	if err := c.close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLifecycle(t *testing.T) {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- newServer(inR, outW, nil).serve()
+		outW.Close()
+	}()
+	c := &client{t: t, in: inW, out: newServer(outR, nil, nil)}
+	if err := c.call("textDocument/documentSymbol", map[string]any{}, nil); err == nil || err.Code != codeServerNotStarted {
+		t.Errorf("expected server not started got %+v", err)
+	}
+	c.notify("exit", nil)
+	if err := <-done; err == nil || err.Error() != "exit without shutdown" {
+		t.Errorf("expected exit without shutdown got %v", err)
+	}
+}
+
+func TestPositions(t *testing.T) {
+	text := "a é\n😀b\n"
+	tests := []struct {
+		offset int
+		pos    position
+	}{
+		{0, position{0, 0}},
+		{2, position{0, 2}},
+		{4, position{0, 3}},
+		{5, position{1, 0}},
+		{9, position{1, 2}},
+		{10, position{1, 3}},
+		{11, position{2, 0}},
+	}
+	for _, tc := range tests {
+		if got := lspPos(text, tc.offset); got != tc.pos {
+			t.Errorf("lspPos(%d): expected %+v got %+v", tc.offset, tc.pos, got)
+		}
+		if got := tc.pos.offset(text); got != tc.offset {
+			t.Errorf("offset(%+v): expected %d got %d", tc.pos, tc.offset, got)
+		}
+	}
+}
+
+func TestRunSchemaError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.schema")
+	os.WriteFile(path, []byte("directive port {\n    bogus\n}\n"), 0o644)
+	*schemaPath = path
+	defer func() { *schemaPath = "" }()
+
+	var stdout, stderr bytes.Buffer
+	if code := run(strings.NewReader(""), &stdout, &stderr); code != 2 {
+		t.Errorf("expected exit code 2 got %d", code)
+	}
+	if want := path + ":2:5: "; !strings.HasPrefix(stderr.String(), want) {
+		t.Errorf("expected %q got %q", want, stderr.String())
+	}
+}
@@ -0,0 +1,123 @@
+// Command cmdconfig2json converts a cmdconfig file to JSON.
+//
+// Without a path it reads standard input. The output is the canonical JSON
+// form, an array of {"args": [...], "children": [...]} objects in order,
+// which json2cmdconfig converts back without loss.
+//
+// Usage:
+//
+//	cmdconfig2json [flags] [path]
+//
+// The flags are:
+//
+//	-map
+//		Print the document keyed by directive name instead, see
+//		Document.Map. It cannot be converted back.
+//	-schema
+//		Read the input as a schema, see ParseSchema, and print the JSON
+//		Schema of the canonical JSON form of documents it allows.
+//	-indent string
+//		Indentation of the JSON output (default two spaces).
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/client9/cmdconfig"
+)
+
+var (
+	mapping = flag.Bool("map", false, "print the document keyed by directive name")
+	schema  = flag.Bool("schema", false, "read a schema and print its JSON Schema")
+	indent  = flag.String("indent", "  ", "indentation of the JSON output")
+)
+
+const stdinName = "<standard input>"
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: cmdconfig2json [flags] [path]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	os.Exit(run(flag.Args(), os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run converts the file named in paths, or stdin if there is none, and
+// returns the exit code
+func run(paths []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if *mapping && *schema {
+		fmt.Fprintln(stderr, "error: cannot use -map with -schema")
+		return 2
+	}
+	filename := stdinName
+	switch len(paths) {
+	case 0:
+	case 1:
+		filename = paths[0]
+		f, err := os.Open(filename)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		defer f.Close()
+		stdin = f
+	default:
+		usage()
+		return 2
+	}
+
+	src, err := io.ReadAll(stdin)
+	if err == nil {
+		src, err = convert(filename, src)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if _, err := stdout.Write(src); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	return 0
+}
+
+// convert returns the JSON for src, read from filename, as selected by
+// the flags
+func convert(filename string, src []byte) ([]byte, error) {
+	var out []byte
+	if *schema {
+		s, err := cmdconfig.ParseSchemaFile(filename, src)
+		if err != nil {
+			return nil, err
+		}
+		if out, err = s.JSONSchema(); err != nil {
+			return nil, err
+		}
+	} else {
+		doc, err := new(cmdconfig.Parser).ParseFile(filename, src)
+		if err != nil {
+			return nil, err
+		}
+		var v any = doc
+		if *mapping {
+			v = doc.Map()
+		}
+		if out, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, out, "", *indent); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		mapping, schema bool
+		input           string
+		want            string
+	}{
+		{false, false, "a b\nc {\n  d 1\n}\n", "[\n  {\n    \"args\": [\n      \"a\",\n      \"b\"\n    ]\n  },\n  {\n    \"args\": [\n      \"c\"\n    ],\n    \"children\": [\n      {\n        \"args\": [\n          \"d\",\n          \"1\"\n        ]\n      }\n    ]\n  }\n]\n"},
+		{true, false, "a b\nc {\n  d 1\n}\n", "{\n  \"a\": \"b\",\n  \"c\": {\n    \"d\": \"1\"\n  }\n}\n"},
+		{false, true, "directive a", "\"$schema\": \"https://json-schema.org/draft/2020-12/schema\""},
+	}
+	for i, tc := range tests {
+		*mapping, *schema = tc.mapping, tc.schema
+		var stdout, stderr bytes.Buffer
+		if code := run(nil, strings.NewReader(tc.input), &stdout, &stderr); code != 0 {
+			t.Fatalf("case %d: exit code %d: %s", i, code, stderr.String())
+		}
+		if !strings.Contains(stdout.String(), tc.want) {
+			t.Errorf("case %d: expected %q got %q", i, tc.want, stdout.String())
+		}
+	}
+	*mapping, *schema = false, false
+}
+
+func TestRunParseError(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run(nil, strings.NewReader("ok\nbad 'quote"), &stdout, &stderr); code != 2 {
+		t.Errorf("expected exit code 2 got %d", code)
+	}
+	if want := "<standard input>:2:11: got EOF in single quote\n"; stderr.String() != want {
+		t.Errorf("expected %q got %q", want, stderr.String())
+	}
+
+	*schema = true
+	defer func() { *schema = false }()
+	stderr.Reset()
+	if code := run(nil, strings.NewReader("directive a\nbogus"), &stdout, &stderr); code != 2 {
+		t.Errorf("expected exit code 2 got %d", code)
+	}
+	if want := "<standard input>:2:1: unknown directive \"bogus\"\n"; stderr.String() != want {
+		t.Errorf("expected %q got %q", want, stderr.String())
+	}
+}
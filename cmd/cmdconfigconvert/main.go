@@ -0,0 +1,143 @@
+// Command cmdconfigconvert converts between cmdconfig, YAML and TOML files.
+//
+// Without a path it reads standard input. The mapping between the formats
+// is described in the documentation of package convert. cmdconfig output
+// is formatted like cmdconfigfmt.
+//
+// Usage:
+//
+//	cmdconfigconvert [flags] [path]
+//
+// The flags are:
+//
+//	-from format
+//		Format of the input: cmdconfig, yaml or toml. By default it is
+//		taken from the file extension, .yaml, .yml or .toml, and is
+//		cmdconfig otherwise.
+//	-to format
+//		Format of the output: cmdconfig, yaml or toml (default cmdconfig).
+//	-indent string
+//		Indentation for nested blocks of cmdconfig output (default four
+//		spaces).
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/client9/cmdconfig"
+	"github.com/client9/cmdconfig/convert"
+)
+
+var (
+	from   = flag.String("from", "", "input format: cmdconfig, yaml or toml")
+	to     = flag.String("to", "cmdconfig", "output format: cmdconfig, yaml or toml")
+	indent = flag.String("indent", "    ", "indentation for nested blocks of cmdconfig output")
+)
+
+const stdinName = "<standard input>"
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: cmdconfigconvert [flags] [path]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	os.Exit(run(flag.Args(), os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run converts the file named in paths, or stdin if there is none, and
+// returns the exit code
+func run(paths []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	filename := stdinName
+	switch len(paths) {
+	case 0:
+	case 1:
+		filename = paths[0]
+		f, err := os.Open(filename)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		defer f.Close()
+		stdin = f
+	default:
+		usage()
+		return 2
+	}
+
+	inFormat := *from
+	if inFormat == "" {
+		inFormat = formatOf(filename)
+	}
+	for _, format := range []string{inFormat, *to} {
+		if format != "cmdconfig" && format != "yaml" && format != "toml" {
+			fmt.Fprintf(stderr, "error: unknown format %q\n", format)
+			return 2
+		}
+	}
+
+	src, err := io.ReadAll(stdin)
+	if err == nil {
+		src, err = convertData(filename, src, inFormat, *to)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if _, err := stdout.Write(src); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	return 0
+}
+
+// formatOf returns the format of a file by its extension
+func formatOf(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	}
+	return "cmdconfig"
+}
+
+// convertData converts src, read from filename, from one format to another
+func convertData(filename string, src []byte, from, to string) ([]byte, error) {
+	var t convert.Table
+	var err error
+	switch from {
+	case "yaml":
+		t, err = convert.ParseYAML(src)
+	case "toml":
+		t, err = convert.ParseTOML(src)
+	default:
+		// errors already carry the file name
+		doc, err := new(cmdconfig.Parser).ParseFile(filename, src)
+		if err != nil {
+			return nil, err
+		}
+		t = convert.FromDocument(doc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	switch to {
+	case "yaml":
+		return convert.FormatYAML(t)
+	case "toml":
+		return convert.FormatTOML(t)
+	}
+	doc, err := convert.ToDocument(t)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(doc.Format(*indent)), nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		from, to string
+		input    string
+		want     string
+	}{
+		{"", "yaml", "a b\nc x {\n  d 1\n}\n", "a: b\nc x:\n  d: 1\n"},
+		{"", "toml", "a b\nc x {\n  d 1\n}\n", "a = \"b\"\n\n[\"c x\"]\nd = 1\n"},
+		{"yaml", "cmdconfig", "a: b\nc x:\n  d: [1, 2]\n", "a b\nc x {\n    d 1 2\n}\n"},
+		{"toml", "yaml", "a = 1\n[b]\nc = 'x y'\n", "a: 1\nb:\n  c: x y\n"},
+	}
+	for i, tc := range tests {
+		*from, *to = tc.from, tc.to
+		var stdout, stderr bytes.Buffer
+		if code := run(nil, strings.NewReader(tc.input), &stdout, &stderr); code != 0 {
+			t.Fatalf("case %d: exit code %d: %s", i, code, stderr.String())
+		}
+		if stdout.String() != tc.want {
+			t.Errorf("case %d: expected %q got %q", i, tc.want, stdout.String())
+		}
+	}
+	*from, *to = "", "cmdconfig"
+}
+
+func TestRunErrors(t *testing.T) {
+	tests := []struct {
+		from, to string
+		input    string
+		want     string
+	}{
+		{"", "cmdconfig", "ok\nbad 'quote", "<standard input>:2:11: got EOF in single quote\n"},
+		{"yaml", "cmdconfig", "a: 1\n b: 2\n", "<standard input>: yaml: line 2: unexpected indentation\n"},
+		{"json", "cmdconfig", "", "error: unknown format \"json\"\n"},
+	}
+	for i, tc := range tests {
+		*from, *to = tc.from, tc.to
+		var stdout, stderr bytes.Buffer
+		if code := run(nil, strings.NewReader(tc.input), &stdout, &stderr); code != 2 {
+			t.Errorf("case %d: expected exit code 2 got %d", i, code)
+		}
+		if stderr.String() != tc.want {
+			t.Errorf("case %d: expected %q got %q", i, tc.want, stderr.String())
+		}
+	}
+	*from, *to = "", "cmdconfig"
+}
+
+func TestFormatOf(t *testing.T) {
+	tests := map[string]string{
+		"app.yaml": "yaml",
+		"app.YML":  "yaml",
+		"app.toml": "toml",
+		"app.conf": "cmdconfig",
+		stdinName:  "cmdconfig",
+	}
+	for name, want := range tests {
+		if got := formatOf(name); got != want {
+			t.Errorf("%s: expected %q got %q", name, want, got)
+		}
+	}
+}
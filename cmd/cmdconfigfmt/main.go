@@ -0,0 +1,197 @@
+// Command cmdconfigfmt formats cmdconfig files.
+//
+// Without an explicit path it processes standard input. Given a file it
+// operates on that file, given a directory it operates on all .conf files
+// in that directory, recursively.
+//
+// Usage:
+//
+//	cmdconfigfmt [flags] [path ...]
+//
+// The flags are:
+//
+//	-d
+//		Do not print reformatted sources to standard output.
+//		If a file's formatting is different than cmdconfigfmt's, print
+//		diffs to standard output.
+//	-l
+//		Do not print reformatted sources to standard output.
+//		If a file's formatting is different from cmdconfigfmt's, print
+//		its name to standard output.
+//	-w
+//		Do not print reformatted sources to standard output.
+//		If a file's formatting is different from cmdconfigfmt's,
+//		overwrite it with cmdconfigfmt's version.
+//	-indent string
+//		Indentation for nested blocks (default four spaces).
+//	-resolve
+//		Print the resolved configuration instead of formatting it:
+//		files named by include commands are read, set variables and
+//		${VAR} references to the environment are expanded, and comments
+//		are dropped. It cannot be used with -w.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/client9/cmdconfig"
+)
+
+var (
+	list    = flag.Bool("l", false, "list files whose formatting differs from cmdconfigfmt's")
+	write   = flag.Bool("w", false, "write result to (source) file instead of stdout")
+	doDiff  = flag.Bool("d", false, "display diffs instead of rewriting files")
+	indent  = flag.String("indent", "    ", "indentation for nested blocks")
+	resolve = flag.Bool("resolve", false, "print the configuration with includes and variables expanded")
+)
+
+const stdinName = "<standard input>"
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: cmdconfigfmt [flags] [path ...]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	os.Exit(run(flag.Args(), os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run processes each path, or stdin if there are none, and returns the
+// exit code
+func run(paths []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if *write && *resolve {
+		fmt.Fprintln(stderr, "error: cannot use -w with -resolve")
+		return 2
+	}
+	if len(paths) == 0 {
+		if *write {
+			fmt.Fprintln(stderr, "error: cannot use -w with standard input")
+			return 2
+		}
+		if err := processFile(stdinName, stdin, stdout); err != nil {
+			report(stderr, stdinName, err)
+			return 2
+		}
+		return 0
+	}
+
+	code := 0
+	for _, path := range paths {
+		err := filepath.WalkDir(path, func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || (name != path && !isConfigFile(d)) {
+				return nil
+			}
+			if err := processFile(name, nil, stdout); err != nil {
+				report(stderr, name, err)
+				code = 2
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			code = 2
+		}
+	}
+	return code
+}
+
+func isConfigFile(d fs.DirEntry) bool {
+	return !strings.HasPrefix(d.Name(), ".") && strings.HasSuffix(d.Name(), ".conf")
+}
+
+// report prints err, with positions of scan errors in file:line:column form
+func report(w io.Writer, filename string, err error) {
+	var scanErr *cmdconfig.ScanError
+	if errors.As(err, &scanErr) {
+		if name := scanErr.Pos.Filename; name != "" {
+			// loaded with -resolve, relative to the directory of filename
+			filename = filepath.Join(filepath.Dir(filename), filepath.FromSlash(name))
+		}
+		fmt.Fprintf(w, "%s:%d:%d: %s\n", filename, scanErr.Pos.Line, scanErr.Pos.Column, scanErr.Msg)
+		return
+	}
+	fmt.Fprintf(w, "%s: %v\n", filename, err)
+}
+
+// processFile formats a single file. If in is nil the file is opened.
+func processFile(filename string, in io.Reader, out io.Writer) error {
+	if in == nil {
+		f, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	src, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	var res []byte
+	if *resolve {
+		res, err = resolveFile(filename, src)
+	} else {
+		res, err = cmdconfig.FormatSource(src, *indent)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !*list && !*write && !*doDiff {
+		_, err = out.Write(res)
+		return err
+	}
+	if bytes.Equal(src, res) {
+		return nil
+	}
+	if *list {
+		fmt.Fprintln(out, filename)
+	}
+	if *write {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filename, res, info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	if *doDiff {
+		fmt.Fprintf(out, "diff -u %s.orig %s\n", filename, filename)
+		out.Write(diff(filename+".orig", filename, src, res))
+	}
+	return nil
+}
+
+// resolveFile returns the configuration in src with includes and variables
+// expanded. Includes are read relative to the directory of filename, and
+// left as they are for standard input.
+func resolveFile(filename string, src []byte) ([]byte, error) {
+	p := cmdconfig.Parser{Variables: true, Lookup: os.LookupEnv}
+	var doc *cmdconfig.Document
+	var err error
+	if filename == stdinName {
+		doc, err = p.Parse(src)
+	} else {
+		fsys := os.DirFS(filepath.Dir(filename))
+		doc, err = p.Load(fsys, filepath.Base(filename))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte(doc.Format(*indent)), nil
+}
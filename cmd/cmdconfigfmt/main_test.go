@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func setFlags(t *testing.T, l, w, d bool) {
+	t.Helper()
+	oldL, oldW, oldD := *list, *write, *doDiff
+	*list, *write, *doDiff = l, w, d
+	t.Cleanup(func() { *list, *write, *doDiff = oldL, oldW, oldD })
+}
+
+func TestRunStdin(t *testing.T) {
+	setFlags(t, false, false, false)
+	var stdout, stderr bytes.Buffer
+	code := run(nil, strings.NewReader("a  'b'\nc {\nd 1\n}"), &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr.String())
+	}
+	if want := "a b\nc {\n    d 1\n}\n"; stdout.String() != want {
+		t.Errorf("expected %q got %q", want, stdout.String())
+	}
+}
+
+func TestRunParseError(t *testing.T) {
+	setFlags(t, false, false, false)
+	var stdout, stderr bytes.Buffer
+	code := run(nil, strings.NewReader("ok\nbad 'quote"), &stdout, &stderr)
+	if code != 2 {
+		t.Errorf("expected exit code 2 got %d", code)
+	}
+	if want := "<standard input>:2:11: got EOF in single quote\n"; stderr.String() != want {
+		t.Errorf("expected %q got %q", want, stderr.String())
+	}
+}
+
+func TestRunFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"good.conf":       "a b\n",
+		"bad.conf":        "a   b\n",
+		"sub/nested.conf": "x {\ny 1\n}\n",
+		"skip.txt":        "not   formatted\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// -l lists only files needing changes
+	setFlags(t, true, false, false)
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{dir}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr.String())
+	}
+	want := filepath.Join(dir, "bad.conf") + "\n" + filepath.Join(dir, "sub/nested.conf") + "\n"
+	if stdout.String() != want {
+		t.Errorf("expected %q got %q", want, stdout.String())
+	}
+
+	// -d prints a diff
+	setFlags(t, false, false, true)
+	stdout.Reset()
+	run([]string{filepath.Join(dir, "bad.conf")}, nil, &stdout, &stderr)
+	if !strings.Contains(stdout.String(), "@@ -1,1 +1,1 @@\n-a   b\n+a b\n") {
+		t.Errorf("unexpected diff %q", stdout.String())
+	}
+
+	// -w rewrites in place
+	setFlags(t, false, true, false)
+	stdout.Reset()
+	if code := run([]string{dir}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr.String())
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("expected no output got %q", stdout.String())
+	}
+	got, _ := os.ReadFile(filepath.Join(dir, "sub/nested.conf"))
+	if string(got) != "x {\n    y 1\n}\n" {
+		t.Errorf("file not rewritten, got %q", got)
+	}
+	got, _ = os.ReadFile(filepath.Join(dir, "skip.txt"))
+	if string(got) != files["skip.txt"] {
+		t.Errorf("non .conf file was changed")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\n"
+	new := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nL\nm\nn"
+	want := `--- old
++++ new
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -9,5 +9,6 @@
+ i
+ j
+ k
+-l
++L
+ m
++n
+\ No newline at end of file
+`
+	if got := string(diff("old", "new", []byte(old), []byte(new))); got != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+	if diff("old", "new", []byte(old), []byte(old)) != nil {
+		t.Errorf("expected no diff for equal input")
+	}
+}
+
+func TestRunResolve(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.conf":     "# comment\nset port 80\ninclude conf.d/*.conf\nlisten ${port}\n",
+		"conf.d/a.conf": "home ${CMDCONFIGFMT_TEST}\n",
+		"bad.conf":      "include conf.d/b.inc\n",
+		"conf.d/b.inc":  "x ${undefined}\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("CMDCONFIGFMT_TEST", "/home/me")
+	setFlags(t, false, false, false)
+	*resolve = true
+	t.Cleanup(func() { *resolve = false })
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{filepath.Join(dir, "main.conf")}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr.String())
+	}
+	if want := "home /home/me\nlisten 80\n"; stdout.String() != want {
+		t.Errorf("expected %q got %q", want, stdout.String())
+	}
+
+	// errors in included files are reported with their own name
+	stderr.Reset()
+	if code := run([]string{filepath.Join(dir, "bad.conf")}, nil, &stdout, &stderr); code != 2 {
+		t.Errorf("expected exit code 2 got %d", code)
+	}
+	want := filepath.Join(dir, "conf.d", "b.inc") + ":1:3: undefined variable \"undefined\"\n"
+	if stderr.String() != want {
+		t.Errorf("expected %q got %q", want, stderr.String())
+	}
+}
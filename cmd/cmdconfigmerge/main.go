@@ -0,0 +1,145 @@
+// Command cmdconfigmerge merges layered cmdconfig files, such as a base
+// config with production and local overrides, and prints the result.
+//
+// Each file is applied over those before it, see cmdconfig.Merge. Blocks
+// are merged by their labels, e.g. "server web01", other directives are
+// replaced, and "unset name" deletes inherited entries. Include commands
+// are expanded. The output is formatted like cmdconfigfmt.
+//
+// Usage:
+//
+//	cmdconfigmerge [flags] base.conf [overlay.conf ...]
+//
+// The flags are:
+//
+//	-policy list
+//		How directives merge, as a comma separated list of name=mode,
+//		where mode is replace, append or label. For example
+//		"listen=append,upstream=label".
+//	-explain name
+//		Instead of the merged config, print where each effective command
+//		named name was set, along with the blocks enclosing it.
+//	-indent string
+//		Indentation for nested blocks (default four spaces).
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/client9/cmdconfig"
+)
+
+var (
+	policy  = flag.String("policy", "", "merge modes as name=replace|append|label,...")
+	explain = flag.String("explain", "", "print where each command named `name` was set")
+	indent  = flag.String("indent", "    ", "indentation for nested blocks")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: cmdconfigmerge [flags] base.conf [overlay.conf ...]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	os.Exit(run(flag.Args(), os.Stdout, os.Stderr))
+}
+
+var modes = map[string]cmdconfig.MergeMode{
+	"replace": cmdconfig.MergeReplace,
+	"append":  cmdconfig.MergeAppend,
+	"label":   cmdconfig.MergeByLabel,
+}
+
+// run merges the files in paths and returns the exit code
+func run(paths []string, stdout, stderr io.Writer) int {
+	pol, err := parsePolicy(*policy)
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return 2
+	}
+
+	var docs []*cmdconfig.Document
+	for _, path := range paths {
+		dir := filepath.Dir(path)
+		doc, err := cmdconfig.Load(os.DirFS(dir), filepath.Base(path))
+		if err != nil {
+			report(stderr, dir, err)
+			return 2
+		}
+		relocate(doc.Children, dir)
+		docs = append(docs, doc)
+	}
+	doc, err := cmdconfig.Merge(pol, docs[0], docs[1:]...)
+	if err != nil {
+		report(stderr, ".", err)
+		return 2
+	}
+
+	if *explain == "" {
+		io.WriteString(stdout, doc.Format(*indent))
+		return 0
+	}
+	var blocks []string
+	var visit func(nodes []*cmdconfig.Node)
+	visit = func(nodes []*cmdconfig.Node) {
+		for _, n := range nodes {
+			if n.Name() == *explain {
+				line := strings.Join(append(blocks, cmdconfig.Format(n.Args, "")), " > ")
+				fmt.Fprintf(stdout, "%s: %s\n", n.Pos, line)
+			}
+			blocks = append(blocks, cmdconfig.Format(n.Args, ""))
+			visit(n.Children)
+			blocks = blocks[:len(blocks)-1]
+		}
+	}
+	visit(doc.Children)
+	return 0
+}
+
+// parsePolicy parses the -policy flag
+func parsePolicy(list string) (cmdconfig.MergePolicy, error) {
+	pol := cmdconfig.MergePolicy{}
+	for _, item := range strings.Split(list, ",") {
+		if item == "" {
+			continue
+		}
+		name, mode, _ := strings.Cut(item, "=")
+		m, ok := modes[mode]
+		if !ok {
+			return nil, fmt.Errorf("bad policy %q, want name=replace|append|label", item)
+		}
+		pol[name] = m
+	}
+	return pol, nil
+}
+
+// relocate makes the file names of nodes, which are relative to dir,
+// relative to the current directory
+func relocate(nodes []*cmdconfig.Node, dir string) {
+	for _, n := range nodes {
+		n.Pos.Filename = filepath.Join(dir, filepath.FromSlash(n.Pos.Filename))
+		relocate(n.Children, dir)
+	}
+}
+
+// report prints err, with the file names of scan errors made relative to
+// the current directory as with relocate
+func report(w io.Writer, dir string, err error) {
+	var scanErr *cmdconfig.ScanError
+	if errors.As(err, &scanErr) && scanErr.Pos.Filename != "" {
+		scanErr.Pos.Filename = filepath.Join(dir, filepath.FromSlash(scanErr.Pos.Filename))
+	}
+	fmt.Fprintf(w, "%v\n", err)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.conf")
+	prod := filepath.Join(dir, "prod.conf")
+	os.WriteFile(base, []byte("listen a\nserver web01 {\n  port 80\n  tls off\n}\ndebug on\n"), 0o644)
+	os.WriteFile(prod, []byte("listen b\nserver web01 {\n  port 8080\n}\nunset debug\n"), 0o644)
+
+	tests := []struct {
+		policy  string
+		explain string
+		want    string
+	}{
+		{"", "", "listen b\nserver web01 {\n    port 8080\n    tls off\n}\n"},
+		{"listen=append", "", "listen a\nlisten b\nserver web01 {\n    port 8080\n    tls off\n}\n"},
+		{"", "port", prod + ":3:3: server web01 > port 8080\n"},
+		{"", "tls", base + ":4:3: server web01 > tls off\n"},
+	}
+	for i, tc := range tests {
+		*policy, *explain = tc.policy, tc.explain
+		var stdout, stderr bytes.Buffer
+		if code := run([]string{base, prod}, &stdout, &stderr); code != 0 {
+			t.Errorf("case %d: expected exit code 0 got %d: %s", i, code, stderr.String())
+		}
+		if stdout.String() != tc.want {
+			t.Errorf("case %d: expected %q got %q", i, tc.want, stdout.String())
+		}
+	}
+	*policy, *explain = "", ""
+
+	*policy = "listen=merge"
+	defer func() { *policy = "" }()
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{base}, &stdout, &stderr); code != 2 {
+		t.Errorf("expected exit code 2 got %d", code)
+	}
+}
@@ -0,0 +1,73 @@
+// Command json2cmdconfig converts JSON written by cmdconfig2json back to a
+// cmdconfig file.
+//
+// Without a path it reads standard input. The input must be the canonical
+// JSON form, an array of {"args": [...], "children": [...]} objects, not
+// the keyed form printed by cmdconfig2json -map.
+//
+// Usage:
+//
+//	json2cmdconfig [flags] [path]
+//
+// The flags are:
+//
+//	-indent string
+//		Indentation for nested blocks (default four spaces).
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/client9/cmdconfig"
+)
+
+var indent = flag.String("indent", "    ", "indentation for nested blocks")
+
+const stdinName = "<standard input>"
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: json2cmdconfig [flags] [path]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	os.Exit(run(flag.Args(), os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run converts the file named in paths, or stdin if there is none, and
+// returns the exit code
+func run(paths []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	filename := stdinName
+	switch len(paths) {
+	case 0:
+	case 1:
+		filename = paths[0]
+		f, err := os.Open(filename)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		defer f.Close()
+		stdin = f
+	default:
+		usage()
+		return 2
+	}
+
+	var doc cmdconfig.Document
+	if err := json.NewDecoder(stdin).Decode(&doc); err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", filename, err)
+		return 2
+	}
+	if _, err := io.WriteString(stdout, doc.Format(*indent)); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	return 0
+}
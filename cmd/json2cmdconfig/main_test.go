@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	input := `[{"args":["a","b c"]},{"args":["c"],"children":[{"args":["d","1"]}]},{"args":["q"],"body":"x }","heredoc":"EOF"}]`
+	var stdout, stderr bytes.Buffer
+	if code := run(nil, strings.NewReader(input), &stdout, &stderr); code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr.String())
+	}
+	if want := "a \"b c\"\nc {\n    d 1\n}\nq <<EOF\nx }\nEOF\n"; stdout.String() != want {
+		t.Errorf("expected %q got %q", want, stdout.String())
+	}
+}
+
+func TestRunError(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run(nil, strings.NewReader(`[{"args":["a"],"heredoc":"EOF"}]`), &stdout, &stderr); code != 2 {
+		t.Errorf("expected exit code 2 got %d", code)
+	}
+	if want := "<standard input>: cmdconfig: heredoc node a without a body\n"; stderr.String() != want {
+		t.Errorf("expected %q got %q", want, stderr.String())
+	}
+}
@@ -0,0 +1,277 @@
+package cmdconfig
+
+import (
+	"errors"
+	"math"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Command is a single command returned by Scanner.NextCommand, along with
+// where each part of it was found in the input.
+type Command struct {
+	Args []string
+	Body string
+
+	Pos       Position   // start of the command
+	End       Position   // just past the last argument or the closing '}'
+	ArgPos    []Position // start of each argument, parallel to Args
+	BodyStart Position   // position of the opening '{', zero if there is no body
+	BodyEnd   Position   // position just past the closing '}'
+
+	// Heredoc is the delimiter if the body was a heredoc, e.g. "EOF"
+	Heredoc string
+
+	// position in the input of each byte of Body, see parseBrace
+	bodyMap []Position
+}
+
+// HasBody reports if the command had a brace body, even an empty one
+func (c *Command) HasBody() bool {
+	return c.BodyStart.Line != 0
+}
+
+// Name returns the first argument, or "" if there are none
+func (c *Command) Name() string {
+	if len(c.Args) == 0 {
+		return ""
+	}
+	return c.Args[0]
+}
+
+func (c *Command) addArg(arg string, pos Position) {
+	if len(c.Args) == 0 {
+		c.Pos = pos
+	}
+	c.Args = append(c.Args, arg)
+	c.ArgPos = append(c.ArgPos, pos)
+}
+
+// bodyScanner returns a Scanner over the body of cmd. If cmd came from s,
+// positions map back to the original input, otherwise, as for commands
+// built in code, they are relative to the start of the body.
+func (s *Scanner) bodyScanner(cmd *Command) *Scanner {
+	var body *Scanner
+	if cmd.bodyMap == nil {
+		start := cmd.BodyStart
+		if start.Line == 0 {
+			start = cmd.Pos
+		}
+		body = NewScanner([]byte(cmd.Body))
+		body.filename = start.Filename
+		if start.Line > 0 {
+			body.line, body.column, body.baseOffset = start.Line, start.Column, start.Offset
+		}
+	} else {
+		body = newBodyScanner([]byte(cmd.Body), cmd.bodyMap)
+	}
+	body.errs, body.maxErrors = s.errs, s.maxErrors
+	body.lookup, body.semicolons = s.lookup, s.semicolons
+	return body
+}
+
+// The typed accessors below convert Args[i], so the first argument after
+// the directive name is 1. Errors name the directive and are at the
+// position of the argument, or the end of the command if it is missing.
+
+// argPos returns the position of argument i, or of the command if it is
+// not known, as for commands built in code or read from JSON
+func (c *Command) argPos(i int) Position {
+	if i < len(c.ArgPos) {
+		return c.ArgPos[i]
+	}
+	return c.Pos
+}
+
+// arg returns argument i, or an error if there is none
+func (c *Command) arg(i int) (string, error) {
+	if i < 0 || i >= len(c.Args) {
+		return "", errorf(c.End, "missing argument %d for %s", i, c.Name())
+	}
+	return c.Args[i], nil
+}
+
+// argError returns an error for argument i that is not a valid kind
+func (c *Command) argError(i int, kind string, err error) error {
+	pos := c.argPos(i)
+	var numErr *strconv.NumError
+	if errors.As(err, &numErr) {
+		err = numErr.Err
+	}
+	if err == nil {
+		return errorf(pos, "invalid %s %q for %s", kind, c.Args[i], c.Name())
+	}
+	return errorf(pos, "invalid %s %q for %s: %v", kind, c.Args[i], c.Name(), err)
+}
+
+// Int returns argument i as an int. Like Go literals it may have a 0x,
+// 0o or 0b prefix.
+func (c *Command) Int(i int) (int, error) {
+	arg, err := c.arg(i)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(arg, 0, 0)
+	if err != nil {
+		return 0, c.argError(i, "int", err)
+	}
+	return int(n), nil
+}
+
+// Uint16 returns argument i as a uint16, e.g. a port number
+func (c *Command) Uint16(i int) (uint16, error) {
+	arg, err := c.arg(i)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseUint(arg, 0, 16)
+	if err != nil {
+		return 0, c.argError(i, "uint16", err)
+	}
+	return uint16(n), nil
+}
+
+// Bool returns argument i as a bool. It accepts on, yes and true, or
+// off, no and false, in any case.
+func (c *Command) Bool(i int) (bool, error) {
+	arg, err := c.arg(i)
+	if err != nil {
+		return false, err
+	}
+	b, ok := parseBool(arg)
+	if !ok {
+		return false, c.argError(i, "bool", nil)
+	}
+	return b, nil
+}
+
+// parseBool parses the bools accepted by Command.Bool, which Unmarshal and
+// schema validation accept as well
+func parseBool(s string) (value bool, ok bool) {
+	switch strings.ToLower(s) {
+	case "on", "yes", "true":
+		return true, true
+	case "off", "no", "false":
+		return false, true
+	}
+	return false, false
+}
+
+// Duration returns argument i as a time.Duration, e.g. 1m30s
+func (c *Command) Duration(i int) (time.Duration, error) {
+	arg, err := c.arg(i)
+	if err != nil {
+		return 0, err
+	}
+	d, err := time.ParseDuration(arg)
+	if err != nil {
+		return 0, c.argError(i, "duration", nil)
+	}
+	return d, nil
+}
+
+// Float returns argument i as a float64
+func (c *Command) Float(i int) (float64, error) {
+	arg, err := c.arg(i)
+	if err != nil {
+		return 0, err
+	}
+	f, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return 0, c.argError(i, "float", err)
+	}
+	return f, nil
+}
+
+// byteUnits are the size suffixes accepted by Bytes, in lower case
+var byteUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1e3,
+	"kb":  1e3,
+	"m":   1e6,
+	"mb":  1e6,
+	"g":   1e9,
+	"gb":  1e9,
+	"t":   1e12,
+	"tb":  1e12,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+}
+
+// Bytes returns argument i as a number of bytes. It is a number with an
+// optional unit, either decimal (KB, MB, GB, TB) or binary (KiB, MiB, GiB,
+// TiB), in any case, e.g. 512, 10MB or 1.5GiB.
+func (c *Command) Bytes(i int) (int64, error) {
+	arg, err := c.arg(i)
+	if err != nil {
+		return 0, err
+	}
+	num := strings.TrimRightFunc(arg, func(r rune) bool {
+		return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+	})
+	unit, ok := byteUnits[strings.ToLower(arg[len(num):])]
+	if !ok {
+		return 0, c.argError(i, "size", errors.New("unknown unit"))
+	}
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil || f < 0 {
+		return 0, c.argError(i, "size", nil)
+	}
+	f *= unit
+	if f >= math.MaxInt64 {
+		return 0, c.argError(i, "size", strconv.ErrRange)
+	}
+	return int64(f), nil
+}
+
+// URL returns argument i as an absolute URL
+func (c *Command) URL(i int) (*url.URL, error) {
+	arg, err := c.arg(i)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(arg)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, c.argError(i, "URL", err)
+	}
+	if !u.IsAbs() {
+		return nil, c.argError(i, "URL", errors.New("missing scheme"))
+	}
+	return u, nil
+}
+
+// IP returns argument i as an IPv4 or IPv6 address
+func (c *Command) IP(i int) (netip.Addr, error) {
+	arg, err := c.arg(i)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	ip, err := netip.ParseAddr(arg)
+	if err != nil {
+		return netip.Addr{}, c.argError(i, "IP address", nil)
+	}
+	return ip, nil
+}
+
+// CIDR returns argument i as an address prefix such as 10.0.0.0/8
+func (c *Command) CIDR(i int) (netip.Prefix, error) {
+	arg, err := c.arg(i)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	p, err := netip.ParsePrefix(arg)
+	if err != nil {
+		return netip.Prefix{}, c.argError(i, "CIDR", nil)
+	}
+	return p, nil
+}
@@ -0,0 +1,164 @@
+package cmdconfig
+
+import (
+	"io"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNextCommand(t *testing.T) {
+	input := "name John\n  port  8080 # http\nserver 'web 01' {\n  host a\n}\n{ bare }"
+	s := NewScanner([]byte(input))
+
+	type want struct {
+		args      []string
+		pos       Position
+		argPos    []Position
+		bodyStart Position
+		bodyEnd   Position
+	}
+	tests := []want{
+		{
+			args:   []string{"name", "John"},
+			pos:    Position{Line: 1, Column: 1, Offset: 0},
+			argPos: []Position{{Line: 1, Column: 1, Offset: 0}, {Line: 1, Column: 6, Offset: 5}},
+		},
+		{
+			args:   []string{"port", "8080"},
+			pos:    Position{Line: 2, Column: 3, Offset: 12},
+			argPos: []Position{{Line: 2, Column: 3, Offset: 12}, {Line: 2, Column: 9, Offset: 18}},
+		},
+		{
+			args:      []string{"server", "web 01"},
+			pos:       Position{Line: 3, Column: 1, Offset: 30},
+			argPos:    []Position{{Line: 3, Column: 1, Offset: 30}, {Line: 3, Column: 8, Offset: 37}},
+			bodyStart: Position{Line: 3, Column: 17, Offset: 46},
+			bodyEnd:   Position{Line: 5, Column: 2, Offset: 58},
+		},
+		{
+			args:      []string{},
+			pos:       Position{Line: 6, Column: 1, Offset: 59},
+			bodyStart: Position{Line: 6, Column: 1, Offset: 59},
+			bodyEnd:   Position{Line: 6, Column: 9, Offset: 67},
+		},
+	}
+
+	for i, tc := range tests {
+		cmd, err := s.NextCommand()
+		if err != nil {
+			t.Fatalf("case %d, got error %v", i, err)
+		}
+		if !reflect.DeepEqual(cmd.Args, tc.args) {
+			t.Errorf("case %d, expected args %v got %v", i, tc.args, cmd.Args)
+		}
+		if cmd.Pos != tc.pos {
+			t.Errorf("case %d, expected pos %v got %v", i, tc.pos, cmd.Pos)
+		}
+		if len(tc.argPos) > 0 && !reflect.DeepEqual(cmd.ArgPos, tc.argPos) {
+			t.Errorf("case %d, expected arg positions %v got %v", i, tc.argPos, cmd.ArgPos)
+		}
+		if cmd.BodyStart != tc.bodyStart || cmd.BodyEnd != tc.bodyEnd {
+			t.Errorf("case %d, expected body span %v-%v got %v-%v", i,
+				tc.bodyStart, tc.bodyEnd, cmd.BodyStart, cmd.BodyEnd)
+		}
+		if cmd.HasBody() != (tc.bodyStart.Line != 0) {
+			t.Errorf("case %d, HasBody() = %v", i, cmd.HasBody())
+		}
+	}
+
+	if cmd, err := s.NextCommand(); cmd != nil || err != io.EOF {
+		t.Errorf("expected nil, io.EOF got %v, %v", cmd, err)
+	}
+}
+
+func TestCurrentPos(t *testing.T) {
+	s := NewScanner([]byte("one\ntwo three\n"))
+	if pos := s.CurrentPos(); pos != (Position{Line: 1, Column: 1, Offset: 0}) {
+		t.Errorf("unexpected start position %v", pos)
+	}
+	s.Next()
+	s.Next()
+	if pos := s.CurrentPos(); pos != (Position{Line: 3, Column: 1, Offset: 14}) {
+		t.Errorf("unexpected position %v", pos)
+	}
+}
+
+func TestCommandAccessors(t *testing.T) {
+	input := "opts 42 0x1F 8080 ON no 1m30s 2.5 10MB 1GiB 512 https://example.com/a 10.0.0.1 ::1 10.0.0.0/8"
+	cmd, err := NewScanner([]byte(input)).NextCommand()
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(name string, got, want any, err error) {
+		t.Helper()
+		if err != nil {
+			t.Errorf("%s: got error %v", name, err)
+		} else if got != want {
+			t.Errorf("%s: expected %v got %v", name, want, got)
+		}
+	}
+	n, err := cmd.Int(1)
+	check("Int", n, 42, err)
+	n, err = cmd.Int(2)
+	check("Int hex", n, 31, err)
+	port, err := cmd.Uint16(3)
+	check("Uint16", port, uint16(8080), err)
+	b, err := cmd.Bool(4)
+	check("Bool", b, true, err)
+	b, err = cmd.Bool(5)
+	check("Bool", b, false, err)
+	d, err := cmd.Duration(6)
+	check("Duration", d, 90*time.Second, err)
+	f, err := cmd.Float(7)
+	check("Float", f, 2.5, err)
+	size, err := cmd.Bytes(8)
+	check("Bytes", size, int64(10_000_000), err)
+	size, err = cmd.Bytes(9)
+	check("Bytes", size, int64(1<<30), err)
+	size, err = cmd.Bytes(10)
+	check("Bytes", size, int64(512), err)
+	u, err := cmd.URL(11)
+	if err == nil {
+		check("URL", u.Host, "example.com", err)
+	} else {
+		t.Errorf("URL: got error %v", err)
+	}
+	ip, err := cmd.IP(12)
+	check("IP", ip, netip.MustParseAddr("10.0.0.1"), err)
+	ip, err = cmd.IP(13)
+	check("IP6", ip, netip.IPv6Loopback(), err)
+	prefix, err := cmd.CIDR(14)
+	check("CIDR", prefix, netip.MustParsePrefix("10.0.0.0/8"), err)
+}
+
+func TestCommandAccessorErrors(t *testing.T) {
+	input := "port http 70000 maybe 5 1.x 10XB -1KB /rel 300.1.1.1 10.0.0.1"
+	cmd, err := NewScanner([]byte(input)).NextCommand()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		fn   func() error
+		want string
+	}{
+		{func() error { _, err := cmd.Int(1); return err }, `invalid int "http" for port: invalid syntax at line 1, column 6`},
+		{func() error { _, err := cmd.Uint16(2); return err }, `invalid uint16 "70000" for port: value out of range at line 1, column 11`},
+		{func() error { _, err := cmd.Bool(3); return err }, `invalid bool "maybe" for port at line 1, column 17`},
+		{func() error { _, err := cmd.Duration(4); return err }, `invalid duration "5" for port at line 1, column 23`},
+		{func() error { _, err := cmd.Float(5); return err }, `invalid float "1.x" for port: invalid syntax at line 1, column 25`},
+		{func() error { _, err := cmd.Bytes(6); return err }, `invalid size "10XB" for port: unknown unit at line 1, column 29`},
+		{func() error { _, err := cmd.Bytes(7); return err }, `invalid size "-1KB" for port at line 1, column 34`},
+		{func() error { _, err := cmd.URL(8); return err }, `invalid URL "/rel" for port: missing scheme at line 1, column 39`},
+		{func() error { _, err := cmd.IP(9); return err }, `invalid IP address "300.1.1.1" for port at line 1, column 44`},
+		{func() error { _, err := cmd.CIDR(10); return err }, `invalid CIDR "10.0.0.1" for port at line 1, column 54`},
+		{func() error { _, err := cmd.Int(11); return err }, `missing argument 11 for port at line 1, column 62`},
+	}
+	for i, tc := range tests {
+		err := tc.fn()
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("case %d: expected %q got %v", i, tc.want, err)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+// Package convert converts cmdconfig documents to and from the data model
+// of YAML and TOML: tables of keys in order, lists and string scalars.
+//
+// It has its own minimal YAML and TOML readers and writers, so neither the
+// core package nor this one has dependencies. They cover the common subset
+// of each format used by configuration files: YAML block and flow
+// collections, quoted and block scalars and comments, but not anchors,
+// tags or multiple documents, and all of TOML except that dates and
+// numbers are kept as text.
+//
+// A document maps to a Table as follows:
+//
+//	port 8080                 port: 8080
+//	allow a b                 allow: [a, b]
+//	flag                      flag: []
+//	server web01 {            server web01:
+//	    tls on                    tls: on
+//	}
+//	host a                    host:
+//	host b                        - [a]
+//	                              - [b]
+//	script <<EOF              script: |
+//	echo hi                       echo hi
+//	EOF
+//
+// A command with one argument maps to that argument, and with none or
+// several to a list of them. A block maps to a table, keyed by the whole
+// command line so labels like web01 are kept. Raw bodies and heredocs map
+// to a string ending in a newline. A directive used more than once in a
+// block maps to a list with the value of each, where single arguments are
+// written as a list of one so they are not read back as several
+// arguments.
+//
+// Reading back, each key is split into arguments like a cmdconfig line and
+// its value supplies the rest: a scalar is one more argument, a list of
+// scalars is several, a table is a block, a string with a newline is a
+// heredoc, and null is no more arguments. Any other list holds repeated
+// directives, with each item read the same way. Keys used more than once
+// are grouped at their first position.
+package convert
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/client9/cmdconfig"
+)
+
+// Table is a mapping with its keys in order
+type Table []Field
+
+// Field is one entry of a Table. Value is a string, a []any of values, a
+// Table, or nil for an empty YAML value.
+type Field struct {
+	Key   string
+	Value any
+}
+
+// Get returns the value of key, or nil
+func (t Table) Get(key string) any {
+	for _, f := range t {
+		if f.Key == key {
+			return f.Value
+		}
+	}
+	return nil
+}
+
+// FromDocument returns the Table for doc, see the package documentation
+// for the mapping
+func FromDocument(doc *cmdconfig.Document) Table {
+	return fromNodes(doc.Children)
+}
+
+func fromNodes(nodes []*cmdconfig.Node) Table {
+	t := Table{}
+	index := map[string]int{}
+	repeated := map[string]bool{}
+	for _, n := range nodes {
+		key, v := fromNode(n)
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(t)
+			t = append(t, Field{Key: key, Value: v})
+			continue
+		}
+		if !repeated[key] {
+			repeated[key] = true
+			t[i].Value = []any{repeatedItem(t[i].Value)}
+		}
+		t[i].Value = append(t[i].Value.([]any), repeatedItem(v))
+	}
+	return t
+}
+
+// fromNode returns the key and value of a single command
+func fromNode(n *cmdconfig.Node) (string, any) {
+	switch {
+	case len(n.Args) == 0:
+		return "", fromNodes(n.Children)
+	case n.Raw:
+		return cmdconfig.Format(n.Args, ""), rawString(n.Body)
+	case n.HasBody():
+		return cmdconfig.Format(n.Args, ""), fromNodes(n.Children)
+	}
+	key := cmdconfig.Format(n.Args[:1], "")
+	if len(n.Args) == 2 {
+		return key, n.Args[1]
+	}
+	args := make([]any, len(n.Args)-1)
+	for i, arg := range n.Args[1:] {
+		args[i] = arg
+	}
+	return key, args
+}
+
+// rawString returns a raw body as a string ending in a newline, without
+// the blank lines left over from braces
+func rawString(body string) string {
+	body = strings.TrimLeft(body, "\n")
+	body = strings.TrimRight(body, " \t\n")
+	return body + "\n"
+}
+
+// repeatedItem returns v as an item of the list of a repeated directive.
+// A single argument is wrapped in a list, anything else is unambiguous.
+func repeatedItem(v any) any {
+	if s, ok := v.(string); ok && !strings.Contains(s, "\n") {
+		return []any{s}
+	}
+	return v
+}
+
+// ToDocument returns the document for t, see the package documentation for
+// the mapping
+func ToDocument(t Table) (*cmdconfig.Document, error) {
+	children, err := toNodes(t)
+	if err != nil {
+		return nil, err
+	}
+	return &cmdconfig.Document{Children: children}, nil
+}
+
+func toNodes(t Table) ([]*cmdconfig.Node, error) {
+	var groups [][]*cmdconfig.Node
+	index := map[string]int{}
+	for _, f := range t {
+		args, err := splitKey(f.Key)
+		if err != nil {
+			return nil, err
+		}
+		values := []any{f.Value}
+		if list, ok := f.Value.([]any); ok && !scalars(list) {
+			values = list
+		}
+		i, ok := index[f.Key]
+		if !ok {
+			i = len(groups)
+			index[f.Key] = i
+			groups = append(groups, nil)
+		}
+		for _, v := range values {
+			n, err := toNode(args, v)
+			if err != nil {
+				return nil, err
+			}
+			groups[i] = append(groups[i], n)
+		}
+	}
+	nodes := []*cmdconfig.Node{}
+	for _, g := range groups {
+		nodes = append(nodes, g...)
+	}
+	return nodes, nil
+}
+
+// toNode returns the command for args followed by the value v
+func toNode(args []string, v any) (*cmdconfig.Node, error) {
+	n := &cmdconfig.Node{}
+	n.Args = append([]string{}, args...)
+	switch v := v.(type) {
+	case nil:
+	case string:
+		if strings.Contains(v, "\n") {
+			n.Body, n.Raw, n.Heredoc = strings.TrimSuffix(v, "\n"), true, "EOF"
+		} else {
+			n.Args = append(n.Args, v)
+		}
+	case []any:
+		if !scalars(v) {
+			return nil, fmt.Errorf("convert: %s: lists of repeated directives can not be nested", strings.Join(args, " "))
+		}
+		for _, arg := range v {
+			n.Args = append(n.Args, arg.(string))
+		}
+	case Table:
+		children, err := toNodes(v)
+		if err != nil {
+			return nil, err
+		}
+		n.Children = children
+	default:
+		return nil, fmt.Errorf("convert: %s: unsupported value of type %T", strings.Join(args, " "), v)
+	}
+	if len(n.Args) == 0 && !n.HasBody() {
+		return nil, errors.New("convert: empty key without a table")
+	}
+	return n, nil
+}
+
+// scalars reports if list holds only single-line strings
+func scalars(list []any) bool {
+	for _, v := range list {
+		if s, ok := v.(string); !ok || strings.Contains(s, "\n") {
+			return false
+		}
+	}
+	return true
+}
+
+// splitKey returns the arguments of a key written as a cmdconfig line
+func splitKey(key string) ([]string, error) {
+	if key == "" {
+		return nil, nil
+	}
+	if !strings.ContainsAny(key, " \t\n\"'\\{};#") {
+		return []string{key}, nil
+	}
+	s := cmdconfig.NewScanner([]byte(key))
+	args, body, err := s.Next()
+	if err == nil && body == "" {
+		if _, _, err = s.Next(); err == io.EOF {
+			return args, nil
+		}
+	}
+	return nil, fmt.Errorf("convert: invalid key %q", key)
+}
@@ -0,0 +1,78 @@
+package convert
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/client9/cmdconfig"
+)
+
+const input = "port 8080\nallow a b\nflag\nserver web01 {\n    tls on\n    listen 80 443\n}\nhost a\nhost b\nscript <<EOF\necho \"hi\" {\nEOF\n\"a b\" c\n"
+
+func TestFromDocument(t *testing.T) {
+	doc, err := cmdconfig.Parse([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Table{
+		{"port", "8080"},
+		{"allow", []any{"a", "b"}},
+		{"flag", []any{}},
+		{"server web01", Table{{"tls", "on"}, {"listen", []any{"80", "443"}}}},
+		{"host", []any{[]any{"a"}, []any{"b"}}},
+		{"script", "echo \"hi\" {\n"},
+		{`"a b"`, "c"},
+	}
+	got := FromDocument(doc)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected\n%#v\ngot\n%#v", want, got)
+	}
+
+	back, err := ToDocument(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := back.Format("    "), doc.Format("    "); got != want {
+		t.Errorf("round trip expected\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestToDocument(t *testing.T) {
+	tests := []struct {
+		table Table
+		want  string
+	}{
+		{Table{{"a", nil}, {"b", []any{}}}, "a\nb\n"},
+		{Table{{"a", "1"}, {"b", "2"}, {"a", "3"}}, "a 1\na 3\nb 2\n"},
+		{Table{{"", Table{{"a", "1"}}}}, " {\n    a 1\n}\n"},
+		{Table{{"x", []any{Table{}, []any{"1", "2"}, "3"}}}, "x {}\nx 1 2\nx 3\n"},
+	}
+	for i, tc := range tests {
+		doc, err := ToDocument(tc.table)
+		if err != nil {
+			t.Errorf("case %d: %v", i, err)
+			continue
+		}
+		if got := doc.Format("    "); got != tc.want {
+			t.Errorf("case %d: expected %q got %q", i, tc.want, got)
+		}
+	}
+}
+
+func TestToDocumentErrors(t *testing.T) {
+	tests := []struct {
+		table Table
+		want  string
+	}{
+		{Table{{"a {", "1"}}, `convert: invalid key "a {"`},
+		{Table{{"a", []any{[]any{[]any{"1"}}}}}, "convert: a: lists of repeated directives can not be nested"},
+		{Table{{"a", 1}}, "convert: a: unsupported value of type int"},
+		{Table{{"", nil}}, "convert: empty key without a table"},
+	}
+	for i, tc := range tests {
+		_, err := ToDocument(tc.table)
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("case %d: expected %q got %v", i, tc.want, err)
+		}
+	}
+}
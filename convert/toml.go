@@ -0,0 +1,715 @@
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ParseTOML reads a TOML document. Integers, floats, booleans and dates
+// are kept as the text of their value.
+func ParseTOML(data []byte) (Table, error) {
+	p := &tomlParser{s: string(data), line: 1, root: &tomlTable{}}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	return p.root.table(), nil
+}
+
+// tomlTable is a table while it is being read, so later headers can add
+// to it
+type tomlTable struct {
+	keys   []string
+	values map[string]any // string, []any, *tomlTable or *tomlArray
+
+	// defined is set once the table has had a [header]
+	defined bool
+
+	// inline tables can not be extended
+	inline bool
+}
+
+// tomlArray is an array of tables, each started by a [[header]]
+type tomlArray struct {
+	tables []*tomlTable
+}
+
+func (t *tomlTable) set(key string, v any) {
+	if t.values == nil {
+		t.values = map[string]any{}
+	}
+	t.keys = append(t.keys, key)
+	t.values[key] = v
+}
+
+// walk returns the table named by the dotted keys below t, creating any
+// that do not exist
+func (t *tomlTable) walk(keys []string) (*tomlTable, error) {
+	for _, key := range keys {
+		switch v := t.values[key].(type) {
+		case nil:
+			next := &tomlTable{}
+			t.set(key, next)
+			t = next
+		case *tomlTable:
+			if v.inline {
+				return nil, fmt.Errorf("inline table %s can not be extended", tomlKey(key))
+			}
+			t = v
+		case *tomlArray:
+			t = v.tables[len(v.tables)-1]
+		default:
+			return nil, fmt.Errorf("key %s is not a table", tomlKey(key))
+		}
+	}
+	return t, nil
+}
+
+// table returns t with its values converted
+func (t *tomlTable) table() Table {
+	out := Table{}
+	for _, key := range t.keys {
+		out = append(out, Field{Key: key, Value: tomlValue(t.values[key])})
+	}
+	return out
+}
+
+func tomlValue(v any) any {
+	switch v := v.(type) {
+	case *tomlTable:
+		return v.table()
+	case *tomlArray:
+		list := make([]any, len(v.tables))
+		for i, t := range v.tables {
+			list[i] = t.table()
+		}
+		return list
+	case []any:
+		list := make([]any, len(v))
+		for i, item := range v {
+			list[i] = tomlValue(item)
+		}
+		return list
+	}
+	return v
+}
+
+type tomlParser struct {
+	s    string
+	pos  int
+	line int
+
+	root *tomlTable
+
+	// the table of the last header
+	cur *tomlTable
+}
+
+func (p *tomlParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("toml: line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *tomlParser) peek() byte {
+	if p.pos < len(p.s) {
+		return p.s[p.pos]
+	}
+	return 0
+}
+
+func (p *tomlParser) skipSpace() {
+	for p.peek() == ' ' || p.peek() == '\t' {
+		p.pos++
+	}
+}
+
+// skipBlank skips spaces, comments and line breaks
+func (p *tomlParser) skipBlank() {
+	for {
+		p.skipSpace()
+		switch {
+		case p.peek() == '#':
+			for p.pos < len(p.s) && p.s[p.pos] != '\n' {
+				p.pos++
+			}
+		case p.peek() == '\n':
+			p.pos++
+			p.line++
+		case strings.HasPrefix(p.s[p.pos:], "\r\n"):
+			p.pos += 2
+			p.line++
+		default:
+			return
+		}
+	}
+}
+
+// endLine reads the rest of a line, which may only hold a comment
+func (p *tomlParser) endLine() error {
+	p.skipSpace()
+	if p.peek() == '#' {
+		for p.pos < len(p.s) && p.s[p.pos] != '\n' {
+			p.pos++
+		}
+	}
+	switch {
+	case p.pos == len(p.s):
+	case p.peek() == '\n':
+		p.pos++
+		p.line++
+	case strings.HasPrefix(p.s[p.pos:], "\r\n"):
+		p.pos += 2
+		p.line++
+	default:
+		return p.errorf("expected the end of the line, found %q", p.peek())
+	}
+	return nil
+}
+
+func (p *tomlParser) parse() error {
+	p.cur = p.root
+	for {
+		if p.skipBlank(); p.pos == len(p.s) {
+			return nil
+		}
+		var err error
+		if p.peek() == '[' {
+			err = p.header()
+		} else {
+			err = p.keyValue(p.cur)
+		}
+		if err == nil {
+			err = p.endLine()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// header reads a [table] or [[array of tables]] header
+func (p *tomlParser) header() error {
+	array := strings.HasPrefix(p.s[p.pos:], "[[")
+	p.pos++
+	if array {
+		p.pos++
+	}
+	keys, err := p.key()
+	if err != nil {
+		return err
+	}
+	end := "]"
+	if array {
+		end = "]]"
+	}
+	if p.skipSpace(); !strings.HasPrefix(p.s[p.pos:], end) {
+		return p.errorf("expected %s", end)
+	}
+	p.pos += len(end)
+
+	parent, err := p.root.walk(keys[:len(keys)-1])
+	if err != nil {
+		return p.errorf("%v", err)
+	}
+	last := keys[len(keys)-1]
+	name := tomlPath(keys)
+	switch v := parent.values[last].(type) {
+	case nil:
+		t := &tomlTable{defined: true}
+		if array {
+			parent.set(last, &tomlArray{tables: []*tomlTable{t}})
+		} else {
+			parent.set(last, t)
+		}
+		p.cur = t
+	case *tomlTable:
+		if array || v.defined || v.inline {
+			return p.errorf("table %s is already defined", name)
+		}
+		v.defined = true
+		p.cur = v
+	case *tomlArray:
+		if !array {
+			return p.errorf("table %s is already defined as an array of tables", name)
+		}
+		t := &tomlTable{defined: true}
+		v.tables = append(v.tables, t)
+		p.cur = t
+	default:
+		return p.errorf("key %s is already defined", name)
+	}
+	return nil
+}
+
+// keyValue reads key = value into t
+func (p *tomlParser) keyValue(t *tomlTable) error {
+	keys, err := p.key()
+	if err != nil {
+		return err
+	}
+	if p.skipSpace(); p.peek() != '=' {
+		return p.errorf("expected = after %s", tomlPath(keys))
+	}
+	p.pos++
+	p.skipSpace()
+	v, err := p.value()
+	if err != nil {
+		return err
+	}
+	parent, err := t.walk(keys[:len(keys)-1])
+	if err != nil {
+		return p.errorf("%v", err)
+	}
+	last := keys[len(keys)-1]
+	if _, ok := parent.values[last]; ok {
+		return p.errorf("key %s is already defined", tomlPath(keys))
+	}
+	parent.set(last, v)
+	return nil
+}
+
+// key reads a dotted key
+func (p *tomlParser) key() ([]string, error) {
+	var keys []string
+	for {
+		p.skipSpace()
+		var key string
+		var err error
+		switch p.peek() {
+		case '"':
+			key, err = p.basicString()
+		case '\'':
+			key, err = p.literalString()
+		default:
+			start := p.pos
+			for p.pos < len(p.s) && isBareKey(p.s[p.pos]) {
+				p.pos++
+			}
+			if key = p.s[start:p.pos]; key == "" {
+				err = p.errorf("expected a key")
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+		if p.skipSpace(); p.peek() != '.' {
+			return keys, nil
+		}
+		p.pos++
+	}
+}
+
+func (p *tomlParser) value() (any, error) {
+	switch c := p.peek(); {
+	case strings.HasPrefix(p.s[p.pos:], `"""`):
+		return p.multilineString(`"""`)
+	case strings.HasPrefix(p.s[p.pos:], "'''"):
+		return p.multilineString("'''")
+	case c == '"':
+		return p.basicString()
+	case c == '\'':
+		return p.literalString()
+	case c == '[':
+		return p.array()
+	case c == '{':
+		return p.inlineTable()
+	}
+	start := p.pos
+	for p.pos < len(p.s) && isTOMLToken(p.s[p.pos]) {
+		p.pos++
+		// a date and time may be separated by a space
+		if p.pos-start == 10 && p.s[start+4] == '-' && p.pos+1 < len(p.s) && p.s[p.pos] == ' ' && isDigit(p.s[p.pos+1]) {
+			p.pos++
+		}
+	}
+	tok := p.s[start:p.pos]
+	switch {
+	case tok == "":
+		return nil, p.errorf("expected a value")
+	case tok == "true" || tok == "false" || isDigit(tok[0]) || strings.IndexByte("+-", tok[0]) >= 0 || tok == "inf" || tok == "nan":
+		return tok, nil
+	}
+	return nil, p.errorf("invalid value %q", tok)
+}
+
+func (p *tomlParser) array() ([]any, error) {
+	p.pos++
+	list := []any{}
+	for {
+		if p.skipBlank(); p.peek() == ']' {
+			p.pos++
+			return list, nil
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+		switch p.skipBlank(); p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+		default:
+			return nil, p.errorf("expected , or ] in array")
+		}
+	}
+}
+
+func (p *tomlParser) inlineTable() (*tomlTable, error) {
+	p.pos++
+	t := &tomlTable{}
+	if p.skipSpace(); p.peek() == '}' {
+		p.pos++
+		t.inline = true
+		return t, nil
+	}
+	for {
+		if err := p.keyValue(t); err != nil {
+			return nil, err
+		}
+		switch p.skipSpace(); p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			t.inline = true
+			return t, nil
+		default:
+			return nil, p.errorf("expected , or } in inline table")
+		}
+	}
+}
+
+func (p *tomlParser) basicString() (string, error) {
+	var b strings.Builder
+	for p.pos++; p.pos < len(p.s); p.pos++ {
+		switch c := p.s[p.pos]; c {
+		case '"':
+			p.pos++
+			return b.String(), nil
+		case '\\':
+			if err := p.escape(&b); err != nil {
+				return "", err
+			}
+		case '\n':
+			return "", p.errorf("unterminated string")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func (p *tomlParser) literalString() (string, error) {
+	start := p.pos + 1
+	end := strings.IndexAny(p.s[start:], "'\n")
+	if end < 0 || p.s[start+end] != '\'' {
+		return "", p.errorf("unterminated string")
+	}
+	p.pos = start + end + 1
+	return p.s[start : start+end], nil
+}
+
+// multilineString reads a """ or ”' string. A line break right after the
+// opening quotes is dropped.
+func (p *tomlParser) multilineString(quotes string) (string, error) {
+	p.pos += 3
+	if p.peek() == '\n' {
+		p.pos++
+		p.line++
+	} else if strings.HasPrefix(p.s[p.pos:], "\r\n") {
+		p.pos += 2
+		p.line++
+	}
+	var b strings.Builder
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		switch {
+		case strings.HasPrefix(p.s[p.pos:], quotes):
+			// up to two quotes may end the string
+			n := 3
+			for n < 5 && p.pos+n < len(p.s) && p.s[p.pos+n] == quotes[0] {
+				n++
+			}
+			b.WriteString(p.s[p.pos+3 : p.pos+n])
+			p.pos += n
+			return b.String(), nil
+		case c == '\\' && quotes[0] == '"':
+			rest := strings.TrimLeft(p.s[p.pos+1:], " \t\r")
+			if strings.HasPrefix(rest, "\n") {
+				// a backslash at the end of a line trims the line break
+				// and the whitespace that follows
+				p.pos = len(p.s) - len(rest)
+				for p.pos < len(p.s) && strings.IndexByte(" \t\r\n", p.s[p.pos]) >= 0 {
+					if p.s[p.pos] == '\n' {
+						p.line++
+					}
+					p.pos++
+				}
+				continue
+			}
+			if err := p.escape(&b); err != nil {
+				return "", err
+			}
+			p.pos++
+		default:
+			if c == '\n' {
+				p.line++
+			}
+			if c != '\r' || !strings.HasPrefix(p.s[p.pos:], "\r\n") {
+				b.WriteByte(c)
+			}
+			p.pos++
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// escape reads the escape sequence at p.pos into b, leaving p.pos at its
+// last byte
+func (p *tomlParser) escape(b *strings.Builder) error {
+	if p.pos+1 >= len(p.s) {
+		return p.errorf("unterminated string")
+	}
+	p.pos++
+	simple := map[byte]byte{'b': '\b', 't': '\t', 'n': '\n', 'f': '\f', 'r': '\r', 'e': 0x1b, '"': '"', '\\': '\\'}
+	if c, ok := simple[p.s[p.pos]]; ok {
+		b.WriteByte(c)
+		return nil
+	}
+	size := map[byte]int{'u': 4, 'U': 8}[p.s[p.pos]]
+	if size == 0 || p.pos+size >= len(p.s) {
+		return p.errorf("invalid escape \\%c", p.s[p.pos])
+	}
+	n, err := strconv.ParseUint(p.s[p.pos+1:p.pos+1+size], 16, 32)
+	if err != nil || !utf8.ValidRune(rune(n)) {
+		return p.errorf("invalid escape \\%s", p.s[p.pos:p.pos+1+size])
+	}
+	b.WriteRune(rune(n))
+	p.pos += size
+	return nil
+}
+
+func isBareKey(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || isDigit(b) || b == '_' || b == '-'
+}
+
+func isTOMLToken(b byte) bool {
+	return isBareKey(b) || b == '+' || b == '.' || b == ':'
+}
+
+func isDigit(b byte) bool { return b >= '0' && b <= '9' }
+
+// FormatTOML returns t as a TOML document. The plain values of each table
+// are written before its sub-tables, as TOML requires. A list of tables
+// becomes an array of tables, nil an empty array, and text that reads as
+// a decimal number or boolean is written bare.
+func FormatTOML(t Table) ([]byte, error) {
+	w := &tomlWriter{}
+	if err := w.table(t, nil); err != nil {
+		return nil, err
+	}
+	return w.buf.Bytes(), nil
+}
+
+type tomlWriter struct {
+	buf bytes.Buffer
+}
+
+// table writes the contents of the table at path
+func (w *tomlWriter) table(t Table, path []string) error {
+	for _, f := range t {
+		if isSection(f.Value) {
+			continue
+		}
+		w.buf.WriteString(tomlKey(f.Key) + " = ")
+		if err := w.inline(f.Value); err != nil {
+			return err
+		}
+		w.buf.WriteByte('\n')
+	}
+	for _, f := range t {
+		if !isSection(f.Value) {
+			continue
+		}
+		sub := append(path[:len(path):len(path)], f.Key)
+		if v, ok := f.Value.(Table); ok {
+			w.header("[" + tomlPath(sub) + "]")
+			if err := w.table(v, sub); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, item := range f.Value.([]any) {
+			w.header("[[" + tomlPath(sub) + "]]")
+			if err := w.table(item.(Table), sub); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (w *tomlWriter) header(h string) {
+	if w.buf.Len() > 0 {
+		w.buf.WriteByte('\n')
+	}
+	w.buf.WriteString(h + "\n")
+}
+
+// inline writes v as a value on the current line
+func (w *tomlWriter) inline(v any) error {
+	switch v := v.(type) {
+	case nil:
+		w.buf.WriteString("[]")
+	case string:
+		w.buf.WriteString(tomlString(v))
+	case []any:
+		w.buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				w.buf.WriteString(", ")
+			}
+			if err := w.inline(item); err != nil {
+				return err
+			}
+		}
+		w.buf.WriteByte(']')
+	case Table:
+		w.buf.WriteByte('{')
+		for i, f := range v {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+			w.buf.WriteString(" " + tomlKey(f.Key) + " = ")
+			if err := w.inline(f.Value); err != nil {
+				return err
+			}
+		}
+		if len(v) > 0 {
+			w.buf.WriteByte(' ')
+		}
+		w.buf.WriteByte('}')
+	default:
+		return fmt.Errorf("convert: unsupported value of type %T", v)
+	}
+	return nil
+}
+
+// isSection reports if v is written as a [table] or [[array of tables]]
+func isSection(v any) bool {
+	switch v := v.(type) {
+	case Table:
+		return true
+	case []any:
+		for _, item := range v {
+			if _, ok := item.(Table); !ok {
+				return false
+			}
+		}
+		return len(v) > 0
+	}
+	return false
+}
+
+// tomlPath returns dotted keys as written in a header
+func tomlPath(keys []string) string {
+	quoted := make([]string, len(keys))
+	for i, key := range keys {
+		quoted[i] = tomlKey(key)
+	}
+	return strings.Join(quoted, ".")
+}
+
+// tomlKey returns key bare if it can be, and quoted otherwise
+func tomlKey(key string) string {
+	for i := 0; i < len(key); i++ {
+		if !isBareKey(key[i]) {
+			return quoteTOML(key, false)
+		}
+	}
+	if key == "" {
+		return `""`
+	}
+	return key
+}
+
+// tomlString returns s as a TOML value: bare if it reads as a decimal
+// number or a boolean, a multi-line string if it has line breaks, and a
+// basic string otherwise
+func tomlString(s string) string {
+	switch {
+	case s == "true" || s == "false" || isTOMLNumber(s):
+		return s
+	case strings.Contains(s, "\n"):
+		return quoteTOML(s, true)
+	}
+	return quoteTOML(s, false)
+}
+
+// isTOMLNumber reports if s is a decimal integer or float without
+// underscores, which reads back as the same text
+func isTOMLNumber(s string) bool {
+	if s != "" && (s[0] == '+' || s[0] == '-') {
+		s = s[1:]
+	}
+	mant, exp, hasExp := strings.Cut(strings.ToLower(s), "e")
+	whole, frac, hasFrac := strings.Cut(mant, ".")
+	if !digits(whole) || (len(whole) > 1 && whole[0] == '0') {
+		return false
+	}
+	if hasFrac && !digits(frac) {
+		return false
+	}
+	if hasExp && !digits(strings.TrimLeft(exp, "+-")) {
+		return false
+	}
+	return true
+}
+
+func digits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// quoteTOML returns s as a basic string, or a multi-line basic string
+// with its line breaks kept
+func quoteTOML(s string, multiline bool) string {
+	var b strings.Builder
+	if multiline {
+		b.WriteString(`"""` + "\n")
+	} else {
+		b.WriteByte('"')
+	}
+	for i, r := range s {
+		switch {
+		case r == '"' && multiline && i+1 < len(s) && s[i+1] != '"':
+			// a lone quote can not end the string
+			b.WriteRune(r)
+		case r == '"' || r == '\\':
+			b.WriteString(`\` + string(r))
+		case r == '\n' && multiline, r == '\t':
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04X`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	if multiline {
+		b.WriteString(`"""`)
+	} else {
+		b.WriteByte('"')
+	}
+	return b.String()
+}
@@ -0,0 +1,166 @@
+package convert
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/client9/cmdconfig"
+)
+
+func TestFormatTOML(t *testing.T) {
+	doc, err := cmdconfig.Parse([]byte(input + "version 1.5 007\nuser a {\n    role admin\n}\nuser b {\n    role dev\n}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := FormatTOML(FromDocument(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `port = 8080
+allow = ["a", "b"]
+flag = []
+host = [["a"], ["b"]]
+script = """
+echo "hi" {
+"""
+"\"a b\"" = "c"
+version = [1.5, "007"]
+
+["server web01"]
+tls = "on"
+listen = [80, 443]
+
+["user a"]
+role = "admin"
+
+["user b"]
+role = "dev"
+`
+	if string(out) != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, out)
+	}
+
+	table, err := ParseTOML(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := ToDocument(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// plain values move before the tables
+	if got, want := back.Format("    "), "port 8080\nallow a b\nflag\nhost a\nhost b\nscript <<EOF\necho \"hi\" {\nEOF\n\"a b\" c\nversion 1.5 007\nserver web01 {\n    tls on\n    listen 80 443\n}\nuser a {\n    role admin\n}\nuser b {\n    role dev\n}\n"; got != want {
+		t.Errorf("round trip expected\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestFormatTOMLArrays(t *testing.T) {
+	table := Table{
+		{"server", []any{Table{{"name", "a"}, {"tls", Table{{"on", "true"}}}}, Table{{"name", "b\tc"}}}},
+		{"mixed", []any{Table{{"k", "v"}}, []any{"x"}, nil}},
+	}
+	out, err := FormatTOML(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `mixed = [{ k = "v" }, ["x"], []]
+
+[[server]]
+name = "a"
+
+[server.tls]
+on = true
+
+[[server]]
+name = "b	c"
+`
+	if string(out) != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, out)
+	}
+	back, err := ParseTOML(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table[1].Value.([]any)[2] = []any{}
+	if want := (Table{table[1], table[0]}); !reflect.DeepEqual(back, want) {
+		t.Errorf("expected\n%#v\ngot\n%#v", want, back)
+	}
+}
+
+func TestParseTOML(t *testing.T) {
+	input := `# comment
+title = "TOML" # trailing
+literal = 'C:\path'
+escapes = "a\tb\u00e9\""
+number = 1_000
+date = 1979-05-27 07:32:00Z
+dotted.key = true
+ml = """
+one \
+   two
+"""
+mll = '''
+raw \n'''
+array = [
+  1,  # first
+  2,
+]
+inline = { a = 1, b.c = "x" }
+
+[server."web 01"]
+port = 80
+
+[[product]]
+name = "a"
+
+[[product]]
+name = "b"
+`
+	want := Table{
+		{"title", "TOML"},
+		{"literal", `C:\path`},
+		{"escapes", "a\tbé\""},
+		{"number", "1_000"},
+		{"date", "1979-05-27 07:32:00Z"},
+		{"dotted", Table{{"key", "true"}}},
+		{"ml", "one two\n"},
+		{"mll", `raw \n`},
+		{"array", []any{"1", "2"}},
+		{"inline", Table{{"a", "1"}, {"b", Table{{"c", "x"}}}}},
+		{"server", Table{{"web 01", Table{{"port", "80"}}}}},
+		{"product", []any{Table{{"name", "a"}}, Table{{"name", "b"}}}},
+	}
+	got, err := ParseTOML([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected\n%#v\ngot\n%#v", want, got)
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"a = 1\na = 2\n", "toml: line 2: key a is already defined"},
+		{"[a]\n[a]\n", "toml: line 2: table a is already defined"},
+		{"a = 1\n[a]\n", "toml: line 2: key a is already defined"},
+		{"a = 1\n[a.b]\n", "toml: line 2: key a is not a table"},
+		{"[[a]]\n[a]\n", "toml: line 2: table a is already defined as an array of tables"},
+		{"a = {b = 1}\n[a.c]\n", "toml: line 2: inline table a can not be extended"},
+		{"a = bare\n", `toml: line 1: invalid value "bare"`},
+		{"a = \"x\n", "toml: line 1: unterminated string"},
+		{"a = \"\\q\"\n", `toml: line 1: invalid escape \q`},
+		{"a = 1 b = 2\n", `toml: line 1: expected the end of the line, found 'b'`},
+		{"a 1\n", "toml: line 1: expected = after a"},
+		{"a = [1 2]\n", "toml: line 1: expected , or ] in array"},
+	}
+	for i, tc := range tests {
+		_, err := ParseTOML([]byte(tc.input))
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("case %d: expected %q got %v", i, tc.want, err)
+		}
+	}
+}
@@ -0,0 +1,738 @@
+package convert
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ParseYAML reads a YAML document whose top level is a mapping. Scalars
+// are kept as text, and null, ~ and empty values are read as nil.
+func ParseYAML(data []byte) (Table, error) {
+	src := strings.TrimSuffix(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	p := &yamlParser{lines: strings.Split(src, "\n")}
+	return p.document()
+}
+
+// yamlParser reads block collections line by line, by indentation
+type yamlParser struct {
+	lines []string
+
+	// index of the current line
+	i int
+}
+
+func (p *yamlParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("yaml: line %d: %s", p.i+1, fmt.Sprintf(format, args...))
+}
+
+// next moves to the next line with content and returns its indentation,
+// or -1 at the end
+func (p *yamlParser) next() int {
+	for ; p.i < len(p.lines); p.i++ {
+		line := p.lines[p.i]
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed[0] == '#' {
+			continue
+		}
+		return len(line) - len(strings.TrimLeft(line, " "))
+	}
+	return -1
+}
+
+// end reports if the line at indentation ind ends the current collection
+func (p *yamlParser) end(ind, n int) bool {
+	return ind < n || (ind == 0 && (p.marker("---") || p.marker("...")))
+}
+
+// marker reports if the current line starts with the document marker m
+func (p *yamlParser) marker(m string) bool {
+	line := p.lines[p.i]
+	if !strings.HasPrefix(line, m) {
+		return false
+	}
+	rest := strings.TrimSpace(line[len(m):])
+	return rest == "" || rest[0] == '#'
+}
+
+func (p *yamlParser) document() (Table, error) {
+	n := p.next()
+	if n == 0 && p.marker("---") {
+		p.i++
+		n = p.next()
+	}
+	if n < 0 {
+		return Table{}, nil
+	}
+	v, err := p.block(n)
+	if err != nil {
+		return nil, err
+	}
+	if n = p.next(); n == 0 && p.marker("...") {
+		p.i++
+		n = p.next()
+	}
+	if n >= 0 {
+		if n == 0 && p.marker("---") {
+			return nil, p.errorf("multiple documents are not supported")
+		}
+		return nil, p.errorf("unexpected indentation")
+	}
+	t, ok := v.(Table)
+	if !ok {
+		return nil, errors.New("yaml: top level is not a mapping")
+	}
+	return t, nil
+}
+
+// block reads the collection or scalar starting on the current line at
+// indentation n
+func (p *yamlParser) block(n int) (any, error) {
+	line := p.lines[p.i][n:]
+	if line[0] == '\t' {
+		return nil, p.indentErr(line)
+	}
+	if isSeqItem(line) {
+		return p.sequence(n)
+	}
+	if _, _, ok := yamlKey(line); ok {
+		return p.mapping(n)
+	}
+	return p.scalar(line, n-1)
+}
+
+// indentErr returns the error for a line that is indented too far, or
+// with tabs
+func (p *yamlParser) indentErr(line string) error {
+	if strings.TrimLeft(line, " ")[0] == '\t' {
+		return p.errorf("tabs are not allowed for indentation")
+	}
+	return p.errorf("unexpected indentation")
+}
+
+func (p *yamlParser) mapping(n int) (Table, error) {
+	t := Table{}
+	for {
+		ind := p.next()
+		if p.end(ind, n) {
+			return t, nil
+		}
+		line := p.lines[p.i][n:]
+		if ind > n || line[0] == '\t' {
+			return nil, p.indentErr(line)
+		}
+		key, rest, ok := yamlKey(line)
+		if !ok {
+			return nil, p.errorf("expected key: value")
+		}
+		v, err := p.value(rest, n, true)
+		if err != nil {
+			return nil, err
+		}
+		t = append(t, Field{Key: key, Value: v})
+	}
+}
+
+func (p *yamlParser) sequence(n int) ([]any, error) {
+	list := []any{}
+	for {
+		ind := p.next()
+		if p.end(ind, n) || (ind == n && !isSeqItem(p.lines[p.i][n:])) {
+			return list, nil
+		}
+		if ind > n {
+			return nil, p.indentErr(p.lines[p.i][n:])
+		}
+		line := p.lines[p.i]
+		rest := strings.TrimLeft(line[n+1:], " ")
+		var item any
+		var err error
+		if _, _, ok := yamlKey(rest); ok || isSeqItem(rest) {
+			// a collection starting on the same line, read it as if the
+			// dash were a space
+			col := len(line) - len(rest)
+			p.lines[p.i] = strings.Repeat(" ", col) + rest
+			item, err = p.block(col)
+		} else {
+			item, err = p.value(rest, n, false)
+		}
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, item)
+	}
+}
+
+// value reads the value after a key or dash on the current line, and any
+// nested block. n is the indentation of the parent collection, and inMap
+// is set if it is a mapping, whose values may be sequences at the same
+// indentation.
+func (p *yamlParser) value(rest string, n int, inMap bool) (any, error) {
+	rest = strings.TrimLeft(rest, " \t")
+	if rest != "" && rest[0] != '#' {
+		return p.scalar(rest, n)
+	}
+	p.i++
+	ind := p.next()
+	switch {
+	case ind > n:
+		return p.block(ind)
+	case ind == n && inMap && isSeqItem(p.lines[p.i][n:]):
+		return p.sequence(n)
+	}
+	return nil, nil
+}
+
+// scalar reads the scalar, block scalar or flow collection that starts
+// with s on the current line. Block scalars must be indented more than n.
+func (p *yamlParser) scalar(s string, n int) (any, error) {
+	switch s[0] {
+	case '|', '>':
+		return p.blockScalar(s, n)
+	case '[', '{':
+		return p.flow(s)
+	case '"', '\'':
+		v, size, err := unquoteYAML(s)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		if rest := strings.TrimSpace(s[size:]); rest != "" && rest[0] != '#' {
+			return nil, p.errorf("unexpected %q after quoted string", rest)
+		}
+		p.i++
+		return v, nil
+	case '&', '*', '!':
+		return nil, p.errorf("anchors, aliases and tags are not supported")
+	case '@', '`', '%':
+		return nil, p.errorf("unexpected %q", s[0])
+	}
+	if i := commentIndex(s); i >= 0 {
+		s = s[:i]
+	}
+	p.i++
+	return plainYAML(strings.TrimSpace(s)), nil
+}
+
+// blockScalar reads a literal | or folded > scalar with the given header
+func (p *yamlParser) blockScalar(header string, n int) (any, error) {
+	literal := header[0] == '|'
+	chomp, indent := byte(0), -1
+	for i := 1; i < len(header); i++ {
+		switch c := header[i]; {
+		case (c == '+' || c == '-') && chomp == 0:
+			chomp = c
+		case c >= '1' && c <= '9' && indent < 0:
+			indent = n + int(c-'0')
+		case c == ' ' || c == '\t':
+			if rest := strings.TrimSpace(header[i:]); rest != "" && rest[0] != '#' {
+				return nil, p.errorf("invalid block scalar header %q", header)
+			}
+			i = len(header)
+		default:
+			return nil, p.errorf("invalid block scalar header %q", header)
+		}
+	}
+	p.i++
+	var lines []string
+	for ; p.i < len(p.lines); p.i++ {
+		line := p.lines[p.i]
+		if strings.TrimSpace(line) == "" {
+			lines = append(lines, "")
+			continue
+		}
+		ind := len(line) - len(strings.TrimLeft(line, " "))
+		if indent < 0 && ind > n {
+			indent = ind
+		}
+		if ind < indent || ind <= n {
+			break
+		}
+		lines = append(lines, line[indent:])
+	}
+	trailing := 0
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+		trailing++
+	}
+	if len(lines) == 0 {
+		return "", nil
+	}
+	var body string
+	if literal {
+		body = strings.Join(lines, "\n")
+	} else {
+		body = fold(lines)
+	}
+	switch chomp {
+	case '-':
+		return body, nil
+	case '+':
+		return body + "\n" + strings.Repeat("\n", trailing), nil
+	}
+	return body + "\n", nil
+}
+
+// fold joins the lines of a folded scalar. Line breaks between lines of
+// text become spaces, while blank and more indented lines keep theirs.
+func fold(lines []string) string {
+	var b strings.Builder
+	breaks, prevNormal, started := 0, false, false
+	for _, line := range lines {
+		if line == "" {
+			breaks++
+			continue
+		}
+		normal := line[0] != ' ' && line[0] != '\t'
+		switch {
+		case !started:
+			b.WriteString(strings.Repeat("\n", breaks))
+		case prevNormal && normal && breaks == 0:
+			b.WriteByte(' ')
+		case prevNormal && normal:
+			b.WriteString(strings.Repeat("\n", breaks))
+		default:
+			b.WriteString(strings.Repeat("\n", breaks+1))
+		}
+		b.WriteString(line)
+		breaks, prevNormal, started = 0, normal, true
+	}
+	return b.String()
+}
+
+// flow reads a flow collection starting with s, which may continue on the
+// following lines
+func (p *yamlParser) flow(s string) (any, error) {
+	start := p.i
+	for {
+		f := &flowParser{s: s}
+		v, err := f.value()
+		if err == errFlowEnd && p.i+1 < len(p.lines) {
+			p.i++
+			s += "\n" + p.lines[p.i]
+			continue
+		}
+		if err == nil {
+			if f.skip(); f.pos < len(f.s) {
+				err = fmt.Errorf("unexpected %q after flow collection", f.s[f.pos:])
+			}
+		}
+		if err != nil {
+			p.i = start
+			return nil, p.errorf("%v", err)
+		}
+		p.i++
+		return v, nil
+	}
+}
+
+var errFlowEnd = errors.New("unterminated flow collection")
+
+// flowParser reads flow collections: [a, b] and {k: v}
+type flowParser struct {
+	s   string
+	pos int
+}
+
+// skip skips spaces, line breaks and comments
+func (f *flowParser) skip() {
+	for f.pos < len(f.s) {
+		switch c := f.s[f.pos]; {
+		case c == ' ' || c == '\t' || c == '\n':
+			f.pos++
+		case c == '#' && (f.pos == 0 || isYAMLSpace(f.s[f.pos-1])):
+			for f.pos < len(f.s) && f.s[f.pos] != '\n' {
+				f.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (f *flowParser) value() (any, error) {
+	f.skip()
+	if f.pos >= len(f.s) {
+		return nil, errFlowEnd
+	}
+	switch c := f.s[f.pos]; c {
+	case '[':
+		f.pos++
+		list := []any{}
+		for {
+			if f.skip(); f.pos >= len(f.s) {
+				return nil, errFlowEnd
+			}
+			if f.s[f.pos] == ']' {
+				f.pos++
+				return list, nil
+			}
+			v, err := f.value()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+			if err := f.separator(']'); err != nil {
+				return nil, err
+			}
+		}
+	case '{':
+		f.pos++
+		t := Table{}
+		for {
+			if f.skip(); f.pos >= len(f.s) {
+				return nil, errFlowEnd
+			}
+			if f.s[f.pos] == '}' {
+				f.pos++
+				return t, nil
+			}
+			key, err := f.value()
+			if err != nil {
+				return nil, err
+			}
+			k, ok := key.(string)
+			if !ok && key != nil {
+				return nil, errors.New("flow mapping keys must be scalars")
+			}
+			var v any
+			if f.skip(); f.pos < len(f.s) && f.s[f.pos] == ':' {
+				f.pos++
+				if f.skip(); f.pos < len(f.s) && f.s[f.pos] != ',' && f.s[f.pos] != '}' {
+					if v, err = f.value(); err != nil {
+						return nil, err
+					}
+				}
+			}
+			t = append(t, Field{Key: k, Value: v})
+			if err := f.separator('}'); err != nil {
+				return nil, err
+			}
+		}
+	case '"', '\'':
+		v, size, err := unquoteYAML(f.s[f.pos:])
+		if err != nil {
+			return nil, err
+		}
+		f.pos += size
+		return v, nil
+	case ']', '}', ',':
+		return nil, fmt.Errorf("unexpected %q", c)
+	case '&', '*', '!':
+		return nil, errors.New("anchors, aliases and tags are not supported")
+	}
+	start := f.pos
+	for f.pos < len(f.s) {
+		c := f.s[f.pos]
+		if strings.IndexByte(",[]{}\n", c) >= 0 {
+			break
+		}
+		if c == ':' && (f.pos+1 == len(f.s) || strings.IndexByte(" \t\n,[]{}", f.s[f.pos+1]) >= 0) {
+			break
+		}
+		if c == '#' && isYAMLSpace(f.s[f.pos-1]) {
+			break
+		}
+		f.pos++
+	}
+	return plainYAML(strings.TrimSpace(f.s[start:f.pos])), nil
+}
+
+// separator reads the comma after an item, or the closing bracket
+func (f *flowParser) separator(end byte) error {
+	if f.skip(); f.pos >= len(f.s) {
+		return errFlowEnd
+	}
+	switch f.s[f.pos] {
+	case ',':
+		f.pos++
+	case end:
+	default:
+		return fmt.Errorf("expected , or %c", end)
+	}
+	return nil
+}
+
+// plainYAML returns the value of a plain scalar
+func plainYAML(s string) any {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	}
+	return s
+}
+
+// yamlKey splits a "key: value" line. ok is false if the line is not a
+// mapping entry.
+func yamlKey(line string) (key, rest string, ok bool) {
+	if line == "" {
+		return "", "", false
+	}
+	switch line[0] {
+	case '"', '\'':
+		k, size, err := unquoteYAML(line)
+		if err != nil {
+			return "", "", false
+		}
+		after := strings.TrimLeft(line[size:], " \t")
+		if after == "" || after[0] != ':' || (len(after) > 1 && !isYAMLSpace(after[1])) {
+			return "", "", false
+		}
+		return k, after[1:], true
+	case '[', '{', '#', '-', '?', ':', '|', '>':
+		if !isSeqItem(line) && line[0] == '-' && len(line) > 1 {
+			break
+		}
+		return "", "", false
+	}
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '#' && i > 0 && isYAMLSpace(line[i-1]):
+			return "", "", false
+		case line[i] == ':' && (i+1 == len(line) || isYAMLSpace(line[i+1])):
+			return strings.TrimRight(line[:i], " \t"), line[i+1:], true
+		}
+	}
+	return "", "", false
+}
+
+// isSeqItem reports if line starts with a sequence dash
+func isSeqItem(line string) bool {
+	return line == "-" || strings.HasPrefix(line, "- ") || strings.HasPrefix(line, "-\t")
+}
+
+func isYAMLSpace(b byte) bool { return b == ' ' || b == '\t' || b == '\n' }
+
+// commentIndex returns the index of a comment in a plain scalar, or -1
+func commentIndex(s string) int {
+	for i := 1; i < len(s); i++ {
+		if s[i] == '#' && isYAMLSpace(s[i-1]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// unquoteYAML reads the single or double quoted scalar at the start of s
+// and returns its value and length
+func unquoteYAML(s string) (string, int, error) {
+	var b strings.Builder
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\n':
+			return "", 0, errors.New("multi-line quoted strings are not supported")
+		case c == quote && quote == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			b.WriteByte('\'')
+			i++
+		case c == quote:
+			return b.String(), i + 1, nil
+		case c == '\\' && quote == '"':
+			r, size, err := yamlEscape(s[i:])
+			if err != nil {
+				return "", 0, err
+			}
+			b.WriteRune(r)
+			i += size - 1
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, errors.New("unterminated quoted string")
+}
+
+// yamlEscape reads the escape sequence at the start of s
+func yamlEscape(s string) (rune, int, error) {
+	if len(s) < 2 {
+		return 0, 0, errors.New("unterminated quoted string")
+	}
+	simple := map[byte]rune{
+		'0': 0, 'a': '\a', 'b': '\b', 't': '\t', '\t': '\t', 'n': '\n',
+		'v': '\v', 'f': '\f', 'r': '\r', 'e': 0x1b, ' ': ' ', '"': '"',
+		'/': '/', '\\': '\\', 'N': 0x85, '_': 0xa0, 'L': 0x2028, 'P': 0x2029,
+	}
+	if r, ok := simple[s[1]]; ok {
+		return r, 2, nil
+	}
+	size := map[byte]int{'x': 2, 'u': 4, 'U': 8}[s[1]]
+	if size == 0 {
+		return 0, 0, fmt.Errorf("invalid escape %q", s[:2])
+	}
+	if len(s) < 2+size {
+		return 0, 0, fmt.Errorf("invalid escape %q", s)
+	}
+	n, err := strconv.ParseUint(s[2:2+size], 16, 32)
+	if err != nil || !utf8.ValidRune(rune(n)) {
+		return 0, 0, fmt.Errorf("invalid escape %q", s[:2+size])
+	}
+	return rune(n), 2 + size, nil
+}
+
+// FormatYAML returns t as a YAML document. Single arguments are written
+// as plain scalars where possible, lists of them in flow style, and text
+// with line breaks as literal block scalars.
+func FormatYAML(t Table) ([]byte, error) {
+	w := &yamlWriter{}
+	if len(t) == 0 {
+		return []byte("{}\n"), nil
+	}
+	if err := w.table(t, 0, false); err != nil {
+		return nil, err
+	}
+	return w.buf.Bytes(), nil
+}
+
+type yamlWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *yamlWriter) pad(indent int) {
+	w.buf.WriteString(strings.Repeat(" ", indent))
+}
+
+// table writes the fields of t at the given indentation. If inline is set
+// the first field continues the current line, after a sequence dash.
+func (w *yamlWriter) table(t Table, indent int, inline bool) error {
+	for i, f := range t {
+		if i > 0 || !inline {
+			w.pad(indent)
+		}
+		w.buf.WriteString(yamlString(f.Key, false) + ":")
+		if err := w.value(f.Value, indent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// value writes v after a key or sequence dash at the given indentation
+func (w *yamlWriter) value(v any, indent int) error {
+	switch v := v.(type) {
+	case nil:
+		w.buf.WriteByte('\n')
+	case string:
+		if !literalSafe(v) {
+			w.buf.WriteString(" " + yamlString(v, false) + "\n")
+			break
+		}
+		header := " |"
+		if v[0] == ' ' {
+			header += "2"
+		}
+		switch {
+		case strings.HasSuffix(v, "\n\n"):
+			header += "+"
+		case !strings.HasSuffix(v, "\n"):
+			header += "-"
+		}
+		w.buf.WriteString(header + "\n")
+		for _, line := range strings.Split(strings.TrimSuffix(v, "\n"), "\n") {
+			if line != "" {
+				w.pad(indent + 2)
+			}
+			w.buf.WriteString(line + "\n")
+		}
+	case []any:
+		if flowSafe(v) {
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = yamlString(item.(string), true)
+			}
+			w.buf.WriteString(" [" + strings.Join(items, ", ") + "]\n")
+			break
+		}
+		w.buf.WriteByte('\n')
+		for _, item := range v {
+			w.pad(indent + 2)
+			w.buf.WriteByte('-')
+			if t, ok := item.(Table); ok && len(t) > 0 {
+				w.buf.WriteByte(' ')
+				if err := w.table(t, indent+4, true); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := w.value(item, indent+2); err != nil {
+				return err
+			}
+		}
+	case Table:
+		if len(v) == 0 {
+			w.buf.WriteString(" {}\n")
+			break
+		}
+		w.buf.WriteByte('\n')
+		return w.table(v, indent+2, false)
+	default:
+		return fmt.Errorf("convert: unsupported value of type %T", v)
+	}
+	return nil
+}
+
+// flowSafe reports if list can be written as [a, b]
+func flowSafe(list []any) bool {
+	for _, v := range list {
+		if s, ok := v.(string); !ok || strings.Contains(s, "\n") {
+			return false
+		}
+	}
+	return true
+}
+
+// literalSafe reports if s reads back unchanged from a literal block
+// scalar
+func literalSafe(s string) bool {
+	if !strings.Contains(s, "\n") || strings.TrimSpace(s) == "" || s[0] == '\n' {
+		return false
+	}
+	for _, line := range strings.Split(s, "\n") {
+		if line != "" && strings.TrimSpace(line) == "" {
+			return false
+		}
+		for _, r := range line {
+			if (r < 0x20 && r != '\t') || r == 0x7f {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// yamlString returns s as a plain scalar if it reads back unchanged, and
+// quoted otherwise. In flow collections fewer characters are plain.
+func yamlString(s string, flow bool) string {
+	if yamlPlain(s, flow) {
+		return s
+	}
+	return strconv.Quote(s)
+}
+
+func yamlPlain(s string, flow bool) bool {
+	if plainYAML(s) == nil || strings.TrimSpace(s) != s {
+		return false
+	}
+	if strings.IndexByte(",[]{}#&*!|>'\"%@`", s[0]) >= 0 {
+		return false
+	}
+	if strings.IndexByte("-?:", s[0]) >= 0 && (len(s) == 1 || isYAMLSpace(s[1])) {
+		return false
+	}
+	if strings.HasPrefix(s, "---") || strings.HasPrefix(s, "...") {
+		return false
+	}
+	if strings.Contains(s, ": ") || strings.Contains(s, " #") || strings.HasSuffix(s, ":") {
+		return false
+	}
+	if flow && (strings.ContainsAny(s, ",[]{}") || strings.Contains(s, ":")) {
+		return false
+	}
+	for _, r := range s {
+		if r < 0x20 || r == 0x7f || r == 0x85 || r == 0x2028 || r == 0x2029 || r == 0xfeff {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,169 @@
+package convert
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/client9/cmdconfig"
+)
+
+func TestFormatYAML(t *testing.T) {
+	doc, err := cmdconfig.Parse([]byte(input + "odd \"x: y\" \"\" null -\nitems {\n    a {}\n}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := FormatYAML(FromDocument(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `port: 8080
+allow: [a, b]
+flag: []
+server web01:
+  tls: on
+  listen: [80, 443]
+host:
+  - [a]
+  - [b]
+script: |
+  echo "hi" {
+"\"a b\"": c
+odd: ["x: y", "", "null", "-"]
+items:
+  a: {}
+`
+	if string(out) != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, out)
+	}
+
+	table, err := ParseYAML(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := ToDocument(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := back.Format("    "), doc.Format("    "); got != want {
+		t.Errorf("round trip expected\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestFormatYAMLStrings(t *testing.T) {
+	tests := []struct {
+		value any
+		want  string
+	}{
+		{"a b", "k: a b\n"},
+		{"a #b", "k: \"a #b\"\n"},
+		{"-1", "k: -1\n"},
+		{"- 1", "k: \"- 1\"\n"},
+		{"~", "k: \"~\"\n"},
+		{"a\nb", "k: |-\n  a\n  b\n"},
+		{"a\n\n", "k: |+\n  a\n\n"},
+		{"  a\nb\n", "k: |2\n    a\n  b\n"},
+		{" \n", "k: \" \\n\"\n"},
+		{[]any{"a,b", "c"}, "k: [\"a,b\", c]\n"},
+		{[]any{Table{{"a", "1"}, {"b", "2"}}, "x\n"}, "k:\n  - a: 1\n    b: 2\n  - |\n    x\n"},
+		{[]any{[]any{"a", "b\n"}}, "k:\n  -\n    - a\n    - |\n      b\n"},
+	}
+	for i, tc := range tests {
+		out, err := FormatYAML(Table{{"k", tc.value}})
+		if err != nil {
+			t.Errorf("case %d: %v", i, err)
+			continue
+		}
+		if string(out) != tc.want {
+			t.Errorf("case %d: expected %q got %q", i, tc.want, out)
+		}
+		back, err := ParseYAML(out)
+		if err != nil {
+			t.Errorf("case %d: %v", i, err)
+			continue
+		}
+		if want := (Table{{"k", tc.value}}); !reflect.DeepEqual(back, want) {
+			t.Errorf("case %d: read back %#v", i, back)
+		}
+	}
+}
+
+func TestParseYAML(t *testing.T) {
+	input := `---
+# comment
+name: app   # trailing comment
+"quoted key": 'it''s'
+escapes: "tab\there\u00e9"
+empty:
+tilde: ~
+list:
+- a
+- b: 1
+  c: 2
+-   - x
+    - y
+nested:
+    deep:
+        value: "1"
+flow: {a: [1, 2], b: "x, y", c}
+multi: [
+  a,  # first
+  b,
+]
+literal: |
+  line 1
+    indented
+
+  line 3
+folded: >-
+  one
+  two
+
+  three
+url: http://example.com/a#b
+...
+`
+	want := Table{
+		{"name", "app"},
+		{"quoted key", "it's"},
+		{"escapes", "tab\thereé"},
+		{"empty", nil},
+		{"tilde", nil},
+		{"list", []any{"a", Table{{"b", "1"}, {"c", "2"}}, []any{"x", "y"}}},
+		{"nested", Table{{"deep", Table{{"value", "1"}}}}},
+		{"flow", Table{{"a", []any{"1", "2"}}, {"b", "x, y"}, {"c", nil}}},
+		{"multi", []any{"a", "b"}},
+		{"literal", "line 1\n  indented\n\nline 3\n"},
+		{"folded", "one two\nthree"},
+		{"url", "http://example.com/a#b"},
+	}
+	got, err := ParseYAML([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected\n%#v\ngot\n%#v", want, got)
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"- a\n- b\n", "yaml: top level is not a mapping"},
+		{"a: 1\n  b: 2\n", "yaml: line 2: unexpected indentation"},
+		{"a: 1\nb\n", "yaml: line 2: expected key: value"},
+		{"a: &x 1\n", "yaml: line 1: anchors, aliases and tags are not supported"},
+		{"a: 'x\n", "yaml: line 1: unterminated quoted string"},
+		{"a: [1, 2\n", "yaml: line 1: unterminated flow collection"},
+		{"a: \"\\q\"\n", `yaml: line 1: invalid escape "\\q"`},
+		{"a: 1\n---\nb: 2\n", "yaml: line 2: multiple documents are not supported"},
+		{"a:\n\tb: 1\n", "yaml: line 2: tabs are not allowed for indentation"},
+	}
+	for i, tc := range tests {
+		_, err := ParseYAML([]byte(tc.input))
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("case %d: expected %q got %v", i, tc.want, err)
+		}
+	}
+}
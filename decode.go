@@ -0,0 +1,291 @@
+package cmdconfig
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Unmarshal parses data and stores the result in the struct pointed to by v.
+//
+// Each command is matched to a struct field by its first argument, using the
+// name from a `cmdconfig:"name"` tag or the lower-cased field name. A tag of
+// "-" skips the field. The remaining arguments are converted based on the
+// field type:
+//
+//   - string, bool, int, uint and float kinds, time.Duration and types
+//     implementing encoding.TextUnmarshaler take a single argument. Bools
+//     are on/off, yes/no or true/false, as for Command.Bool, and a bool
+//     with no argument is set to true.
+//   - slices of those take any number of arguments, and repeated commands
+//     append to the slice.
+//   - structs and pointers to structs are decoded from the brace body.
+//   - slices of structs append one element per command.
+//   - maps are keyed by the second argument, e.g. "server web01 { ... }"
+//     decodes into a map[string]Server. Scalar map values take the
+//     remaining arguments.
+//
+// A string field in a struct tagged `cmdconfig:",label"` receives the
+// argument following the command name, e.g. "/api" in "location /api { ... }".
+// For a map value the map key comes first, so "server web01 primary { ... }"
+// sets the label to "primary", and without a third argument it is empty.
+//
+// Errors are returned as *ScanError with the position of the offending
+// command or argument.
+func Unmarshal(data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("cmdconfig: Unmarshal requires a non-nil pointer to a struct")
+	}
+	return decodeStruct(NewScanner(data), rv.Elem())
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// field describes how a struct field is matched by a command
+type field struct {
+	name  string
+	index int
+	label bool
+}
+
+// structFields returns the decodable fields of t, keyed by command name
+func structFields(t reflect.Type) (map[string]field, *field) {
+	fields := map[string]field{}
+	var label *field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		tag := sf.Tag.Get("cmdconfig")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = strings.ToLower(sf.Name)
+		}
+		f := field{name: name, index: i, label: opts == "label"}
+		if f.label {
+			label = &f
+			continue
+		}
+		fields[name] = f
+	}
+	return fields, label
+}
+
+// decodeStruct decodes every command from s into the struct v
+func decodeStruct(s *Scanner, v reflect.Value) error {
+	fields, _ := structFields(v.Type())
+	for {
+		cmd, err := s.NextCommand()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(cmd.Args) == 0 {
+			return errorf(cmd.Pos, "block without a directive name")
+		}
+		f, ok := fields[cmd.Args[0]]
+		if !ok {
+			return errorf(cmd.Pos, "unknown directive %q", cmd.Args[0])
+		}
+		if err := decodeCommand(s, cmd, v.Field(f.index)); err != nil {
+			return err
+		}
+	}
+}
+
+// decodeCommand stores the arguments and body of cmd in v
+func decodeCommand(s *Scanner, cmd *Command, v reflect.Value) error {
+	name := cmd.Args[0]
+
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+
+	switch {
+	case isScalar(v.Type()):
+		if cmd.HasBody() {
+			return errorf(cmd.BodyStart, "%s does not take a body", name)
+		}
+		if v.Kind() == reflect.Bool && len(cmd.Args) == 1 {
+			v.SetBool(true)
+			return nil
+		}
+		if len(cmd.Args) != 2 {
+			return errorf(cmd.Pos, "%s requires exactly one argument, got %d", name, len(cmd.Args)-1)
+		}
+		return setScalar(v, cmd.Args[1], name, cmd.ArgPos[1])
+
+	case v.Kind() == reflect.Struct:
+		return decodeBlock(s, cmd, v, 1)
+
+	case v.Kind() == reflect.Slice:
+		elem := v.Type().Elem()
+		if isScalar(elem) {
+			if cmd.HasBody() {
+				return errorf(cmd.BodyStart, "%s does not take a body", name)
+			}
+			for i := 1; i < len(cmd.Args); i++ {
+				ev := reflect.New(elem).Elem()
+				if err := setScalar(ev, cmd.Args[i], name, cmd.ArgPos[i]); err != nil {
+					return err
+				}
+				v.Set(reflect.Append(v, ev))
+			}
+			return nil
+		}
+		ev := reflect.New(elem).Elem()
+		if err := decodeCommand(s, cmd, ev); err != nil {
+			return err
+		}
+		v.Set(reflect.Append(v, ev))
+		return nil
+
+	case v.Kind() == reflect.Map:
+		if len(cmd.Args) < 2 {
+			return errorf(cmd.Pos, "%s requires a name", name)
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		key := reflect.New(v.Type().Key()).Elem()
+		if err := setScalar(key, cmd.Args[1], name, cmd.ArgPos[1]); err != nil {
+			return err
+		}
+		ev := reflect.New(v.Type().Elem()).Elem()
+		if existing := v.MapIndex(key); existing.IsValid() {
+			ev.Set(existing)
+		}
+		if err := decodeMapValue(s, cmd, ev); err != nil {
+			return err
+		}
+		v.SetMapIndex(key, ev)
+		return nil
+	}
+	return errorf(cmd.Pos, "%s: unsupported field type %s", name, v.Type())
+}
+
+// decodeMapValue decodes cmd, minus the map key, into a map value
+func decodeMapValue(s *Scanner, cmd *Command, v reflect.Value) error {
+	name := cmd.Args[0]
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Struct && !isScalar(v.Type()) {
+		return decodeBlock(s, cmd, v, 2)
+	}
+
+	// drop the key and decode the rest as if it were a regular field
+	sub := *cmd
+	sub.Args = append([]string{name}, cmd.Args[2:]...)
+	sub.ArgPos = append([]Position{cmd.ArgPos[0]}, cmd.ArgPos[2:]...)
+	return decodeCommand(s, &sub, v)
+}
+
+// decodeBlock decodes the body of cmd into the struct v. The argument at
+// index label, if any, goes into the label field
+func decodeBlock(s *Scanner, cmd *Command, v reflect.Value, label int) error {
+	name := cmd.Args[0]
+	_, labelField := structFields(v.Type())
+	switch {
+	case label < len(cmd.Args) && labelField != nil:
+		if label+1 < len(cmd.Args) {
+			return errorf(cmd.ArgPos[label+1], "%s has too many arguments", name)
+		}
+		lv := v.Field(labelField.index)
+		if err := setScalar(lv, cmd.Args[label], name, cmd.ArgPos[label]); err != nil {
+			return err
+		}
+	case label < len(cmd.Args):
+		return errorf(cmd.ArgPos[label], "%s has too many arguments", name)
+	}
+	return decodeStruct(s.bodyScanner(cmd), v)
+}
+
+// isScalar reports if t is decoded from a single argument
+func isScalar(t reflect.Type) bool {
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// setScalar converts arg and stores it in v
+func setScalar(v reflect.Value, arg string, name string, pos Position) error {
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		if err := u.UnmarshalText([]byte(arg)); err != nil {
+			return errorf(pos, "invalid value %q for %s: %v", arg, name, err)
+		}
+		return nil
+	}
+
+	var err error
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(arg)
+	case reflect.Bool:
+		b, ok := parseBool(arg)
+		if !ok {
+			return errorf(pos, "invalid bool %q for %s", arg, name)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == durationType {
+			var d time.Duration
+			d, err = time.ParseDuration(arg)
+			v.SetInt(int64(d))
+			break
+		}
+		var n int64
+		n, err = strconv.ParseInt(arg, 0, v.Type().Bits())
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		n, err = strconv.ParseUint(arg, 0, v.Type().Bits())
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		f, err = strconv.ParseFloat(arg, v.Type().Bits())
+		v.SetFloat(f)
+	}
+	if err != nil {
+		var numErr *strconv.NumError
+		if errors.As(err, &numErr) {
+			err = numErr.Err
+		}
+		return errorf(pos, "invalid %s %q for %s: %v", v.Type(), arg, name, err)
+	}
+	return nil
+}
+
+// errorf returns a *ScanError at pos
+func errorf(pos Position, format string, args ...any) error {
+	return &ScanError{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
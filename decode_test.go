@@ -0,0 +1,241 @@
+package cmdconfig
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testLocation struct {
+	Path      string `cmdconfig:",label"`
+	ProxyPass string `cmdconfig:"proxy_pass"`
+	Timeout   time.Duration
+}
+
+type testServer struct {
+	Host     string
+	Ports    []int `cmdconfig:"port"`
+	SSL      bool
+	Weight   float64
+	Upstream []string
+	Location []testLocation
+}
+
+type testDatabase struct {
+	Host     string
+	User     string
+	Password string
+	MaxConns uint16 `cmdconfig:"max_conns"`
+}
+
+type testConfig struct {
+	Name     string
+	Port     int
+	Debug    bool
+	Bind     net.IP
+	Database *testDatabase
+	Servers  map[string]testServer `cmdconfig:"server"`
+	Env      map[string]string
+	Ignored  string `cmdconfig:"-"`
+}
+
+func TestUnmarshal(t *testing.T) {
+	input := `
+name "My App"
+port 0x1F90
+debug
+bind 127.0.0.1
+database {
+    host localhost
+    user myapp
+    password "secret123"
+    max_conns 100
+}
+env HOME /root
+env LANG C
+server web01 {
+    host 192.168.1.10
+    port 8080 9443
+    port 8081
+    ssl true
+    weight 0.5
+    upstream backend1 backend2
+
+    location /api {
+        proxy_pass http://backend
+        timeout 30s
+    }
+    location / {
+        proxy_pass http://static
+    }
+}
+server web02 {
+    host 192.168.1.11
+}
+`
+	want := testConfig{
+		Name:  "My App",
+		Port:  8080,
+		Debug: true,
+		Bind:  net.ParseIP("127.0.0.1"),
+		Database: &testDatabase{
+			Host:     "localhost",
+			User:     "myapp",
+			Password: "secret123",
+			MaxConns: 100,
+		},
+		Env: map[string]string{"HOME": "/root", "LANG": "C"},
+		Servers: map[string]testServer{
+			"web01": {
+				Host:     "192.168.1.10",
+				Ports:    []int{8080, 9443, 8081},
+				SSL:      true,
+				Weight:   0.5,
+				Upstream: []string{"backend1", "backend2"},
+				Location: []testLocation{
+					{Path: "/api", ProxyPass: "http://backend", Timeout: 30 * time.Second},
+					{Path: "/", ProxyPass: "http://static"},
+				},
+			},
+			"web02": {Host: "192.168.1.11"},
+		},
+	}
+
+	var got testConfig
+	if err := Unmarshal([]byte(input), &got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected\n%+v\ngot\n%+v", want, got)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	type test struct {
+		input string
+		msg   string
+		pos   Position
+	}
+
+	tests := []test{
+		{
+			input: "name a\nbogus 1",
+			msg:   `unknown directive "bogus"`,
+			pos:   Position{Line: 2, Column: 1, Offset: 7},
+		},
+		{
+			input: "port  http",
+			msg:   `invalid int "http" for port: invalid syntax`,
+			pos:   Position{Line: 1, Column: 7, Offset: 6},
+		},
+		{
+			input: "database {\n  max_conns 70000\n}",
+			msg:   `invalid uint16 "70000" for max_conns: value out of range`,
+			pos:   Position{Line: 2, Column: 13, Offset: 23},
+		},
+		{
+			input: "server web01 {\n  location /api {\n    timeout forever\n  }\n}",
+			msg:   `invalid time.Duration "forever" for timeout`,
+			pos:   Position{Line: 3, Column: 13, Offset: 45},
+		},
+		{
+			input: "name a b",
+			msg:   "name requires exactly one argument, got 2",
+			pos:   Position{Line: 1, Column: 1, Offset: 0},
+		},
+		{
+			input: "name { x }",
+			msg:   "name does not take a body",
+			pos:   Position{Line: 1, Column: 6, Offset: 5},
+		},
+		{
+			input: "server {\n}",
+			msg:   "server requires a name",
+			pos:   Position{Line: 1, Column: 1, Offset: 0},
+		},
+		{
+			input: "database extra {\n}",
+			msg:   "database has too many arguments",
+			pos:   Position{Line: 1, Column: 10, Offset: 9},
+		},
+		{
+			input: "bind not-an-ip",
+			msg:   `invalid value "not-an-ip" for bind`,
+			pos:   Position{Line: 1, Column: 6, Offset: 5},
+		},
+		{
+			input: "database {\n  host 'unclosed\n}",
+			msg:   "got EOF in single quote",
+			pos:   Position{Line: 3, Column: 1, Offset: 28},
+		},
+	}
+
+	for i, tc := range tests {
+		var cfg testConfig
+		err := Unmarshal([]byte(tc.input), &cfg)
+		var scanErr *ScanError
+		if !errors.As(err, &scanErr) {
+			t.Fatalf("case %d, expected *ScanError got %v", i, err)
+		}
+		if !strings.Contains(scanErr.Msg, tc.msg) {
+			t.Errorf("case %d, expected error containing %q got %q", i, tc.msg, scanErr.Msg)
+		}
+		if scanErr.Pos != tc.pos {
+			t.Errorf("case %d, expected error at %+v got %+v", i, tc.pos, scanErr.Pos)
+		}
+	}
+
+	var cfg testConfig
+	if err := Unmarshal([]byte("name a"), cfg); err == nil {
+		t.Errorf("expected error for non-pointer")
+	}
+}
+
+func TestUnmarshalMapLabel(t *testing.T) {
+	var cfg struct {
+		Location map[string]testLocation
+	}
+	input := "location web01 /api {\n  timeout 5s\n}\nlocation web02 {\n}\n"
+	if err := Unmarshal([]byte(input), &cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]testLocation{
+		"web01": {Path: "/api", Timeout: 5 * time.Second},
+		"web02": {},
+	}
+	if !reflect.DeepEqual(cfg.Location, want) {
+		t.Errorf("expected %+v got %+v", want, cfg.Location)
+	}
+}
+
+func TestUnmarshalBool(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"debug on", true},
+		{"debug off", false},
+		{"debug yes", true},
+		{"debug NO", false},
+		{"debug true", true},
+		{"debug", true},
+	}
+	for i, tc := range tests {
+		var cfg testConfig
+		if err := Unmarshal([]byte(tc.input), &cfg); err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		if cfg.Debug != tc.want {
+			t.Errorf("case %d: expected %v got %v", i, tc.want, cfg.Debug)
+		}
+	}
+
+	var cfg testConfig
+	err := Unmarshal([]byte("debug maybe"), &cfg)
+	if err == nil || err.Error() != `invalid bool "maybe" for debug at line 1, column 7` {
+		t.Errorf("got %v", err)
+	}
+}
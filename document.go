@@ -0,0 +1,372 @@
+package cmdconfig
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// Document is a fully parsed configuration, with the body of every block
+// parsed recursively into child nodes.
+type Document struct {
+	Children []*Node
+}
+
+// Node is a single command in a Document. The embedded Command holds the
+// arguments, the raw body text and their positions.
+type Node struct {
+	Command
+
+	// Children are the commands in the body, unless Raw is set
+	Children []*Node
+
+	// Raw is set if the body was kept as text and not parsed
+	Raw bool
+}
+
+// HasBody reports if the node has a body. Unlike Command.HasBody it does
+// not rely on positions, so it also holds for nodes built in code or read
+// from JSON.
+func (n *Node) HasBody() bool {
+	return n.Raw || n.Children != nil || n.Command.HasBody()
+}
+
+// Parser parses a Document. The zero value parses every body.
+type Parser struct {
+	// Raw reports if the body of the block with the given arguments should
+	// be kept as text instead of parsed, e.g. for embedded scripts. Heredoc
+	// bodies are always kept as text.
+	Raw func(args []string) bool
+
+	// MaxErrors enables error recovery if non-zero. Up to MaxErrors syntax
+	// errors are collected and returned as an ErrorList along with the
+	// commands that did parse. A negative value means no limit.
+	MaxErrors int
+
+	// Lookup enables expansion of ${VAR} references, see Scanner.Expand
+	Lookup func(name string) (string, bool)
+
+	// Variables enables variables defined in the config itself with
+	//
+	//	set name value
+	//
+	// Later commands in the same block, or in blocks nested in it, can
+	// use the value as ${name}. A set in a nested block hides the outer
+	// value until the end of that block. Names that are not set are passed
+	// to Lookup. The set commands are not included in the Document.
+	Variables bool
+
+	// Semicolons lets an unquoted ';' end a command, see Scanner.Semicolons
+	Semicolons bool
+}
+
+// Parse parses data into a Document using the default Parser
+func Parse(data []byte) (*Document, error) {
+	p := Parser{}
+	return p.Parse(data)
+}
+
+// Parse parses data into a Document
+func (p *Parser) Parse(data []byte) (*Document, error) {
+	return p.parseScanner(NewScanner(data))
+}
+
+// ParseFile is like Parse but the positions of every node and error
+// carry the file name, as with Load
+func (p *Parser) ParseFile(name string, data []byte) (*Document, error) {
+	return p.parseScanner(NewScannerFile(name, data))
+}
+
+func (p *Parser) parseScanner(s *Scanner) (*Document, error) {
+	if p.MaxErrors != 0 {
+		s.RecoverErrors(p.MaxErrors)
+	}
+	l := &loader{p: p}
+	children, err := l.parse(s, l.scope())
+	if err != nil {
+		return nil, err
+	}
+	doc := &Document{Children: children}
+	if err := s.endErr(io.EOF); err != io.EOF {
+		return doc, err
+	}
+	return doc, nil
+}
+
+// loader holds the state of a Parser.Parse or Parser.Load
+type loader struct {
+	p *Parser
+
+	// include commands are only expanded when loading from fsys
+	fsys fs.FS
+
+	// files currently being loaded, innermost last
+	stack []string
+
+	// error recovery, shared by the scanners of every file
+	errs      *ErrorList
+	maxErrors int
+}
+
+// parse reads every command from s, recursing into bodies. sc holds the
+// variables in scope, nil unless the Parser has Variables set.
+func (l *loader) parse(s *Scanner, sc *scope) ([]*Node, error) {
+	if sc != nil {
+		s.Expand(sc.get)
+	} else {
+		s.Expand(l.p.Lookup)
+	}
+	s.Semicolons(l.p.Semicolons)
+	nodes := []*Node{}
+	for {
+		cmd, err := s.nextCommand()
+		if err == io.EOF {
+			return nodes, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case l.fsys != nil && cmd.Name() == "include":
+			included, err := l.include(cmd, sc)
+			if err != nil {
+				if err := s.recover(err); err != nil {
+					return nil, err
+				}
+			}
+			nodes = append(nodes, included...)
+			continue
+		case sc != nil && cmd.Name() == "set":
+			if err := sc.set(cmd); err != nil {
+				if err := s.recover(err); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		n := &Node{Command: *cmd}
+		if cmd.HasBody() {
+			if cmd.Heredoc != "" || (l.p.Raw != nil && l.p.Raw(cmd.Args)) {
+				n.Raw = true
+			} else if n.Children, err = l.parse(s.bodyScanner(cmd), sc.child()); err != nil {
+				return nil, err
+			}
+		}
+		nodes = append(nodes, n)
+	}
+}
+
+// Child returns the first command named name, or nil
+func (d *Document) Child(name string) *Node {
+	return findChild(d.Children, name)
+}
+
+// All returns every command named name
+func (d *Document) All(name string) []*Node {
+	return findAll(d.Children, name)
+}
+
+// Walk calls fn for every node in depth first order. If fn returns false
+// the children of that node are skipped.
+func (d *Document) Walk(fn func(n *Node) bool) {
+	walk(d.Children, fn)
+}
+
+// Format returns the document as text, with nested blocks indented by indent
+func (d *Document) Format(indent string) string {
+	e := &encoder{indent: indent}
+	for _, n := range d.Children {
+		n.encode(e, 0)
+	}
+	return e.buf.String()
+}
+
+// Child returns the first child command named name, or nil
+func (n *Node) Child(name string) *Node {
+	return findChild(n.Children, name)
+}
+
+// All returns every child command named name
+func (n *Node) All(name string) []*Node {
+	return findAll(n.Children, name)
+}
+
+// Format returns the node and its children as text, with nested blocks
+// indented by indent
+func (n *Node) Format(indent string) string {
+	e := &encoder{indent: indent}
+	n.encode(e, 0)
+	return e.buf.String()
+}
+
+// FormatCompact returns the document on a single line, with commands
+// separated by "; " and blocks written as "{ a; b }". The result reads
+// back with semicolons enabled. Heredocs still take lines of their own.
+func (d *Document) FormatCompact() string {
+	e := &encoder{}
+	encodeCompact(e, d.Children, 0)
+	return e.buf.String()
+}
+
+// FormatCompact returns the node and its children on a single line, see
+// Document.FormatCompact
+func (n *Node) FormatCompact() string {
+	e := &encoder{}
+	encodeCompact(e, []*Node{n}, 0)
+	return e.buf.String()
+}
+
+// encodeCompact writes nodes at the given depth, see FormatCompact
+func encodeCompact(e *encoder, nodes []*Node, depth int) {
+	for i, n := range nodes {
+		if i > 0 && !bytes.HasSuffix(e.buf.Bytes(), []byte("\n")) {
+			e.buf.WriteString("; ")
+		}
+		for j, arg := range n.Args {
+			if j > 0 {
+				e.buf.WriteByte(' ')
+			}
+			e.buf.WriteString(formatNested(arg, depth))
+		}
+		if n.HasBody() && len(n.Args) > 0 {
+			e.buf.WriteByte(' ')
+		}
+		switch {
+		case n.Heredoc != "":
+			e.buf.WriteString(formatHeredoc(n.Body) + "\n")
+		case !n.HasBody():
+		case n.Raw:
+			body := strings.TrimSpace(n.Body)
+			if !braceSafe(body) {
+				for j := 0; j <= depth; j++ {
+					body = escapeBrace(body)
+				}
+			}
+			if body == "" {
+				e.buf.WriteString("{}")
+			} else {
+				e.buf.WriteString("{ " + body + " }")
+			}
+		case len(n.Children) == 0:
+			e.buf.WriteString("{}")
+		default:
+			e.buf.WriteString("{ ")
+			encodeCompact(e, n.Children, depth+1)
+			if bytes.HasSuffix(e.buf.Bytes(), []byte("\n")) {
+				e.buf.WriteString("}")
+			} else {
+				e.buf.WriteString(" }")
+			}
+		}
+	}
+	if depth == 0 && len(nodes) > 0 && !bytes.HasSuffix(e.buf.Bytes(), []byte("\n")) {
+		e.buf.WriteByte('\n')
+	}
+}
+
+// encode writes the node at the given depth
+func (n *Node) encode(e *encoder, depth int) {
+	if n.Heredoc != "" {
+		e.heredoc(depth, n.Args, n.Body)
+		return
+	}
+	if !n.HasBody() {
+		e.command(depth, n.Args, nil)
+		return
+	}
+	e.command(depth, n.Args, func() error {
+		if n.Raw {
+			e.rawBody(depth+1, n.Body)
+			return nil
+		}
+		for _, c := range n.Children {
+			c.encode(e, depth+1)
+		}
+		return nil
+	})
+}
+
+func findChild(nodes []*Node, name string) *Node {
+	for _, n := range nodes {
+		if n.Name() == name {
+			return n
+		}
+	}
+	return nil
+}
+
+func findAll(nodes []*Node, name string) []*Node {
+	var out []*Node
+	for _, n := range nodes {
+		if n.Name() == name {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+func walk(nodes []*Node, fn func(n *Node) bool) {
+	for _, n := range nodes {
+		if fn(n) {
+			walk(n.Children, fn)
+		}
+	}
+}
+
+// rawBody writes body as the contents of a block at the given depth. The
+// blank first line and indentation left over from the braces are dropped
+// so formatting is stable.
+func (e *encoder) rawBody(depth int, body string) {
+	body = strings.TrimPrefix(body, "\n")
+	if i := strings.LastIndexByte(body, '\n'); i >= 0 && strings.TrimSpace(body[i:]) == "" {
+		body = body[:i]
+	}
+	if strings.TrimSpace(body) == "" {
+		return
+	}
+	if !braceSafe(body) {
+		// every enclosing block removes one level of escapes
+		for j := 0; j < depth; j++ {
+			body = escapeBrace(body)
+		}
+	}
+	prefix := strings.Repeat(e.indent, depth)
+	for _, line := range strings.Split(body, "\n") {
+		if line != "" {
+			e.buf.WriteString(prefix)
+		}
+		e.buf.WriteString(line)
+		e.buf.WriteByte('\n')
+	}
+}
+
+// heredoc writes a command with a heredoc body. The body is written as
+// is, heredocs need no escapes at any depth.
+func (e *encoder) heredoc(depth int, args []string, body string) {
+	e.command(depth, args, nil)
+	e.buf.Truncate(e.buf.Len() - 1)
+	e.buf.WriteString(" " + formatHeredoc(body) + "\n")
+}
+
+// braceSafe reports if body reads back unchanged from inside braces at any
+// depth, i.e. its braces balance and it contains no brace escapes
+func braceSafe(body string) bool {
+	depth := 0
+	for i := 0; i < len(body); i++ {
+		switch body[i] {
+		case '\\':
+			if i+1 < len(body) && strings.IndexByte("\\{}", body[i+1]) >= 0 {
+				return false
+			}
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth < 0 {
+				return false
+			}
+		}
+	}
+	return depth == 0
+}
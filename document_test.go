@@ -0,0 +1,166 @@
+package cmdconfig
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseDocument(t *testing.T) {
+	input := `name "My App"
+server web01 {
+    host 192.168.1.10
+    location /api {
+        proxy_pass http://backend
+    }
+    script {
+        if [ -f x ]; then { echo ok; } fi
+    }
+}
+empty {}
+`
+	p := Parser{Raw: func(args []string) bool { return args[0] == "script" }}
+	doc, err := p.Parse([]byte(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(doc.Children) != 3 {
+		t.Fatalf("expected 3 top level nodes got %d", len(doc.Children))
+	}
+
+	server := doc.Child("server")
+	if server == nil || !reflect.DeepEqual(server.Args, []string{"server", "web01"}) {
+		t.Fatalf("unexpected server node %+v", server)
+	}
+	if server.Pos != (Position{Line: 2, Column: 1, Offset: 14}) {
+		t.Errorf("unexpected server position %v", server.Pos)
+	}
+	if server.End != (Position{Line: 10, Column: 2, Offset: 173}) {
+		t.Errorf("unexpected server end %v", server.End)
+	}
+
+	loc := server.Child("location")
+	if loc == nil || loc.Args[1] != "/api" {
+		t.Fatalf("unexpected location node %+v", loc)
+	}
+	pass := loc.Child("proxy_pass")
+	if pass == nil || pass.Pos != (Position{Line: 5, Column: 9, Offset: 79}) {
+		t.Fatalf("unexpected proxy_pass node %+v", pass)
+	}
+	if pass.End != (Position{Line: 5, Column: 34, Offset: 104}) {
+		t.Errorf("unexpected proxy_pass end %v", pass.End)
+	}
+
+	script := server.Child("script")
+	if script == nil || !script.Raw || script.Children != nil {
+		t.Fatalf("expected raw script node, got %+v", script)
+	}
+	if want := "\nif [ -f x ]; then { echo ok; } fi\n"; script.Body != want {
+		t.Errorf("expected script body %q got %q", want, script.Body)
+	}
+
+	empty := doc.Child("empty")
+	if empty == nil || !empty.HasBody() || len(empty.Children) != 0 {
+		t.Errorf("unexpected empty node %+v", empty)
+	}
+	if doc.Child("missing") != nil {
+		t.Errorf("expected nil for missing child")
+	}
+
+	var names []string
+	doc.Walk(func(n *Node) bool {
+		names = append(names, n.Name())
+		return n.Name() != "location"
+	})
+	want := []string{"name", "server", "host", "location", "script", "empty"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("expected walk order %v got %v", want, names)
+	}
+}
+
+func TestParseDocumentErrors(t *testing.T) {
+	_, err := Parse([]byte("a {\n  b {\n    c 'x\n  }\n}"))
+	var scanErr *ScanError
+	if !errors.As(err, &scanErr) {
+		t.Fatalf("expected *ScanError got %v", err)
+	}
+	if scanErr.Pos != (Position{Line: 4, Column: 3, Offset: 21}) {
+		t.Errorf("unexpected error position %v", scanErr.Pos)
+	}
+}
+
+func TestDocumentFormat(t *testing.T) {
+	input := "name  'My App'\nserver web01 {\n  host \"a\"\n  location /{id} {\n    proxy_pass \"x\\\\\\{y\"\n  }\n  script {\n    echo \"\\\\\\{\"\n      indented\n  }\n}\nempty {}\n"
+	want := `name "My App"
+server web01 {
+    host a
+    location "/\\\{id\\\}" {
+        proxy_pass "x\\\\\\\{y"
+    }
+    script {
+        echo "\\\{"
+          indented
+    }
+}
+empty {}
+`
+	p := Parser{Raw: func(args []string) bool { return args[0] == "script" }}
+	doc, err := p.Parse([]byte(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := doc.Format("    ")
+	if got != want {
+		t.Fatalf("expected:\n%s\ngot:\n%s", want, got)
+	}
+
+	// formatting is stable and preserves values
+	again, err := p.Parse([]byte(got))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if again.Format("    ") != got {
+		t.Errorf("format not stable:\n%s", again.Format("    "))
+	}
+	pass := again.Child("server").Child("location").Child("proxy_pass")
+	if pass.Args[1] != "x{y" {
+		t.Errorf("expected x{y got %q", pass.Args[1])
+	}
+	script := again.Child("server").Child("script")
+	if script.Body != doc.Child("server").Child("script").Body {
+		t.Errorf("raw body changed from %q to %q", doc.Child("server").Child("script").Body, script.Body)
+	}
+}
+
+func TestFormatCompact(t *testing.T) {
+	input := "listen 80\nlisten 443\nlocation / {\n    proxy_pass a\n    timeout 5s\n    empty {}\n}\nx 'a;b' \"{\"\n"
+	doc, err := Parse([]byte(input))
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	want := "listen 80; listen 443; location / { proxy_pass a; timeout 5s; empty {} }; x \"a;b\" \"\\{\"\n"
+	got := doc.FormatCompact()
+	if got != want {
+		t.Errorf("expected %q got %q", want, got)
+	}
+
+	// reads back with semicolons, and formats one command per line again
+	p := Parser{Semicolons: true}
+	again, err := p.Parse([]byte(got))
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if out := again.Format("    "); out != doc.Format("    ") {
+		t.Errorf("expected %q got %q", doc.Format("    "), out)
+	}
+
+	// heredocs keep their lines
+	doc, _ = Parse([]byte("a {\n  s <<EOF\nx\nEOF\n  b 1\n}\nc\n"))
+	want = "a { s <<EOF\nx\nEOF\nb 1 }; c\n"
+	if got := doc.FormatCompact(); got != want {
+		t.Errorf("expected %q got %q", want, got)
+	}
+	if got := doc.Child("c").FormatCompact(); got != "c\n" {
+		t.Errorf("got %q", got)
+	}
+}
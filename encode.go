@@ -0,0 +1,234 @@
+package cmdconfig
+
+import (
+	"bytes"
+	"encoding"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Marshal returns the cmdconfig encoding of v, which must be a struct or a
+// pointer to a struct. It is MarshalIndent with four spaces of indentation.
+func Marshal(v any) ([]byte, error) {
+	return MarshalIndent(v, "    ")
+}
+
+// MarshalIndent is the inverse of Unmarshal, using the same struct tags
+// and type mapping:
+//
+//   - scalars become "name value"
+//   - slices of scalars become a single "name value1 value2 ..."
+//   - structs become "name { ... }"
+//   - slices of structs become repeated "name [label] { ... }" blocks
+//   - maps become one "name key ..." command per key, in sorted order
+//
+// Nested blocks are indented by indent and empty blocks are written as "{}".
+// Nil pointers, maps and slices are omitted, as are zero values of fields
+// tagged `cmdconfig:"name,omitempty"`.
+func MarshalIndent(v any, indent string) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cmdconfig: Marshal requires a struct, got %s", rv.Kind())
+	}
+	e := &encoder{indent: indent}
+	if err := e.encodeStruct(rv, 0); err != nil {
+		return nil, err
+	}
+	return e.buf.Bytes(), nil
+}
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+type encoder struct {
+	buf    bytes.Buffer
+	indent string
+}
+
+// formatNested formats arg for a command at the given nesting depth
+func formatNested(arg string, depth int) string {
+	arg = formatArg(arg)
+	// each level of nesting removes one level of brace escapes
+	for j := 0; j < depth; j++ {
+		arg = escapeBrace(arg)
+	}
+	return arg
+}
+
+// command writes a single command at the given nesting depth. If body is
+// non-nil it is called to write the contents of a brace block.
+func (e *encoder) command(depth int, args []string, body func() error) error {
+	prefix := strings.Repeat(e.indent, depth)
+	e.buf.WriteString(prefix)
+	for i, arg := range args {
+		if i > 0 {
+			e.buf.WriteByte(' ')
+		}
+		e.buf.WriteString(formatNested(arg, depth))
+	}
+	if body != nil {
+		e.buf.WriteString(" {\n")
+		n := e.buf.Len()
+		if err := body(); err != nil {
+			return err
+		}
+		if e.buf.Len() == n {
+			// empty block on one line
+			e.buf.Truncate(n - 1)
+			prefix = ""
+		}
+		e.buf.WriteString(prefix + "}")
+	}
+	e.buf.WriteByte('\n')
+	return nil
+}
+
+// encodeStruct writes each field of the struct v as a command
+func (e *encoder) encodeStruct(v reflect.Value, depth int) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		tag := sf.Tag.Get("cmdconfig")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if opts == "label" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(sf.Name)
+		}
+		fv := v.Field(i)
+		if opts == "omitempty" && fv.IsZero() {
+			continue
+		}
+		if err := e.encodeField(name, nil, fv, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeField writes the value v as one or more commands named name,
+// with any extra leading arguments such as a map key
+func (e *encoder) encodeField(name string, extra []string, v reflect.Value, depth int) error {
+	if v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	args := append([]string{name}, extra...)
+
+	switch {
+	case isScalar(v.Type()) || v.Type().Implements(textMarshalerType):
+		s, err := formatScalar(v)
+		if err != nil {
+			return err
+		}
+		return e.command(depth, append(args, s), nil)
+
+	case v.Kind() == reflect.Struct:
+		if label := structLabel(v); label != "" {
+			args = append(args, label)
+		}
+		return e.command(depth, args, func() error {
+			return e.encodeStruct(v, depth+1)
+		})
+
+	case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+		if v.Len() == 0 {
+			return nil
+		}
+		if isScalar(v.Type().Elem()) {
+			for i := 0; i < v.Len(); i++ {
+				s, err := formatScalar(v.Index(i))
+				if err != nil {
+					return err
+				}
+				args = append(args, s)
+			}
+			return e.command(depth, args, nil)
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encodeField(name, extra, v.Index(i), depth); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case v.Kind() == reflect.Map:
+		keys := make([]string, 0, v.Len())
+		values := map[string]reflect.Value{}
+		for iter := v.MapRange(); iter.Next(); {
+			k, err := formatScalar(iter.Key())
+			if err != nil {
+				return err
+			}
+			keys = append(keys, k)
+			values[k] = iter.Value()
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := e.encodeField(name, append(extra, k), values[k], depth); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("cmdconfig: %s: unsupported type %s", name, v.Type())
+}
+
+// structLabel returns the value of the label field of the struct v, if any
+func structLabel(v reflect.Value) string {
+	_, label := structFields(v.Type())
+	if label == nil {
+		return ""
+	}
+	s, _ := formatScalar(v.Field(label.index))
+	return s
+}
+
+// formatScalar converts a single value to its argument form
+func formatScalar(v reflect.Value) (string, error) {
+	if v.Kind() == reflect.Pointer && v.IsNil() {
+		return "", nil
+	}
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		b, err := m.MarshalText()
+		return string(b), err
+	}
+	if v.CanAddr() {
+		if m, ok := v.Addr().Interface().(encoding.TextMarshaler); ok {
+			b, err := m.MarshalText()
+			return string(b), err
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == durationType {
+			return time.Duration(v.Int()).String(), nil
+		}
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), nil
+	}
+	return "", fmt.Errorf("cmdconfig: unsupported type %s", v.Type())
+}
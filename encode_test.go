@@ -0,0 +1,132 @@
+package cmdconfig
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMarshal(t *testing.T) {
+	cfg := testConfig{
+		Name: "My App",
+		Port: 8080,
+		Bind: net.ParseIP("10.0.0.1"),
+		Database: &testDatabase{
+			Host:     "localhost",
+			Password: "p{a}ss\\word",
+		},
+		Env: map[string]string{"LANG": "C", "HOME": "/root"},
+		Servers: map[string]testServer{
+			"web02": {Host: "b"},
+			"web01": {
+				Host:     "a",
+				Ports:    []int{80, 443},
+				Upstream: []string{"one", "two words"},
+				Location: []testLocation{
+					{Path: "/api", ProxyPass: "http://backend", Timeout: 5 * time.Second},
+				},
+			},
+		},
+	}
+
+	want := `name "My App"
+port 8080
+debug false
+bind 10.0.0.1
+database {
+  host localhost
+  user ""
+  password "p\\\{a\\\}ss\\\\word"
+  max_conns 0
+}
+server web01 {
+  host a
+  port 80 443
+  ssl false
+  weight 0
+  upstream one "two words"
+  location /api {
+    proxy_pass http://backend
+    timeout 5s
+  }
+}
+server web02 {
+  host b
+  ssl false
+  weight 0
+}
+env HOME /root
+env LANG C
+`
+	got, err := MarshalIndent(&cfg, "  ")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	cfg := testConfig{
+		Name:  "odd {name} \\ with \"quotes\" and #hash",
+		Debug: true,
+		Database: &testDatabase{
+			Host:     "}brace",
+			Password: "a\\{b\\}\\\\c\nnewline",
+			MaxConns: 12,
+		},
+		Env: map[string]string{"#key": "{value}"},
+		Servers: map[string]testServer{
+			"web 01": {
+				Host:     "back\\slash",
+				Weight:   1.25,
+				Upstream: []string{"a}", "{b", "c\\"},
+				Location: []testLocation{
+					{Path: "/{id}", ProxyPass: "x\\{y", Timeout: time.Minute},
+					{Path: "", ProxyPass: "z"},
+				},
+			},
+		},
+	}
+
+	data, err := Marshal(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got testConfig
+	if err := Unmarshal(data, &got); err != nil {
+		t.Fatalf("unexpected error: %v\n%s", err, data)
+	}
+	if !reflect.DeepEqual(got, cfg) {
+		t.Errorf("round trip failed\nexpected %+v\ngot      %+v\n%s", cfg, got, data)
+	}
+}
+
+func TestMarshalErrors(t *testing.T) {
+	if _, err := Marshal(42); err == nil {
+		t.Errorf("expected error for non-struct")
+	}
+	type bad struct {
+		Fn func()
+	}
+	if _, err := Marshal(bad{Fn: func() {}}); err == nil {
+		t.Errorf("expected error for unsupported type")
+	}
+}
+
+func TestMarshalOmitEmpty(t *testing.T) {
+	type opts struct {
+		Name  string `cmdconfig:"name,omitempty"`
+		Port  int    `cmdconfig:",omitempty"`
+		Debug bool
+	}
+	got, err := Marshal(opts{Port: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "port 1\ndebug false\n"; string(got) != want {
+		t.Errorf("expected %q got %q", want, got)
+	}
+}
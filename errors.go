@@ -0,0 +1,70 @@
+package cmdconfig
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ErrorList is a list of *ScanErrors, as collected by a Scanner in error
+// recovery mode. The zero value is an empty list ready to use.
+type ErrorList []*ScanError
+
+// Add adds an error at pos with the given message
+func (p *ErrorList) Add(pos Position, msg string) {
+	*p = append(*p, &ScanError{Pos: pos, Msg: msg})
+}
+
+// Reset resets the list to no errors
+func (p *ErrorList) Reset() { *p = (*p)[0:0] }
+
+// ErrorList implements the sort Interface, ordering by position
+func (p ErrorList) Len() int      { return len(p) }
+func (p ErrorList) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+
+func (p ErrorList) Less(i, j int) bool {
+	e, f := p[i].Pos, p[j].Pos
+	if e.Filename != f.Filename {
+		return e.Filename < f.Filename
+	}
+	if e.Line != f.Line {
+		return e.Line < f.Line
+	}
+	if e.Column != f.Column {
+		return e.Column < f.Column
+	}
+	return p[i].Msg < p[j].Msg
+}
+
+// Sort sorts the list by position
+func (p ErrorList) Sort() {
+	sort.Sort(p)
+}
+
+// Error implements the error interface, reporting the first error and
+// how many more there are
+func (p ErrorList) Error() string {
+	switch len(p) {
+	case 0:
+		return "no errors"
+	case 1:
+		return p[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", p[0], len(p)-1)
+}
+
+// Err returns an error equivalent to this list, or nil if it is empty
+func (p ErrorList) Err() error {
+	if len(p) == 0 {
+		return nil
+	}
+	return p
+}
+
+// Unwrap returns each error in the list, for use with errors.Is and errors.As
+func (p ErrorList) Unwrap() []error {
+	errs := make([]error, len(p))
+	for i, e := range p {
+		errs[i] = e
+	}
+	return errs
+}
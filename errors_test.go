@@ -0,0 +1,134 @@
+package cmdconfig
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestErrorList(t *testing.T) {
+	var list ErrorList
+	if list.Err() != nil {
+		t.Errorf("expected nil error for empty list")
+	}
+	list.Add(Position{Line: 3, Column: 1}, "third")
+	list.Add(Position{Line: 1, Column: 5}, "second")
+	list.Add(Position{Line: 1, Column: 2}, "first")
+	list.Sort()
+
+	if want := "first at line 1, column 2 (and 2 more errors)"; list.Error() != want {
+		t.Errorf("expected %q got %q", want, list.Error())
+	}
+	var scanErr *ScanError
+	if !errors.As(list.Err(), &scanErr) || scanErr.Msg != "first" {
+		t.Errorf("expected errors.As to find the first error, got %v", scanErr)
+	}
+	if len(list.Unwrap()) != 3 {
+		t.Errorf("expected 3 unwrapped errors")
+	}
+	list.Reset()
+	if len(list) != 0 {
+		t.Errorf("expected empty list after Reset")
+	}
+}
+
+func TestRecoverErrors(t *testing.T) {
+	input := "one 'unclosed\ntwo a\nthree \"x\\\nfour\n"
+	s := NewScanner([]byte(input))
+	s.RecoverErrors(0)
+
+	var names []string
+	var err error
+	for {
+		var args []string
+		args, _, err = s.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, args[0])
+	}
+	if !reflect.DeepEqual(names, []string{"two", "four"}) {
+		t.Errorf("expected [two four] got %v", names)
+	}
+
+	var list ErrorList
+	if !errors.As(err, &list) {
+		t.Fatalf("expected ErrorList got %T: %v", err, err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("expected 2 errors got %v", list)
+	}
+	// both quotes run to the end of the input, so they are reported
+	// where they start
+	want := []Position{
+		{Line: 1, Column: 5, Offset: 4},
+		{Line: 3, Column: 7, Offset: 26},
+	}
+	for i, e := range list {
+		if e.Pos != want[i] {
+			t.Errorf("error %d: expected position %v got %v", i, want[i], e.Pos)
+		}
+	}
+
+	// without errors the end is still io.EOF
+	s = NewScanner([]byte("ok\n"))
+	s.RecoverErrors(10)
+	s.Next()
+	if _, _, err := s.Next(); err != io.EOF {
+		t.Errorf("expected io.EOF got %v", err)
+	}
+}
+
+func TestRecoverErrorsLimit(t *testing.T) {
+	p := Parser{MaxErrors: 2}
+	doc, err := p.Parse([]byte("a {\n 'x\n}\nb {\n 'y\n}\nc {\n 'z\n}\n"))
+	var list ErrorList
+	if !errors.As(err, &list) || len(list) != 2 {
+		t.Fatalf("expected 2 errors got %v", err)
+	}
+	if doc != nil {
+		t.Errorf("expected no document once the limit is reached")
+	}
+}
+
+func TestParseRecoverErrors(t *testing.T) {
+	input := `good 1
+server a {
+    host 'unclosed
+    port 80
+    location {
+        bad "x
+    }
+}
+bad2 ` + "`tick" + `
+good 2
+`
+	p := Parser{MaxErrors: -1}
+	doc, err := p.Parse([]byte(input))
+	var list ErrorList
+	if !errors.As(err, &list) {
+		t.Fatalf("expected ErrorList got %v", err)
+	}
+	want := []Position{
+		{Line: 3, Column: 10, Offset: 27},
+		{Line: 6, Column: 13, Offset: 76},
+		{Line: 9, Column: 6, Offset: 92},
+	}
+	var got []Position
+	for _, e := range list {
+		got = append(got, e.Pos)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected errors at %+v got %+v", want, got)
+	}
+
+	// everything else was parsed
+	if doc == nil || len(doc.All("good")) != 2 {
+		t.Fatalf("expected both good commands, got %+v", doc)
+	}
+	server := doc.Child("server")
+	if server.Child("port") == nil || server.Child("location") == nil {
+		t.Errorf("expected server children to survive, got %+v", server.Children)
+	}
+}
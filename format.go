@@ -0,0 +1,124 @@
+package cmdconfig
+
+import (
+	"bytes"
+	"strings"
+)
+
+// FormatSource returns src in canonical form, with nested blocks indented
+// by indent. It is the equivalent of go/format.Source:
+//
+//   - one command per line, indented by its depth
+//   - arguments separated by a single space and quoted only if needed,
+//     following the same rules as FormatIndent. Unquoted arguments with a
+//     ';' are kept as written, since they may be separate commands.
+//   - comments are kept, trailing comments separated by a single space
+//   - at most one blank line between commands, none at the start or end
+//     of a block or the file
+//   - empty blocks are written as "{}"
+//
+// Brace bodies that are not valid cmdconfig are kept as written.
+func FormatSource(src []byte, indent string) ([]byte, error) {
+	tree, err := ParseSyntax(src)
+	if err != nil {
+		return nil, err
+	}
+	return tree.Format(indent), nil
+}
+
+// Format returns the tree in canonical form, see FormatSource
+func (t *SyntaxTree) Format(indent string) []byte {
+	f := &formatter{indent: indent}
+	f.stmts(t.Stmts, t.Trailer, 0)
+	return f.buf.Bytes()
+}
+
+type formatter struct {
+	buf    bytes.Buffer
+	indent string
+}
+
+// line starts a new line at the given depth, with a blank line before it
+// if requested and it is not the first line of a block or the file
+func (f *formatter) line(depth int, blank bool, first bool) {
+	if blank && !first {
+		f.buf.WriteByte('\n')
+	}
+	f.buf.WriteString(strings.Repeat(f.indent, depth))
+}
+
+// comments writes the comment lines in trivia, returning if a blank line
+// should come before whatever follows. There is none at the start of a
+// block or the file, unless it follows a comment.
+func (f *formatter) comments(trivia string, depth int, first bool) bool {
+	blank := false
+	lines := strings.Split(trivia, "\n")
+	for i, l := range lines {
+		l = strings.TrimSpace(l)
+		switch {
+		case strings.HasPrefix(l, "#"):
+			f.line(depth, blank, first)
+			f.buf.WriteString(l)
+			f.buf.WriteByte('\n')
+			blank, first = false, false
+		case l == "" && i > 0 && i < len(lines)-1:
+			// a line with nothing on it, the first and last are the ends
+			// of the surrounding lines
+			blank = true
+		}
+	}
+	return blank && !first
+}
+
+// stmts writes a list of statements followed by the trailing trivia of the
+// enclosing block or file
+func (f *formatter) stmts(stmts []*Stmt, trailer string, depth int) {
+	first := true
+	for _, st := range stmts {
+		// comments only asks for a blank line where one is allowed, which
+		// includes after a comment at the start of a block or the file
+		blank := f.comments(st.Leading, depth, first)
+		f.line(depth, blank, false)
+		first = false
+
+		for i, w := range st.Words {
+			if i > 0 {
+				f.buf.WriteByte(' ')
+			}
+			if w.Quote == Bareword && strings.Contains(w.Raw, ";") {
+				// as written, it may be a command separator to a parser
+				// with semicolons enabled
+				f.buf.WriteString(w.Raw)
+				continue
+			}
+			f.buf.WriteString(formatWord(w.Value, Bareword, depth))
+		}
+		if blk := st.Block; blk != nil {
+			if len(st.Words) > 0 {
+				f.buf.WriteByte(' ')
+			}
+			f.block(blk, depth)
+		}
+		if c := strings.TrimSpace(st.Trailing); c != "" {
+			f.buf.WriteString(" " + c)
+		}
+		f.buf.WriteByte('\n')
+	}
+	f.comments(trailer, depth, first)
+}
+
+// block writes a brace body, with the closing brace at depth
+func (f *formatter) block(blk *Block, depth int) {
+	if blk.Raw != "" || blk.IsHeredoc() {
+		// not cmdconfig, leave it alone
+		f.buf.WriteString(blk.Open + blk.Raw + blk.Close)
+		return
+	}
+	if len(blk.Stmts) == 0 && strings.TrimSpace(blk.Trailer) == "" {
+		f.buf.WriteString("{}")
+		return
+	}
+	f.buf.WriteString("{\n")
+	f.stmts(blk.Stmts, blk.Trailer, depth+1)
+	f.buf.WriteString(strings.Repeat(f.indent, depth) + "}")
+}
@@ -0,0 +1,126 @@
+package cmdconfig
+
+import (
+	"testing"
+)
+
+func TestFormatSource(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "spacing and quotes",
+			input: "  name   'John'   \"Brown\"  \n",
+			want:  "name John Brown\n",
+		},
+		{
+			name:  "needed quotes kept",
+			input: "msg 'hello world' `a\"b` a\\ b\n",
+			want:  "msg \"hello world\" \"a\\\"b\" \"a b\"\n",
+		},
+		{
+			name:  "blank lines collapsed",
+			input: "\n\n\na 1\n\n\n\nb 2\n\n\n",
+			want:  "a 1\n\nb 2\n",
+		},
+		{
+			name:  "comments kept",
+			input: "# header\n\n   # about a\na 1   # trailing   \n# footer\n",
+			want:  "# header\n\n# about a\na 1 # trailing\n# footer\n",
+		},
+		{
+			name: "nested blocks re-indented",
+			input: `server web01 {
+host a
+        location /api {
+  proxy_pass b   # pass
+    # end of location
+}
+
+} # server
+`,
+			want: `server web01 {
+    host a
+    location /api {
+        proxy_pass b # pass
+        # end of location
+    }
+} # server
+`,
+		},
+		{
+			name:  "one line blocks split",
+			input: "a { b 1 } c { d { e } }\n",
+			want:  "a {\n    b 1\n}\nc {\n    d {\n        e\n    }\n}\n",
+		},
+		{
+			name:  "empty blocks",
+			input: "a {}\nb {\n\n}\nc { # only a comment\n}\n",
+			want:  "a {}\nb {}\nc {\n    # only a comment\n}\n",
+		},
+		{
+			name:  "escaped braces in nested arguments",
+			input: "a {\n  b \"x\\\\\\{y\"\n}\n",
+			want:  "a {\n    b \"x\\\\\\{y\"\n}\n",
+		},
+		{
+			name:  "braces in comments",
+			input: "x {\n  # } note\n  y { # {\n  }\n}\n",
+			want:  "x {\n    # } note\n    y {\n        # {\n    }\n}\n",
+		},
+		{
+			name:  "blank line after a leading comment kept",
+			input: "# Copyright header\n\nport 80\nx {\n  # section\n\n  b 1\n}\n",
+			want:  "# Copyright header\n\nport 80\nx {\n    # section\n\n    b 1\n}\n",
+		},
+		{
+			name:  "heredoc marker as a value",
+			input: "cmd \"<<EOF\"\nnext 1\n",
+			want:  "cmd \"<<EOF\"\nnext 1\n",
+		},
+		{
+			name:  "semicolons",
+			input: "a 'x;y' b;c\nd 1; e 2\n",
+			want:  "a \"x;y\" b;c\nd 1; e 2\n",
+		},
+		{
+			name:  "quoted '#' in a body",
+			input: "x { echo 'hi #1' }\ny 1\n",
+			want:  "x {\n    echo \"hi #1\"\n}\ny 1\n",
+		},
+		{
+			name:  "invalid body kept as written",
+			input: "script {\n      echo 'unbalanced\n  }\n",
+			want:  "script {\n      echo 'unbalanced\n  }\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := FormatSource([]byte(tc.input), "    ")
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if string(got) != tc.want {
+				t.Fatalf("expected:\n%q\ngot:\n%q", tc.want, got)
+			}
+
+			// formatting is idempotent
+			again, err := FormatSource(got, "    ")
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if string(again) != string(got) {
+				t.Errorf("not idempotent:\n%q\n%q", got, again)
+			}
+		})
+	}
+}
+
+func TestFormatSourceError(t *testing.T) {
+	if _, err := FormatSource([]byte("a 'unclosed"), "  "); err == nil {
+		t.Errorf("expected error")
+	}
+}
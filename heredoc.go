@@ -0,0 +1,150 @@
+package cmdconfig
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ensure reports if at least n bytes are unread, reading more from the
+// underlying reader if needed
+func (s *Scanner) ensure(n int) bool {
+	for len(s.s)-s.pos < n {
+		if s.r == nil || s.err != nil {
+			return false
+		}
+		s.fill()
+	}
+	return true
+}
+
+// heredocLen returns the length of the heredoc marker <<NAME or <<-NAME
+// at the current position, or 0 if there is none. The marker must be a
+// whole word.
+func (s *Scanner) heredocLen() int {
+	if !s.ensure(3) || s.s[s.pos] != '<' || s.s[s.pos+1] != '<' {
+		return 0
+	}
+	n := 2
+	if s.s[s.pos+n] == '-' {
+		n++
+	}
+	start := n
+	for s.ensure(n+1) && isWordChar(s.s[s.pos+n]) {
+		n++
+	}
+	if !isVarName(string(s.s[s.pos+start : s.pos+n])) {
+		return 0
+	}
+	if s.ensure(n + 1) {
+		if b := s.s[s.pos+n]; !isSpace(b) && !isNewLine(b) && !isComment(b) && b != '\r' {
+			return 0
+		}
+	}
+	return n
+}
+
+// parseHeredoc reads a heredoc starting at its marker:
+//
+//	<<EOF
+//	text
+//	EOF
+//
+// The body is every line up to the one holding only the delimiter, taken
+// literally, without the newline before the delimiter. With <<-EOF the
+// delimiter may be indented and the indentation common to all lines is
+// removed. Like parseBrace it returns the body with a map from each byte
+// to its position, the last entry being the start of the delimiter line.
+func (s *Scanner) parseHeredoc() (delim string, body string, posMap []Position, err error) {
+	start := s.CurrentPos()
+	n := s.heredocLen()
+	marker := string(s.s[s.pos : s.pos+n])
+	strip := marker[2] == '-'
+	delim = strings.TrimLeft(marker, "<-")
+	for i := 0; i < n; i++ {
+		s.advance()
+	}
+
+	// only a comment can follow the marker
+	for s.more() && (isSpace(s.s[s.pos]) || s.s[s.pos] == '\r') {
+		s.advance()
+	}
+	if s.more() && isComment(s.s[s.pos]) {
+		s.skipComment()
+	}
+	if !s.more() {
+		return delim, "", nil, s.unterminated(start, fmt.Sprintf("got EOF in heredoc, expected %s", delim))
+	}
+	if !isNewLine(s.s[s.pos]) {
+		return delim, "", nil, s.errorAt("unexpected text after heredoc marker")
+	}
+	s.advance()
+
+	var out []byte
+	for s.more() {
+		lineStart, line, column := s.pos, s.line, s.column
+		end := s.CurrentPos()
+		for s.more() && !isNewLine(s.s[s.pos]) {
+			s.advance()
+		}
+		text := strings.TrimSuffix(string(s.s[lineStart:s.pos]), "\r")
+		if text == delim || (strip && strings.TrimLeft(text, " \t") == delim) {
+			if len(out) > 0 {
+				// the newline before the delimiter is not part of the body
+				out, posMap = out[:len(out)-1], posMap[:len(posMap)-1]
+			}
+			posMap = append(posMap, end)
+			body = string(out)
+			if strip {
+				lines := strings.Split(body, "\n")
+				body, posMap = stripIndent(lines, commonIndent(lines), posMap)
+			}
+			return delim, body, posMap, nil
+		}
+
+		// copy the line, recording positions as we go
+		s.pos, s.line, s.column = lineStart, line, column
+		for s.more() && !isNewLine(s.s[s.pos]) {
+			out = append(out, s.s[s.pos])
+			posMap = append(posMap, s.CurrentPos())
+			s.advance()
+		}
+		if !s.more() {
+			break
+		}
+		out = append(out, '\n')
+		posMap = append(posMap, s.CurrentPos())
+		s.advance()
+	}
+	return delim, "", nil, s.unterminated(start, fmt.Sprintf("got EOF in heredoc, expected %s", delim))
+}
+
+// heredocDelim returns a delimiter for body, EOF unless a line of body
+// is EOF
+func heredocDelim(body string) string {
+	lines := strings.Split(body, "\n")
+	for i := 0; ; i++ {
+		delim := "EOF"
+		if i > 0 {
+			delim = fmt.Sprintf("EOF%d", i)
+		}
+		found := false
+		for _, line := range lines {
+			if strings.TrimSpace(line) == delim {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return delim
+		}
+	}
+}
+
+// formatHeredoc returns body as a heredoc, starting with the marker
+func formatHeredoc(body string) string {
+	delim := heredocDelim(body)
+	if body == "" {
+		return "<<" + delim + "\n" + delim
+	}
+	return "<<" + delim + "\n" + body + "\n" + delim
+}
@@ -0,0 +1,162 @@
+package cmdconfig
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestHeredoc(t *testing.T) {
+	tests := []struct {
+		input string
+		args  []string
+		body  string
+	}{
+		{"sql <<EOF\nSELECT '{' FROM t;\n  \\n }\nEOF\n", []string{"sql"}, "SELECT '{' FROM t;\n  \\n }"},
+		{"a b <<END # comment\nx\nEND", []string{"a", "b"}, "x"},
+		{"empty <<EOF\nEOF\n", []string{"empty"}, ""},
+		{"blank <<EOF\n\nEOF\n", []string{"blank"}, ""},
+		{"nl <<EOF\nx\n\nEOF\n", []string{"nl"}, "x\n"},
+		{"tab <<-EOF\n    if x {\n      y\n    }\n    EOF\n", []string{"tab"}, "if x {\n  y\n}"},
+		{"single <<-EOF\n\tone\n\tEOF", []string{"single"}, "one"},
+		{"notdelim <<EOF\n EOF\nEOFX\nEOF\n", []string{"notdelim"}, " EOF\nEOFX"},
+		{"crlf <<EOF\r\nx\r\nEOF\r\n", []string{"crlf"}, "x\r"},
+		{"word <<EOF-x <<1", []string{"word", "<<EOF-x", "<<1"}, ""},
+		{"word a<<EOF <<", []string{"word", "a<<EOF", "<<"}, ""},
+	}
+	for i, tc := range tests {
+		s := NewScanner([]byte(tc.input))
+		args, body, err := s.Next()
+		if err != nil {
+			t.Errorf("case %d: got error %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(args, tc.args) || body != tc.body {
+			t.Errorf("case %d: expected %q %q got %q %q", i, tc.args, tc.body, args, body)
+		}
+	}
+}
+
+func TestHeredocCommand(t *testing.T) {
+	input := "script <<-EOF\n    echo }\n    EOF\nnext 1\n"
+	s := NewScanner([]byte(input))
+	cmd, err := s.NextCommand()
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if cmd.Heredoc != "EOF" || !cmd.HasBody() || cmd.Body != "echo }" {
+		t.Errorf("got %+v", cmd)
+	}
+	if cmd.BodyStart != (Position{Line: 1, Column: 8, Offset: 7}) || cmd.BodyEnd != (Position{Line: 3, Column: 8, Offset: 32}) {
+		t.Errorf("got body positions %v %v", cmd.BodyStart, cmd.BodyEnd)
+	}
+	// the body maps back to the input
+	if got := cmd.bodyMap[0]; got != (Position{Line: 2, Column: 5, Offset: 18}) {
+		t.Errorf("got %v", got)
+	}
+	cmd, err = s.NextCommand()
+	if err != nil || cmd.Name() != "next" {
+		t.Errorf("got %v %v", cmd, err)
+	}
+}
+
+func TestHeredocErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"a <<EOF\nx\n", "got EOF in heredoc, expected EOF at line 3, column 1"},
+		{"a <<EOF", "got EOF in heredoc, expected EOF at line 1, column 8"},
+		{"a <<EOF x\nEOF", "unexpected text after heredoc marker at line 1, column 9"},
+		{"a {\n b <<EOF\n}\n", "got EOF in heredoc, expected EOF at line 4, column 1"},
+	}
+	for i, tc := range tests {
+		_, _, err := NewScanner([]byte(tc.input)).Next()
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("case %d: expected %q got %v", i, tc.want, err)
+		}
+	}
+}
+
+func TestHeredocInBlock(t *testing.T) {
+	input := "server {\n    script <<EOF\n}{ \\{\nEOF\n    port 80\n}\n"
+	doc, err := Parse([]byte(input))
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	script := doc.Child("server").Child("script")
+	if script == nil || !script.Raw || script.Body != "}{ \\{" {
+		t.Fatalf("got %+v", script)
+	}
+	if port := doc.Child("server").Child("port"); port == nil || port.Pos.Line != 5 {
+		t.Errorf("got %+v", port)
+	}
+
+	// written back as a heredoc at any depth
+	out := doc.Format("  ")
+	want := "server {\n  script <<EOF\n}{ \\{\nEOF\n  port 80\n}\n"
+	if out != want {
+		t.Errorf("expected %q got %q", want, out)
+	}
+}
+
+func TestFormatIndentHeredoc(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{"a {\n}", "x {\n  a {\n  }\n}"},
+		{"if (x) {", "x <<EOF\nif (x) {\nEOF"},
+		{"EOF\n}", "x <<EOF1\nEOF\n}\nEOF1"},
+		{"a \\{", "x <<EOF\na \\{\nEOF"},
+	}
+	for i, tc := range tests {
+		got := FormatIndent([]string{"x"}, tc.body, "  ")
+		if got != tc.want {
+			t.Errorf("case %d: expected %q got %q", i, tc.want, got)
+		}
+		args, body, err := NewScanner([]byte(got)).Next()
+		if err != nil || args[0] != "x" || (strings.HasPrefix(tc.want, "x <<") && body != tc.body) {
+			t.Errorf("case %d: read back %q %q %v", i, args, body, err)
+		}
+	}
+}
+
+func TestSyntaxHeredoc(t *testing.T) {
+	input := "a   1 <<EOF # c\n  x  {\nEOF\n\n\nb {\n  sql <<-END\n    }\n    END\n}   # after\n"
+	tree, err := ParseSyntax([]byte(input))
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if got := tree.String(); got != input {
+		t.Errorf("round trip: expected %q got %q", input, got)
+	}
+	if blk := tree.Find("a").Block; !blk.IsHeredoc() || blk.Raw != "  x  {\n" || blk.Close != "EOF" {
+		t.Errorf("got %+v", blk)
+	}
+	want := "a 1 <<EOF # c\n  x  {\nEOF\n\nb {\n  sql <<-END\n    }\n    END\n} # after\n"
+	if got := string(tree.Format("  ")); got != want {
+		t.Errorf("format: expected %q got %q", want, got)
+	}
+}
+
+func TestHeredocReader(t *testing.T) {
+	input := "a <<EOF\n{\nEOF\nb <<-EOF\n  x\n  EOF"
+	s := NewReaderScanner(iotest.OneByteReader(strings.NewReader(input)))
+	var got []string
+	for {
+		args, body, err := s.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("got error %v", err)
+		}
+		got = append(got, args[0], body)
+	}
+	if want := []string{"a", "{", "b", "x"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q got %q", want, got)
+	}
+}
@@ -0,0 +1,106 @@
+package cmdconfig
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// Load parses the file name in fsys into a Document using the default
+// Parser, expanding include commands. See Parser.Load.
+func Load(fsys fs.FS, name string) (*Document, error) {
+	p := Parser{}
+	return p.Load(fsys, name)
+}
+
+// Load parses the file name in fsys into a Document. Each command
+//
+//	include path...
+//
+// is replaced by the commands of the files it names, at any depth. Paths
+// are relative to the directory of the including file and may be glob
+// patterns, in which case matching files are included in lexical order and
+// no match is not an error. Include cycles are reported as errors.
+//
+// Positions of every node and error carry the name of the file they came
+// from. Since fsys can be an embed.FS or fstest.MapFS as well as os.DirFS,
+// names always use forward slashes.
+func (p *Parser) Load(fsys fs.FS, name string) (*Document, error) {
+	l := &loader{p: p, fsys: fsys}
+	if p.MaxErrors != 0 {
+		l.errs, l.maxErrors = &ErrorList{}, p.MaxErrors
+	}
+	children, err := l.load(name, Position{}, l.scope())
+	if err != nil {
+		return nil, err
+	}
+	doc := &Document{Children: children}
+	if l.errs != nil && len(*l.errs) > 0 {
+		l.errs.Sort()
+		return doc, *l.errs
+	}
+	return doc, nil
+}
+
+// load parses a single file, pos is the include argument that named it
+// and sc the variables in scope there
+func (l *loader) load(name string, pos Position, sc *scope) ([]*Node, error) {
+	for i, f := range l.stack {
+		if f == name {
+			chain := strings.Join(l.stack[i:], " -> ")
+			return nil, errorf(pos, "include cycle: %s -> %s", chain, name)
+		}
+	}
+	data, err := fs.ReadFile(l.fsys, name)
+	if err != nil {
+		if pos.Line == 0 {
+			return nil, err
+		}
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			err = pathErr.Err
+		}
+		return nil, errorf(pos, "include %s: %v", name, err)
+	}
+
+	l.stack = append(l.stack, name)
+	defer func() { l.stack = l.stack[:len(l.stack)-1] }()
+
+	s := NewScannerFile(name, data)
+	s.errs, s.maxErrors = l.errs, l.maxErrors
+	return l.parse(s, sc)
+}
+
+// include returns the commands of every file named by cmd, up to the
+// first error
+func (l *loader) include(cmd *Command, sc *scope) ([]*Node, error) {
+	if len(cmd.Args) < 2 {
+		return nil, errorf(cmd.Pos, "include requires a file name")
+	}
+	if cmd.HasBody() {
+		return nil, errorf(cmd.BodyStart, "include does not take a body")
+	}
+	dir := path.Dir(cmd.Pos.Filename)
+
+	nodes := []*Node{}
+	for i, arg := range cmd.Args[1:] {
+		pos := cmd.ArgPos[i+1]
+		name := path.Join(dir, arg)
+		names := []string{name}
+		if strings.ContainsAny(arg, "*?[") {
+			var err error
+			if names, err = fs.Glob(l.fsys, name); err != nil {
+				return nil, errorf(pos, "include %s: %v", arg, err)
+			}
+		}
+		for _, name := range names {
+			children, err := l.load(name, pos, sc)
+			if err != nil {
+				return nodes, err
+			}
+			nodes = append(nodes, children...)
+		}
+	}
+	return nodes, nil
+}
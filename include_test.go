@@ -0,0 +1,101 @@
+package cmdconfig
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.conf":            {Data: []byte("port 80\ninclude conf.d/*.conf\nserver web {\n  include extra/web.conf\n}\n")},
+		"conf.d/b.conf":        {Data: []byte("b 2\n")},
+		"conf.d/a.conf":        {Data: []byte("a 1\ninclude more.inc\n")},
+		"conf.d/more.inc":      {Data: []byte("more 3\ninclude ../extra/*.inc\n")},
+		"extra/last.inc":       {Data: []byte("last 4\n")},
+		"conf.d/ignored.conf~": {Data: []byte("bad {\n")},
+		"extra/web.conf":       {Data: []byte("\n  host example.com\n")},
+	}
+	doc, err := Load(fsys, "main.conf")
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+
+	got := doc.Format(" ")
+	want := "port 80\na 1\nmore 3\nlast 4\nb 2\nserver web {\n host example.com\n}\n"
+	if got != want {
+		t.Errorf("expected %q got %q", want, got)
+	}
+
+	tests := []struct {
+		node *Node
+		want string
+	}{
+		{doc.Child("port"), "main.conf:1:1"},
+		{doc.Child("a"), "conf.d/a.conf:1:1"},
+		{doc.Child("more"), "conf.d/more.inc:1:1"},
+		{doc.Child("server").Child("host"), "extra/web.conf:2:3"},
+	}
+	for i, tc := range tests {
+		if got := tc.node.Pos.String(); got != tc.want {
+			t.Errorf("case %d: expected %q got %q", i, tc.want, got)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	fsys := fstest.MapFS{
+		"cycle.conf":   {Data: []byte("include a.conf\n")},
+		"a.conf":       {Data: []byte("x 1\ninclude b.conf\n")},
+		"b.conf":       {Data: []byte("include a.conf\n")},
+		"missing.conf": {Data: []byte("include nope.conf\n")},
+		"syntax.conf":  {Data: []byte("include bad.conf\n")},
+		"bad.conf":     {Data: []byte("ok 1\nbad {\n")},
+		"noname.conf":  {Data: []byte("include\n")},
+		"empty.conf":   {Data: []byte("include none/*.conf\n")},
+	}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"cycle.conf", "b.conf:1:9: include cycle: a.conf -> b.conf -> a.conf"},
+		{"missing.conf", "missing.conf:1:9: include nope.conf: file does not exist"},
+		{"syntax.conf", "bad.conf:3:1: got EOF in opening brace"},
+		{"noname.conf", "noname.conf:1:1: include requires a file name"},
+		{"empty.conf", ""},
+	}
+	for _, tc := range tests {
+		_, err := Load(fsys, tc.name)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tc.want {
+			t.Errorf("%s: expected %q got %q", tc.name, tc.want, got)
+		}
+	}
+
+	if _, err := Load(fsys, "nothere.conf"); err == nil {
+		t.Errorf("expected error for a missing top level file")
+	}
+}
+
+func TestLoadRecover(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.conf": {Data: []byte("include a.conf missing.conf\nlast 1\n")},
+		"a.conf":    {Data: []byte("a 1\n'bad\nb 2\n")},
+	}
+	p := Parser{MaxErrors: -1}
+	doc, err := p.Load(fsys, "main.conf")
+	var list ErrorList
+	if !errors.As(err, &list) || len(list) != 2 {
+		t.Fatalf("expected 2 errors got %v", err)
+	}
+	if list[0].Pos.Filename != "a.conf" || !strings.HasPrefix(list[1].Msg, "include missing.conf") {
+		t.Errorf("got %v", list)
+	}
+	if got := doc.Format(" "); got != "a 1\nb 2\nlast 1\n" {
+		t.Errorf("got %q", got)
+	}
+}
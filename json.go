@@ -0,0 +1,304 @@
+package cmdconfig
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// jsonNode is the canonical JSON form of a Node:
+//
+//	{"args": ["server", "web"], "children": [{"args": ["listen", "80"]}]}
+//	{"args": ["script"], "body": "echo hi\n"}
+//	{"args": ["query"], "body": "SELECT 1", "heredoc": "EOF"}
+//
+// A command without a body has only args. An empty block has an empty
+// children array. Raw bodies, including heredocs, are a body string.
+type jsonNode struct {
+	Args     []string `json:"args"`
+	Children *[]*Node `json:"children,omitempty"`
+	Body     *string  `json:"body,omitempty"`
+	Heredoc  string   `json:"heredoc,omitempty"`
+}
+
+// MarshalJSON returns the document as an array of nodes in order, see
+// Node.MarshalJSON
+func (d *Document) MarshalJSON() ([]byte, error) {
+	if d.Children == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(d.Children)
+}
+
+// UnmarshalJSON reads a document written by MarshalJSON
+func (d *Document) UnmarshalJSON(data []byte) error {
+	var children []*Node
+	if err := json.Unmarshal(data, &children); err != nil {
+		return err
+	}
+	d.Children = children
+	return nil
+}
+
+// MarshalJSON returns the node as an object with its args, and children
+// or a raw body if it has one:
+//
+//	{"args": ["server", "web"], "children": [{"args": ["listen", "80"]}]}
+//	{"args": ["script"], "body": "echo hi\n"}
+//	{"args": ["query"], "body": "SELECT 1", "heredoc": "EOF"}
+//
+// Positions are not included. Formatting a node read back from JSON gives
+// the same output as the original.
+func (n *Node) MarshalJSON() ([]byte, error) {
+	j := jsonNode{Args: n.Args, Heredoc: n.Heredoc}
+	if j.Args == nil {
+		j.Args = []string{}
+	}
+	switch {
+	case n.Raw:
+		j.Body = &n.Body
+	case n.HasBody():
+		children := n.Children
+		if children == nil {
+			children = []*Node{}
+		}
+		j.Children = &children
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON reads a node written by MarshalJSON
+func (n *Node) UnmarshalJSON(data []byte) error {
+	var j jsonNode
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	if j.Args == nil {
+		return errors.New("cmdconfig: node without args")
+	}
+	if j.Children != nil && j.Body != nil {
+		return fmt.Errorf("cmdconfig: node %s has both children and a body", strings.Join(j.Args, " "))
+	}
+	if j.Heredoc != "" && j.Body == nil {
+		return fmt.Errorf("cmdconfig: heredoc node %s without a body", strings.Join(j.Args, " "))
+	}
+	*n = Node{Command: Command{Args: j.Args, Heredoc: j.Heredoc}}
+	switch {
+	case j.Body != nil:
+		n.Body, n.Raw = *j.Body, true
+	case j.Children != nil:
+		n.Children = *j.Children
+		if n.Children == nil {
+			n.Children = []*Node{}
+		}
+	}
+	return nil
+}
+
+// Map returns the document keyed by directive name, for tools that expect
+// JSON objects rather than ordered commands:
+//
+//	port 8080                   {"port": "8080",
+//	allow a b                    "allow": ["a", "b"],
+//	server web { tls on }        "server": {"web": {"tls": "on"}},
+//	script { echo hi }           "script": "echo hi"}
+//
+// A command without a body maps to its argument, or an array of them if it
+// has none or several. A block maps to an object of its children, nested
+// under its arguments, and a raw body maps to its text. If a name is used
+// more than once in a block, objects are merged and other values collected
+// into an array in order.
+//
+// The mapping loses the order of different directives and cannot be read
+// back. Use MarshalJSON for a lossless form.
+func (d *Document) Map() map[string]any {
+	return mapNodes(d.Children)
+}
+
+// mapNodes returns the key-based mapping of nodes, see Document.Map
+func mapNodes(nodes []*Node) map[string]any {
+	out := map[string]any{}
+	for _, n := range nodes {
+		if len(n.Args) == 0 {
+			continue
+		}
+		var v any
+		switch {
+		case n.Raw:
+			v = strings.TrimSpace(n.Body)
+		case n.HasBody():
+			v = mapNodes(n.Children)
+		case len(n.Args) == 2:
+			v = n.Args[1]
+		default:
+			v = append([]string{}, n.Args[1:]...)
+		}
+		if n.HasBody() {
+			// labels become nested keys, innermost last
+			for i := len(n.Args) - 1; i > 0; i-- {
+				v = map[string]any{n.Args[i]: v}
+			}
+		}
+		out[n.Args[0]] = mergeValue(out[n.Args[0]], v)
+	}
+	return out
+}
+
+// mergeValue combines the values of a name used more than once. Repeated
+// values are collected in a []any, distinct from the []string of an
+// argument list.
+func mergeValue(old, v any) any {
+	if old == nil {
+		return v
+	}
+	oldMap, ok1 := old.(map[string]any)
+	newMap, ok2 := v.(map[string]any)
+	if ok1 && ok2 {
+		for k, nv := range newMap {
+			oldMap[k] = mergeValue(oldMap[k], nv)
+		}
+		return oldMap
+	}
+	if list, ok := old.([]any); ok {
+		return append(list, v)
+	}
+	return []any{old, v}
+}
+
+// JSONSchema returns a JSON Schema (draft 2020-12) for the canonical JSON
+// form of documents the schema allows, as written by Document.MarshalJSON.
+//
+// Argument types, enums and patterns are checked with regular expressions
+// and formats. Ranges can not be expressed on strings and are only checked
+// by Validate.
+func (s *Schema) JSONSchema() ([]byte, error) {
+	root := s.jsonSchema()
+	root["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	return json.MarshalIndent(root, "", "  ")
+}
+
+// jsonSchema returns the JSON Schema for an array of nodes
+func (s *Schema) jsonSchema() map[string]any {
+	items := []any{}
+	var all []any
+	for _, d := range s.Directives {
+		items = append(items, d.jsonSchema())
+		name := map[string]any{
+			"properties": map[string]any{
+				"args": map[string]any{"prefixItems": []any{map[string]any{"const": d.Name}}},
+			},
+			"required": []string{"args"},
+		}
+		switch {
+		case d.Required && !d.Repeatable:
+			all = append(all, map[string]any{"contains": name, "minContains": 1, "maxContains": 1})
+		case d.Required:
+			all = append(all, map[string]any{"contains": name})
+		case !d.Repeatable:
+			all = append(all, map[string]any{"contains": name, "minContains": 0, "maxContains": 1})
+		}
+	}
+	out := map[string]any{
+		"type":  "array",
+		"items": map[string]any{"oneOf": items},
+	}
+	if len(all) > 0 {
+		out["allOf"] = all
+	}
+	return out
+}
+
+// jsonSchema returns the JSON Schema for a single node
+func (d *Directive) jsonSchema() map[string]any {
+	minArgs, maxArgs := d.argCount()
+	prefix := []any{map[string]any{"const": d.Name}}
+	for _, a := range d.Args {
+		prefix = append(prefix, a.jsonSchema())
+	}
+	args := map[string]any{
+		"type":        "array",
+		"prefixItems": prefix,
+		"minItems":    minArgs + 1,
+	}
+	if maxArgs >= 0 {
+		args["maxItems"] = maxArgs + 1
+	}
+	if len(d.Args) > 0 {
+		// arguments past the end of Args use the last one
+		args["items"] = d.Args[len(d.Args)-1].jsonSchema()
+	} else {
+		args["items"] = map[string]any{"type": "string"}
+	}
+
+	children := map[string]any{"type": "array"}
+	if d.Block != nil {
+		children = d.Block.jsonSchema()
+	}
+	props := map[string]any{
+		"args":     args,
+		"children": children,
+		"body":     map[string]any{"type": "string"},
+		"heredoc":  map[string]any{"type": "string"},
+	}
+	out := map[string]any{
+		"type":                 "object",
+		"properties":           props,
+		"required":             []string{"args"},
+		"additionalProperties": false,
+	}
+	switch d.Body {
+	case BodyRequired:
+		out["anyOf"] = []any{
+			map[string]any{"required": []string{"children"}},
+			map[string]any{"required": []string{"body"}},
+		}
+	case BodyForbidden:
+		delete(props, "children")
+		delete(props, "body")
+		delete(props, "heredoc")
+	}
+	return out
+}
+
+// jsonPatterns are regular expressions for argument types, matching what
+// the Command accessors accept
+var jsonPatterns = map[ArgType]string{
+	TypeInt:      `^[+-]?(?:0[xX][0-9a-fA-F_]+|0[oO]?[0-7_]+|0[bB][01_]+|[0-9_]+)$`,
+	TypeUint16:   `^(?:0[xX][0-9a-fA-F_]+|0[oO]?[0-7_]+|0[bB][01_]+|[0-9_]+)$`,
+	TypeBool:     `^(?:[oO][nN]|[oO][fF][fF]|[yY][eE][sS]|[nN][oO]|[tT][rR][uU][eE]|[fF][aA][lL][sS][eE])$`,
+	TypeFloat:    `^[+-]?(?:(?:[0-9]+\.?[0-9]*|\.[0-9]+)(?:[eE][+-]?[0-9]+)?|[iI][nN][fF](?:[iI][nN][iI][tT][yY])?|[nN][aA][nN])$`,
+	TypeDuration: `^[+-]?(?:0|(?:(?:[0-9]+\.?[0-9]*|\.[0-9]+)(?:ns|us|µs|μs|ms|s|m|h))+)$`,
+	TypeBytes:    `^(?:[0-9]+\.?[0-9]*|\.[0-9]+)(?:[eE][+-]?[0-9]+)?(?:[bB]|[kKmMgGtT](?:[iI]?[bB])?)?$`,
+	TypeCIDR:     `^[0-9a-fA-F:.]+/[0-9]+$`,
+}
+
+// jsonSchema returns the JSON Schema for a single argument
+func (a *Arg) jsonSchema() map[string]any {
+	out := map[string]any{"type": "string"}
+	if p, ok := jsonPatterns[a.Type]; ok {
+		out["pattern"] = p
+	}
+	switch a.Type {
+	case TypeURL:
+		out["format"] = "uri"
+	case TypeIP:
+		out["anyOf"] = []any{
+			map[string]any{"format": "ipv4"},
+			map[string]any{"format": "ipv6"},
+		}
+	}
+	if len(a.Enum) > 0 {
+		out["enum"] = a.Enum
+	}
+	if a.Pattern != "" {
+		pattern := "^(?:" + a.Pattern + ")$"
+		if _, ok := out["pattern"]; ok {
+			// the type pattern must match as well
+			out["allOf"] = []any{map[string]any{"pattern": pattern}}
+		} else {
+			out["pattern"] = pattern
+		}
+	}
+	return out
+}
@@ -0,0 +1,139 @@
+package cmdconfig
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	input := "port 8080\nserver web {\n    listen 80 443\n    empty {}\n}\nquery <<EOF\nSELECT '{'\nEOF\nscript {\n    echo \\}\n}\n'a b' \"c;d\"\n"
+	p := Parser{Raw: func(args []string) bool { return args[0] == "script" }}
+	doc, err := p.Parse([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"args":["port","8080"]},` +
+		`{"args":["server","web"],"children":[{"args":["listen","80","443"]},{"args":["empty"],"children":[]}]},` +
+		`{"args":["query"],"body":"SELECT '{'","heredoc":"EOF"},` +
+		`{"args":["script"],"body":"\necho }\n"},` +
+		`{"args":["a b","c;d"]}]`
+	if string(out) != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, out)
+	}
+
+	var back Document
+	if err := json.Unmarshal(out, &back); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := back.Format("    "), doc.Format("    "); got != want {
+		t.Errorf("round trip expected\n%s\ngot\n%s", want, got)
+	}
+	if got, want := back.FormatCompact(), doc.FormatCompact(); got != want {
+		t.Errorf("compact round trip expected %q got %q", want, got)
+	}
+}
+
+func TestJSONErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`{}`, "json: cannot unmarshal object into Go value of type []*cmdconfig.Node"},
+		{`[{}]`, "cmdconfig: node without args"},
+		{`[{"args":["a"],"children":[],"body":"x"}]`, "cmdconfig: node a has both children and a body"},
+		{`[{"args":["a"],"heredoc":"EOF"}]`, "cmdconfig: heredoc node a without a body"},
+	}
+	for i, tc := range tests {
+		var doc Document
+		err := json.Unmarshal([]byte(tc.input), &doc)
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("case %d: expected %q got %v", i, tc.want, err)
+		}
+	}
+}
+
+func TestMap(t *testing.T) {
+	input := "port 8080\nallow a b\nflag\nserver web {\n    tls on\n}\nserver api {\n    tls off\n}\nhost a\nhost b\nscript <<EOF\necho hi\nEOF\n"
+	doc, err := Parse([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := json.Marshal(doc.Map())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"allow":["a","b"],"flag":[],"host":["a","b"],"port":"8080","script":"echo hi",` +
+		`"server":{"api":{"tls":"off"},"web":{"tls":"on"}}}`
+	if string(out) != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, out)
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	schema, err := ParseSchema([]byte(testSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := schema.JSONSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v map[string]any
+	if err := json.Unmarshal(out, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v["$schema"] != "https://json-schema.org/draft/2020-12/schema" || v["type"] != "array" {
+		t.Errorf("unexpected root %v", v)
+	}
+	items := v["items"].(map[string]any)["oneOf"].([]any)
+	if len(items) != len(schema.Directives) {
+		t.Fatalf("expected %d directives got %d", len(schema.Directives), len(items))
+	}
+	port := items[0].(map[string]any)["properties"].(map[string]any)["args"].(map[string]any)
+	if !reflect.DeepEqual(port["prefixItems"].([]any)[0], map[string]any{"const": "port"}) || port["maxItems"] != 2.0 {
+		t.Errorf("unexpected port args %v", port)
+	}
+	if !strings.Contains(string(out), `"enum": [`) {
+		t.Errorf("expected an enum in %s", out)
+	}
+}
+
+func TestJSONPatterns(t *testing.T) {
+	tests := []struct {
+		typ   ArgType
+		valid []string
+	}{
+		{TypeInt, []string{"42", "-1", "0x2A", "0o17", "0b101", "1_000"}},
+		{TypeUint16, []string{"80", "0xffff"}},
+		{TypeBool, []string{"on", "OFF", "Yes", "no", "true", "False"}},
+		{TypeFloat, []string{"1", "1.5", ".5", "1e3", "-2.5E-3", "Inf", "NaN"}},
+		{TypeDuration, []string{"0", "1m30s", "1.5h", "300ms", "-2s"}},
+		{TypeBytes, []string{"512", "10MB", "1.5GiB", "4k", "1b"}},
+		{TypeCIDR, []string{"10.0.0.0/8", "::1/128"}},
+	}
+	for _, tc := range tests {
+		re := regexp.MustCompile(jsonPatterns[tc.typ])
+		c := &Command{Args: []string{"x", ""}, ArgPos: make([]Position, 2)}
+		a := &Arg{Type: tc.typ}
+		for _, s := range tc.valid {
+			c.Args[1] = s
+			if _, _, err := a.parse(c, 1); err != nil {
+				t.Errorf("%s %q: accessor error %v", tc.typ, s, err)
+			}
+			if !re.MatchString(s) {
+				t.Errorf("%s %q: does not match pattern", tc.typ, s)
+			}
+		}
+		if re.MatchString("x y") {
+			t.Errorf("%s: pattern matches %q", tc.typ, "x y")
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package cmdconfig
+
+import (
+	"io"
+	"strconv"
+	"strings"
+)
+
+// TokenKind is the kind of a Token
+type TokenKind int
+
+const (
+	TokenBareword         TokenKind = iota // unquoted text
+	TokenSingleQuoted                      // 'text'
+	TokenDoubleQuoted                      // "text"
+	TokenBackQuoted                        // `text`, always an argument on its own
+	TokenEscape                            // a backslash and the character it escapes, e.g. \n
+	TokenLineContinuation                  // a backslash before a newline
+	TokenLBrace                            // the '{' opening a body
+	TokenBody                              // the text between the braces
+	TokenRBrace                            // the '}' closing a body
+	TokenHeredoc                           // a heredoc from its marker to the end of its delimiter line
+	TokenNewline                           // '\n'
+	TokenSemicolon                         // a ';' ending a command, see Lexer.Semicolons
+	TokenComment                           // '#' to the end of the line
+	TokenWhitespace                        // spaces, tabs and control characters between words
+)
+
+var tokenNames = [...]string{
+	TokenBareword:         "TokenBareword",
+	TokenSingleQuoted:     "TokenSingleQuoted",
+	TokenDoubleQuoted:     "TokenDoubleQuoted",
+	TokenBackQuoted:       "TokenBackQuoted",
+	TokenEscape:           "TokenEscape",
+	TokenLineContinuation: "TokenLineContinuation",
+	TokenLBrace:           "TokenLBrace",
+	TokenBody:             "TokenBody",
+	TokenRBrace:           "TokenRBrace",
+	TokenHeredoc:          "TokenHeredoc",
+	TokenNewline:          "TokenNewline",
+	TokenSemicolon:        "TokenSemicolon",
+	TokenComment:          "TokenComment",
+	TokenWhitespace:       "TokenWhitespace",
+}
+
+func (k TokenKind) String() string {
+	if k >= 0 && int(k) < len(tokenNames) {
+		return tokenNames[k]
+	}
+	return "TokenKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// isWord reports if a token of kind k is part of an argument. Adjacent
+// word tokens, with line continuations between them, form one argument.
+func (k TokenKind) isWord() bool {
+	return k == TokenBareword || k == TokenSingleQuoted || k == TokenDoubleQuoted || k == TokenEscape
+}
+
+// Token is a single token of the input
+type Token struct {
+	Kind TokenKind
+
+	// Raw is the token as written, including quotes and backslashes.
+	// For a TokenBody it is the text between the braces.
+	Raw string
+
+	// Value is the token as Scanner.Next sees it: quotes removed, escapes
+	// resolved and variables expanded. For a TokenBody or TokenHeredoc it is the
+	// body, dedented and with brace escapes resolved. For a
+	// TokenLineContinuation it is empty and for other kinds it is Raw.
+	Value string
+
+	Pos Position // start of the token
+	End Position // just past the token
+
+	posMap []Position // for a TokenBody or TokenHeredoc, see newBodyScanner
+	delim  string     // for a TokenHeredoc, its delimiter
+}
+
+// Lexer splits input into tokens. Unlike a Scanner it keeps everything,
+// whitespace, comments and how each argument was quoted, for syntax
+// highlighters and other tools that work on the text as written.
+// Scanner.Next is built on the same tokens, joining adjacent word tokens
+// into arguments.
+//
+// The text of a brace body is returned as a single TokenBody between
+// TokenLBrace and TokenRBrace, use Body to lex it.
+type Lexer struct {
+	s    *Scanner
+	word bool // in the middle of a word
+	err  error
+}
+
+// NewLexer creates a Lexer over in
+func NewLexer(in []byte) *Lexer {
+	return &Lexer{s: NewScanner(in)}
+}
+
+// NewLexerFile creates a Lexer over data read from the file name.
+// Positions, including those of errors, carry the file name.
+func NewLexerFile(name string, data []byte) *Lexer {
+	return &Lexer{s: NewScannerFile(name, data)}
+}
+
+// Semicolons sets if an unquoted ';' is a TokenSemicolon, see
+// Scanner.Semicolons. Lexers for bodies inherit it.
+func (l *Lexer) Semicolons(on bool) {
+	l.s.Semicolons(on)
+}
+
+// Expand enables expansion of variable references in the values of
+// TokenBareword and TokenDoubleQuoted tokens, see Scanner.Expand. Lexers
+// for bodies inherit it.
+func (l *Lexer) Expand(lookup func(name string) (string, bool)) {
+	l.s.Expand(lookup)
+}
+
+// Next returns the next token. At the end of the input it returns io.EOF.
+// Errors are a *ScanError, after which Next keeps returning the error.
+func (l *Lexer) Next() (Token, error) {
+	if l.err != nil {
+		return Token{}, l.err
+	}
+	tok, err := l.s.token(l.word)
+	if err != nil {
+		l.err = err
+		return Token{}, err
+	}
+	l.word = tok.Kind.isWord() || (l.word && tok.Kind == TokenLineContinuation)
+	return tok, nil
+}
+
+// Body returns a Lexer over the value of a TokenBody or TokenHeredoc
+// returned by l, with positions in l's input. For other tokens it returns
+// nil.
+func (l *Lexer) Body(tok Token) *Lexer {
+	if tok.posMap == nil {
+		return nil
+	}
+	s := newBodyScanner([]byte(tok.Value), tok.posMap)
+	s.lookup, s.semicolons = l.s.lookup, l.s.semicolons
+	return &Lexer{s: s}
+}
+
+// token scans the next token. Comments, braces, heredocs and back quotes
+// are only recognised at the start of a word, in a word they are part of
+// a TokenBareword.
+func (s *Scanner) token(word bool) (Token, error) {
+	if len(s.queued) > 0 {
+		tok := s.queued[0]
+		s.queued = s.queued[1:]
+		return tok, nil
+	}
+	if !s.more() {
+		return Token{}, io.EOF
+	}
+
+	s.mark()
+	start := s.pos
+	tok := Token{Pos: s.CurrentPos()}
+	var err error
+	switch b := s.s[s.pos]; {
+	case isNewLine(b):
+		tok.Kind = TokenNewline
+		s.advance()
+	case b == ';' && s.semicolons:
+		tok.Kind = TokenSemicolon
+		s.advance()
+	case isSpace(b) || (!word && b < 32):
+		tok.Kind = TokenWhitespace
+		for s.more() && (isSpace(s.s[s.pos]) || s.s[s.pos] < 32) && !isNewLine(s.s[s.pos]) {
+			s.advance()
+		}
+	case !word && isComment(b):
+		tok.Kind = TokenComment
+		s.skipComment()
+	case !word && b == '<' && s.heredocLen() > 0:
+		tok.Kind = TokenHeredoc
+		tok.delim, tok.Value, tok.posMap, err = s.parseHeredoc()
+		s.lastBody, s.lastMap = tok.Value, tok.posMap
+	case !word && isBackQuote(b):
+		tok.Kind = TokenBackQuoted
+		tok.Value, err = s.parseBackQuote()
+	case !word && isLeftBrace(b):
+		return s.braceTokens(tok)
+	case b == '\\':
+		tok.Kind = TokenEscape
+		tok.Value, err = s.parseBackslashEscape()
+		if err == nil && s.s[s.pos-1] == '\n' {
+			tok.Kind = TokenLineContinuation
+		}
+	case isQuote1(b):
+		tok.Kind = TokenSingleQuoted
+		tok.Value, err = s.parseQuote1()
+	case isQuote2(b):
+		tok.Kind = TokenDoubleQuoted
+		tok.Value, err = s.parseQuote2()
+	default:
+		tok.Kind = TokenBareword
+		tok.Value, err = s.lexBareword()
+	}
+	if err != nil {
+		return Token{}, err
+	}
+	tok.Raw = string(s.s[start:s.pos])
+	tok.End = s.CurrentPos()
+	switch tok.Kind {
+	case TokenNewline, TokenSemicolon, TokenWhitespace, TokenComment:
+		tok.Value = tok.Raw
+	}
+	return tok, nil
+}
+
+// braceTokens scans a brace block, returning the TokenLBrace and queueing
+// the TokenBody and TokenRBrace
+func (s *Scanner) braceTokens(lbrace Token) (Token, error) {
+	start := s.pos
+	body, posMap, err := s.parseBrace()
+	if err != nil {
+		return Token{}, err
+	}
+	lbrace.Kind, lbrace.Raw, lbrace.Value = TokenLBrace, "{", "{"
+	// the brace is a single byte, so the body starts on the same line
+	lbrace.End = lbrace.Pos
+	lbrace.End.Column++
+	lbrace.End.Offset++
+
+	raw := string(s.s[start+1 : s.pos-1])
+	closing := posMap[len(posMap)-1]
+	s.queued = append(s.queued,
+		Token{Kind: TokenBody, Raw: raw, Value: body, Pos: lbrace.End, End: closing, posMap: posMap},
+		Token{Kind: TokenRBrace, Raw: "}", Value: "}", Pos: closing, End: s.CurrentPos()},
+	)
+	return lbrace, nil
+}
+
+// lexBareword scans unquoted text up to whitespace, a quote, a backslash
+// or the end of the command, expanding variables if enabled
+func (s *Scanner) lexBareword() (string, error) {
+	var out strings.Builder
+	i := s.pos
+	for s.more() {
+		b := s.s[s.pos]
+		switch {
+		case isSpace(b) || isQuote1(b) || isQuote2(b) || isNewLine(b) || b == '\\' || (b == ';' && s.semicolons):
+			out.Write(s.s[i:s.pos])
+			return out.String(), nil
+		case b == '$' && s.lookup != nil:
+			out.Write(s.s[i:s.pos])
+			value, err := s.parseVar()
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(value)
+			i = s.pos
+		default:
+			s.advance()
+		}
+	}
+	out.Write(s.s[i:s.pos])
+	return out.String(), nil
+}
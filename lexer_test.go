@@ -0,0 +1,197 @@
+package cmdconfig
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// lex returns the remaining tokens of l
+func lex(t *testing.T, l *Lexer) []Token {
+	t.Helper()
+	var toks []Token
+	for {
+		tok, err := l.Next()
+		if err == io.EOF {
+			return toks
+		}
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		toks = append(toks, tok)
+	}
+}
+
+func TestLexer(t *testing.T) {
+	type tk struct {
+		kind  TokenKind
+		raw   string
+		value string
+	}
+	tests := []struct {
+		input string
+		want  []tk
+	}{
+		{"name 'John' \"B\\\"r\"\n", []tk{
+			{TokenBareword, "name", "name"},
+			{TokenWhitespace, " ", " "},
+			{TokenSingleQuoted, "'John'", "John"},
+			{TokenWhitespace, " ", " "},
+			{TokenDoubleQuoted, `"B\"r"`, `B"r`},
+			{TokenNewline, "\n", "\n"},
+		}},
+		{"a\\ b#c #d", []tk{
+			{TokenBareword, "a", "a"},
+			{TokenEscape, "\\ ", " "},
+			{TokenBareword, "b#c", "b#c"},
+			{TokenWhitespace, " ", " "},
+			{TokenComment, "#d", "#d"},
+		}},
+		{"x \\\n  `y`z", []tk{
+			{TokenBareword, "x", "x"},
+			{TokenWhitespace, " ", " "},
+			{TokenLineContinuation, "\\\n", ""},
+			{TokenWhitespace, "  ", "  "},
+			{TokenBackQuoted, "`y`", "y"},
+			{TokenBareword, "z", "z"},
+		}},
+		{"s {\n  \\}\n}", []tk{
+			{TokenBareword, "s", "s"},
+			{TokenWhitespace, " ", " "},
+			{TokenLBrace, "{", "{"},
+			{TokenBody, "\n  \\}\n", "\n}\n"},
+			{TokenRBrace, "}", "}"},
+		}},
+		{"run <<EOF\necho\nEOF\n", []tk{
+			{TokenBareword, "run", "run"},
+			{TokenWhitespace, " ", " "},
+			{TokenHeredoc, "<<EOF\necho\nEOF", "echo"},
+			{TokenNewline, "\n", "\n"},
+		}},
+		{"a\x01b \r\n", []tk{
+			{TokenBareword, "a\x01b", "a\x01b"},
+			{TokenWhitespace, " \r", " \r"},
+			{TokenNewline, "\n", "\n"},
+		}},
+	}
+	for i, tc := range tests {
+		var got []tk
+		for _, tok := range lex(t, NewLexer([]byte(tc.input))) {
+			got = append(got, tk{tok.Kind, tok.Raw, tok.Value})
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("case %d: expected %v got %v", i, tc.want, got)
+		}
+	}
+}
+
+func TestLexerPositions(t *testing.T) {
+	input := "a 'b'\nc {\n  d\\{ e\n}\n"
+	l := NewLexerFile("x.conf", []byte(input))
+	var body Token
+	for _, tok := range lex(t, l) {
+		if tok.Kind == TokenBody {
+			body = tok
+			continue
+		}
+		if got := input[tok.Pos.Offset:tok.End.Offset]; got != tok.Raw {
+			t.Errorf("%s: expected span %q got %q", tok.Kind, tok.Raw, got)
+		}
+		if tok.Pos.Filename != "x.conf" {
+			t.Errorf("%s: expected file name x.conf got %q", tok.Kind, tok.Pos.Filename)
+		}
+	}
+	if body.Pos.Offset != 9 || body.End.Offset != 18 {
+		t.Errorf("expected body span 9-18 got %d-%d", body.Pos.Offset, body.End.Offset)
+	}
+
+	// tokens of the body map back to the input
+	want := []Position{
+		{Line: 2, Column: 4, Offset: 9, Filename: "x.conf"},
+		{Line: 3, Column: 3, Offset: 12, Filename: "x.conf"},
+		{Line: 3, Column: 6, Offset: 15, Filename: "x.conf"},
+		{Line: 3, Column: 7, Offset: 16, Filename: "x.conf"},
+		{Line: 3, Column: 8, Offset: 17, Filename: "x.conf"},
+	}
+	var got []Position
+	for _, tok := range lex(t, l.Body(body)) {
+		got = append(got, tok.Pos)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v got %v", want, got)
+	}
+	if l.Body(Token{Kind: TokenBareword}) != nil {
+		t.Errorf("expected no body lexer for a bareword")
+	}
+}
+
+func TestLexerLossless(t *testing.T) {
+	inputs := []string{
+		"   name   'John'   \"Brown\"   # trailing  \n\n\n",
+		"server web01 {\n    host a\n    location /api { proxy b }\n} # end\nnext\n",
+		"echo a\\ b \"say \\\"hi\\\"\" `back\nquote` name=\"mary ann\"\n",
+		"long a b \\\n   c;d\n",
+		"script <<-EOF # run\n\techo\n\tEOF\nx\r\n",
+	}
+	for i, input := range inputs {
+		var b strings.Builder
+		for _, tok := range lex(t, NewLexer([]byte(input))) {
+			b.WriteString(tok.Raw)
+		}
+		if got := b.String(); got != input {
+			t.Errorf("case %d: expected %q got %q", i, input, got)
+		}
+	}
+}
+
+func TestLexerSemicolons(t *testing.T) {
+	l := NewLexer([]byte("a;b \";\""))
+	l.Semicolons(true)
+	var kinds []TokenKind
+	for _, tok := range lex(t, l) {
+		kinds = append(kinds, tok.Kind)
+	}
+	want := []TokenKind{TokenBareword, TokenSemicolon, TokenBareword, TokenWhitespace, TokenDoubleQuoted}
+	if !reflect.DeepEqual(kinds, want) {
+		t.Errorf("expected %v got %v", want, kinds)
+	}
+}
+
+func TestLexerError(t *testing.T) {
+	l := NewLexer([]byte("a 'b"))
+	var err error
+	for err == nil {
+		_, err = l.Next()
+	}
+	if _, ok := err.(*ScanError); !ok || err.Error() != "got EOF in single quote at line 1, column 5" {
+		t.Fatalf("expected a scan error got %v", err)
+	}
+	if _, again := l.Next(); again != err {
+		t.Errorf("expected the error again got %v", again)
+	}
+}
+
+// Next joins adjacent word tokens into arguments
+func TestScannerTokens(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"a \\\n b\n", []string{"a", "b"}},
+		{"a\\\nb c", []string{"ab", "c"}},
+		{"a\\\n\"b\"'c'", []string{"abc"}},
+		{"`x`y z", []string{"x", "y", "z"}},
+		{"a{b} c", []string{"a{b}", "c"}},
+		{"a \x01b", []string{"a", "b"}},
+	}
+	for i, tc := range tests {
+		args, _, err := NewScanner([]byte(tc.input)).Next()
+		if err != nil {
+			t.Fatalf("case %d: unexpected error %v", i, err)
+		}
+		if !reflect.DeepEqual(args, tc.want) {
+			t.Errorf("case %d: expected %q got %q", i, tc.want, args)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package lint
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/client9/cmdconfig"
+)
+
+// ConfigFile is the name of the config file looked for by cmdconfig-lint
+const ConfigFile = ".cmdconfig-lint"
+
+// Config is the configuration of a Linter
+type Config struct {
+	Rules map[string]RuleConfig // by rule name
+
+	// Raw lists directives whose bodies are kept as text and not
+	// checked, e.g. embedded scripts
+	Raw []string
+}
+
+// RuleConfig is the configuration of a single rule
+type RuleConfig struct {
+	Off      bool
+	Severity Severity
+	Options  []*cmdconfig.Node // passed to Configure
+	Pos      cmdconfig.Position
+}
+
+// ParseConfig reads a config file, itself in cmdconfig format:
+//
+//	# rule name [off|error|warning|info] [{ options }]
+//	rule quote-style off
+//	rule trailing-whitespace error
+//	rule nesting {
+//	    max 3
+//	}
+//	rule duplicate {
+//	    repeatable listen allow
+//	}
+//
+//	# directives whose bodies are not cmdconfig
+//	raw script
+//
+// Rules not mentioned run as warnings with their default options. Errors
+// are a *cmdconfig.ScanError.
+func ParseConfig(data []byte) (*Config, error) {
+	doc, err := cmdconfig.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return newConfig(doc)
+}
+
+// ParseConfigFile is like ParseConfig but the positions of errors, and of
+// the rules, carry the file name
+func ParseConfigFile(name string, data []byte) (*Config, error) {
+	p := cmdconfig.Parser{}
+	doc, err := p.ParseFile(name, data)
+	if err != nil {
+		return nil, err
+	}
+	return newConfig(doc)
+}
+
+// newConfig builds a Config from a parsed config file
+func newConfig(doc *cmdconfig.Document) (*Config, error) {
+	cfg := &Config{Rules: map[string]RuleConfig{}}
+	for _, n := range doc.Children {
+		switch n.Name() {
+		case "rule":
+			if len(n.Args) < 2 || len(n.Args) > 3 || n.Raw {
+				return nil, configError(n, "usage: rule name [off|error|warning|info] [{ options }]")
+			}
+			name := n.Args[1]
+			if _, ok := cfg.Rules[name]; ok {
+				return nil, configError(n, fmt.Sprintf("rule %s configured twice", name))
+			}
+			rc := RuleConfig{Options: n.Children, Pos: n.Pos}
+			if len(n.Args) == 3 {
+				var ok bool
+				rc.Off = n.Args[2] == "off"
+				if rc.Severity, ok = parseSeverity(n.Args[2]); !ok && !rc.Off {
+					return nil, configError(n, fmt.Sprintf("unknown severity %q", n.Args[2]))
+				}
+			}
+			cfg.Rules[name] = rc
+		case "raw":
+			if n.HasBody() {
+				return nil, configError(n, "raw has no body")
+			}
+			cfg.Raw = append(cfg.Raw, n.Args[1:]...)
+		default:
+			return nil, configError(n, fmt.Sprintf("unknown directive %q", n.Name()))
+		}
+	}
+	return cfg, nil
+}
+
+func configError(n *cmdconfig.Node, msg string) error {
+	return &cmdconfig.ScanError{Pos: n.Pos, Msg: msg}
+}
+
+// optionInt returns the single integer argument of an option
+func optionInt(n *cmdconfig.Node) (int, error) {
+	if len(n.Args) == 2 {
+		if v, err := strconv.Atoi(n.Args[1]); err == nil && v >= 0 {
+			return v, nil
+		}
+	}
+	return 0, configError(n, fmt.Sprintf("usage: %s number", n.Name()))
+}
+
+// unknownOption returns the error for an option a rule does not have
+func unknownOption(r Rule, n *cmdconfig.Node) error {
+	return configError(n, fmt.Sprintf("rule %s has no option %q", r.Name(), n.Name()))
+}
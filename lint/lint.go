@@ -0,0 +1,255 @@
+// Package lint checks cmdconfig files for problems beyond syntax errors,
+// such as duplicate directives, inconsistent or needless quoting,
+// indentation that defeats dedent, deep nesting and unused variables.
+//
+// Each check is a Rule. Rules returns the built-in ones, and a Linter can
+// run any others alongside them. Which rules run, their severity and
+// their options can be set by a config file, see ParseConfig.
+package lint
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/client9/cmdconfig"
+)
+
+// Severity is how serious a Diagnostic is
+type Severity int
+
+const (
+	Warning Severity = iota // the default
+	Error
+	Info
+)
+
+var severityNames = []string{Warning: "warning", Error: "error", Info: "info"}
+
+func (s Severity) String() string {
+	if s >= 0 && int(s) < len(severityNames) {
+		return severityNames[s]
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// parseSeverity is the inverse of Severity.String
+func parseSeverity(name string) (Severity, bool) {
+	for i, s := range severityNames {
+		if s == name {
+			return Severity(i), true
+		}
+	}
+	return 0, false
+}
+
+// Diagnostic is a problem found by a Rule
+type Diagnostic struct {
+	Pos     cmdconfig.Position
+	End     cmdconfig.Position // just past the problem
+	Message string
+
+	// Rule and Severity are filled in by the Linter
+	Rule     string
+	Severity Severity
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s (%s)", d.Pos, d.Severity, d.Message, d.Rule)
+}
+
+// Rule is a single check
+type Rule interface {
+	// Name identifies the rule in config files and output, e.g. "duplicate"
+	Name() string
+
+	// Description is a one line summary of what the rule reports
+	Description() string
+
+	// Check is called for every Node, starting with the root
+	Check(n *Node) []Diagnostic
+}
+
+// Configurer is implemented by rules with options. Configure is called
+// with the commands in the rule's block of the config file.
+type Configurer interface {
+	Configure(options []*cmdconfig.Node) error
+}
+
+// File is the file being checked
+type File struct {
+	Name   string
+	Source []byte
+
+	lines []int // offset of the start of each line
+}
+
+// Position returns the position of the byte at offset
+func (f *File) Position(offset int) cmdconfig.Position {
+	if f.lines == nil {
+		f.lines = []int{0}
+		for i, b := range f.Source {
+			if b == '\n' {
+				f.lines = append(f.lines, i+1)
+			}
+		}
+	}
+	line := sort.SearchInts(f.lines, offset+1) - 1
+	return cmdconfig.Position{
+		Line:     line + 1,
+		Column:   offset - f.lines[line] + 1,
+		Offset:   offset,
+		Filename: f.Name,
+	}
+}
+
+// Node is a command being checked, along with its context. The root node
+// holds the top level commands of the file and has no arguments.
+type Node struct {
+	*cmdconfig.Node
+
+	Stmt   *cmdconfig.Stmt // the command as written, nil for the root
+	Parent *Node           // the enclosing block, nil for the root
+	Nodes  []*Node         // the Children as Nodes
+	Depth  int             // 0 for the root, 1 for top level commands
+	File   *File
+}
+
+// wordEnd returns the position just past word i of the command
+func (n *Node) wordEnd(i int) cmdconfig.Position {
+	w := n.Stmt.Words[i]
+	return n.File.Position(w.Pos.Offset + len(w.Raw))
+}
+
+// Linter runs rules over files
+type Linter struct {
+	rules    []Rule
+	settings map[string]RuleConfig
+	parser   cmdconfig.Parser
+}
+
+// New returns a Linter running rules, or the built-in rules if there are
+// none, configured by cfg. cfg may be nil for the defaults.
+func New(cfg *Config, rules ...Rule) (*Linter, error) {
+	if len(rules) == 0 {
+		rules = Rules()
+	}
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	l := &Linter{settings: cfg.Rules, parser: cmdconfig.Parser{MaxErrors: -1}}
+	if len(cfg.Raw) > 0 {
+		raw := cfg.Raw
+		l.parser.Raw = func(args []string) bool {
+			for _, name := range raw {
+				if name == args[0] {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	known := map[string]bool{}
+	for _, r := range rules {
+		known[r.Name()] = true
+		rc, ok := cfg.Rules[r.Name()]
+		if rc.Off {
+			continue
+		}
+		if ok && len(rc.Options) > 0 {
+			c, ok := r.(Configurer)
+			if !ok {
+				return nil, &cmdconfig.ScanError{Pos: rc.Options[0].Pos, Msg: fmt.Sprintf("rule %s has no options", r.Name())}
+			}
+			if err := c.Configure(rc.Options); err != nil {
+				return nil, err
+			}
+		}
+		l.rules = append(l.rules, r)
+	}
+	for name, rc := range cfg.Rules {
+		if !known[name] {
+			return nil, &cmdconfig.ScanError{Pos: rc.Pos, Msg: fmt.Sprintf("unknown rule %q", name)}
+		}
+	}
+	return l, nil
+}
+
+// Rules returns the rules the Linter runs, those not turned off
+func (l *Linter) Rules() []Rule {
+	return l.rules
+}
+
+// Check lints src, the contents of the file name. Syntax errors are
+// reported by the rule "syntax", in which case no other rules are run.
+// The diagnostics are sorted by position.
+func (l *Linter) Check(name string, src []byte) []Diagnostic {
+	f := &File{Name: name, Source: src}
+	doc, err := l.parser.Parse(src)
+	var tree *cmdconfig.SyntaxTree
+	if err == nil {
+		tree, err = cmdconfig.ParseSyntax(src)
+	}
+	if err != nil {
+		return syntaxErrors(f, err)
+	}
+
+	root := &Node{Node: &cmdconfig.Node{Children: doc.Children}, File: f}
+	root.Nodes = build(root, doc.Children, tree.Stmts)
+
+	var diags []Diagnostic
+	var visit func(n *Node)
+	visit = func(n *Node) {
+		for _, r := range l.rules {
+			for _, d := range r.Check(n) {
+				d.Rule, d.Severity = r.Name(), l.settings[r.Name()].Severity
+				d.Pos.Filename, d.End.Filename = name, name
+				diags = append(diags, d)
+			}
+		}
+		for _, c := range n.Nodes {
+			visit(c)
+		}
+	}
+	visit(root)
+
+	sort.SliceStable(diags, func(i, j int) bool {
+		return diags[i].Pos.Offset < diags[j].Pos.Offset
+	})
+	return diags
+}
+
+// build pairs each node with the statement it was parsed from
+func build(parent *Node, children []*cmdconfig.Node, stmts []*cmdconfig.Stmt) []*Node {
+	nodes := make([]*Node, len(children))
+	for i, c := range children {
+		n := &Node{Node: c, Parent: parent, Depth: parent.Depth + 1, File: parent.File}
+		if i < len(stmts) {
+			n.Stmt = stmts[i]
+		}
+		if n.Stmt != nil && n.Stmt.Block != nil {
+			n.Nodes = build(n, c.Children, n.Stmt.Block.Stmts)
+		}
+		nodes[i] = n
+	}
+	return nodes
+}
+
+// syntaxErrors returns err, a *ScanError or an ErrorList, as diagnostics
+func syntaxErrors(f *File, err error) []Diagnostic {
+	var list cmdconfig.ErrorList
+	if !errors.As(err, &list) {
+		var scanErr *cmdconfig.ScanError
+		if !errors.As(err, &scanErr) {
+			return []Diagnostic{{Pos: f.Position(0), End: f.Position(0), Message: err.Error(), Rule: "syntax", Severity: Error}}
+		}
+		list = cmdconfig.ErrorList{scanErr}
+	}
+	diags := make([]Diagnostic, len(list))
+	for i, e := range list {
+		e.Pos.Filename = f.Name
+		diags[i] = Diagnostic{Pos: e.Pos, End: e.Pos, Message: e.Msg, Rule: "syntax", Severity: Error}
+	}
+	return diags
+}
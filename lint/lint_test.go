@@ -0,0 +1,123 @@
+package lint
+
+import (
+	"strings"
+	"testing"
+)
+
+// check lints input with the default rules and returns the diagnostics
+// as strings
+func check(t *testing.T, cfg, input string) []string {
+	t.Helper()
+	var c *Config
+	if cfg != "" {
+		var err error
+		if c, err = ParseConfig([]byte(cfg)); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	l, err := New(c)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	var out []string
+	for _, d := range l.Check("app.conf", []byte(input)) {
+		out = append(out, d.String())
+	}
+	return out
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"port 80\nport 81\nlisten 80\nlisten 80\ninclude a\ninclude b\n", []string{
+			"app.conf:2:1: warning: port repeated, first at line 1 (duplicate)",
+			"app.conf:4:1: warning: listen repeated, first at line 3 (duplicate)",
+		}},
+		{"server a {\n}\nserver b {\n}\nserver a {\n}\nset x 1\nset y ${x}\nuse ${y}\n", []string{
+			"app.conf:5:1: warning: server a repeated, first at line 1 (duplicate)",
+		}},
+		{"a \"x y\"\nb 'x y' 'it\"s'\nc \"plain\"\n", []string{
+			"app.conf:2:3: warning: single quotes in a file using double quotes (quote-style)",
+			"app.conf:3:3: warning: unnecessary quotes around plain (unnecessary-quotes)",
+		}},
+		{"a 'b' '${x}' '<<EOF' 'a b'\n", []string{
+			"app.conf:1:3: warning: unnecessary quotes around b (unnecessary-quotes)",
+		}},
+		{"a b  \nc \"d  \n\" # e \t\nf {\n  g \n  \n}\nh <<EOF\nx  \nEOF\ni  ", []string{
+			"app.conf:1:4: warning: trailing whitespace (trailing-whitespace)",
+			"app.conf:3:6: warning: trailing whitespace (trailing-whitespace)",
+			"app.conf:5:4: warning: trailing whitespace (trailing-whitespace)",
+			"app.conf:6:1: warning: trailing whitespace (trailing-whitespace)",
+			"app.conf:11:2: warning: trailing whitespace (trailing-whitespace)",
+		}},
+		{"a {\n    b\n\tc\n    d {\n\t \te\n    }\n}\n", []string{
+			"app.conf:3:1: warning: indented with tabs, the block uses spaces (mixed-indent)",
+			"app.conf:5:1: warning: indentation mixes tabs and spaces (mixed-indent)",
+		}},
+		{"a {\n b {\n  c {\n   d {\n    e {\n     f {\n     }\n    }\n   }\n  }\n }\n}\n", []string{
+			"app.conf:5:5: warning: block nested 5 deep, more than 4 (nesting)",
+		}},
+		{"set a 1\nset b 2\nx ${b}\nblock {\n  set a 3\n  y ${a}\n}\nset b 4\n", []string{
+			"app.conf:1:5: warning: variable a is set but not used (unused-set)",
+			"app.conf:8:5: warning: variable b is set but not used (unused-set)",
+		}},
+		{"ok\nbad 'quote\n", []string{
+			"app.conf:2:5: error: got EOF in single quote (syntax)",
+		}},
+	}
+	for i, tc := range tests {
+		got := check(t, "", tc.input)
+		if strings.Join(got, "\n") != strings.Join(tc.want, "\n") {
+			t.Errorf("case %d: expected %q got %q", i, tc.want, got)
+		}
+	}
+}
+
+func TestConfig(t *testing.T) {
+	cfg := `
+rule quote-style off
+rule trailing-whitespace error
+rule nesting info {
+    max 1
+}
+rule duplicate {
+    repeatable port
+}
+raw script
+`
+	input := "port 80\nport 81\na 'x y' \"z w\" \nb {\n  c {\n  }\n}\nscript {\n  echo 'unbalanced\n}\n"
+	want := []string{
+		"app.conf:3:14: error: trailing whitespace (trailing-whitespace)",
+		"app.conf:5:3: info: block nested 2 deep, more than 1 (nesting)",
+	}
+	got := check(t, cfg, input)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected %q got %q", want, got)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	tests := []struct {
+		cfg  string
+		want string
+	}{
+		{"rule nesting loud", "unknown severity \"loud\" at line 1, column 1"},
+		{"rule spelling", "unknown rule \"spelling\" at line 1, column 1"},
+		{"rule nesting {\n  depth 2\n}", "rule nesting has no option \"depth\" at line 2, column 3"},
+		{"rule nesting {\n  max x\n}", "usage: max number at line 2, column 3"},
+		{"rule mixed-indent {\n  x\n}", "rule mixed-indent has no options at line 2, column 3"},
+		{"\nrules nesting", "unknown directive \"rules\" at line 2, column 1"},
+	}
+	for i, tc := range tests {
+		cfg, err := ParseConfig([]byte(tc.cfg))
+		if err == nil {
+			_, err = New(cfg)
+		}
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("case %d: expected %q got %v", i, tc.want, err)
+		}
+	}
+}
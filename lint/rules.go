@@ -0,0 +1,386 @@
+package lint
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/client9/cmdconfig"
+)
+
+// Rules returns the built-in rules with their default options
+func Rules() []Rule {
+	return []Rule{
+		&Duplicate{Repeatable: []string{"include", "set"}},
+		&QuoteStyle{},
+		&UnnecessaryQuotes{},
+		&TrailingWhitespace{},
+		&MixedIndent{},
+		&Nesting{Max: 4},
+		&UnusedSet{},
+	}
+}
+
+// Duplicate reports a directive given twice in the same block: a command
+// with the same arguments as an earlier one or, for commands without a
+// body, the same name, since the later one usually overrides the first.
+// Blocks such as "server a" and "server b" are told apart by their labels.
+// The directives in Repeatable, by default include and set, may be given
+// more than once with different arguments.
+//
+// Options:
+//
+//	repeatable name ...
+type Duplicate struct {
+	Repeatable []string
+}
+
+func (r *Duplicate) Name() string        { return "duplicate" }
+func (r *Duplicate) Description() string { return "directive given twice in the same block" }
+
+func (r *Duplicate) Configure(options []*cmdconfig.Node) error {
+	for _, o := range options {
+		if o.Name() != "repeatable" {
+			return unknownOption(r, o)
+		}
+		r.Repeatable = append(r.Repeatable, o.Args[1:]...)
+	}
+	return nil
+}
+
+func (r *Duplicate) Check(n *Node) []Diagnostic {
+	var diags []Diagnostic
+	seen := map[string]*Node{}
+	for _, c := range n.Nodes {
+		if len(c.Args) == 0 || c.Stmt == nil {
+			continue
+		}
+		// the arguments that must differ
+		key := c.Args[:1]
+		if c.HasBody() || slices.Contains(r.Repeatable, c.Name()) {
+			key = c.Args
+		}
+		k := cmdconfig.Format(key, "")
+		if first, ok := seen[k]; ok {
+			diags = append(diags, Diagnostic{
+				Pos:     c.Pos,
+				End:     c.wordEnd(len(key) - 1),
+				Message: fmt.Sprintf("%s repeated, first at line %d", k, first.Pos.Line),
+			})
+			continue
+		}
+		seen[k] = c
+	}
+	return diags
+}
+
+// QuoteStyle reports arguments in single quotes in a file that otherwise
+// uses double quotes, or the other way round. Prefer is the style to use,
+// "single" or "double", by default the one used first. Only arguments
+// that read the same in either style are reported, and those that need
+// no quotes at all are left to UnnecessaryQuotes.
+//
+// Options:
+//
+//	prefer single|double
+type QuoteStyle struct {
+	Prefer string
+}
+
+func (r *QuoteStyle) Name() string        { return "quote-style" }
+func (r *QuoteStyle) Description() string { return "mix of single and double quoted arguments" }
+
+func (r *QuoteStyle) Configure(options []*cmdconfig.Node) error {
+	for _, o := range options {
+		if o.Name() != "prefer" || len(o.Args) != 2 || (o.Args[1] != "single" && o.Args[1] != "double") {
+			return configError(o, "usage: prefer single|double")
+		}
+		r.Prefer = o.Args[1]
+	}
+	return nil
+}
+
+func (r *QuoteStyle) Check(n *Node) []Diagnostic {
+	if n.Parent != nil {
+		return nil
+	}
+	var prefer cmdconfig.QuoteKind
+	switch r.Prefer {
+	case "single":
+		prefer = cmdconfig.SingleQuoted
+	case "double":
+		prefer = cmdconfig.DoubleQuoted
+	}
+
+	var diags []Diagnostic
+	walk(n, func(c *Node) {
+		for i, w := range c.Stmt.Words {
+			if w.Quote != cmdconfig.SingleQuoted && w.Quote != cmdconfig.DoubleQuoted {
+				continue
+			}
+			if prefer == cmdconfig.Bareword {
+				prefer = w.Quote
+			}
+			if w.Quote == prefer || !requote(w) || unnecessary(w) {
+				continue
+			}
+			msg := "single quotes in a file using double quotes"
+			if w.Quote == cmdconfig.DoubleQuoted {
+				msg = "double quotes in a file using single quotes"
+			}
+			diags = append(diags, Diagnostic{Pos: w.Pos, End: c.wordEnd(i), Message: msg})
+		}
+	})
+	return diags
+}
+
+// requote reports if the quoted word w reads the same in the other style
+func requote(w *cmdconfig.Word) bool {
+	if w.Quote == cmdconfig.SingleQuoted {
+		return !strings.ContainsAny(w.Value, "\"\\$")
+	}
+	return !strings.ContainsAny(w.Raw, "'\\$")
+}
+
+// UnnecessaryQuotes reports quoted arguments that read the same without
+// quotes, see cmdconfig.IsBareword
+type UnnecessaryQuotes struct{}
+
+func (r *UnnecessaryQuotes) Name() string        { return "unnecessary-quotes" }
+func (r *UnnecessaryQuotes) Description() string { return "quotes around an argument that needs none" }
+
+func (r *UnnecessaryQuotes) Check(n *Node) []Diagnostic {
+	if n.Stmt == nil {
+		return nil
+	}
+	var diags []Diagnostic
+	for i, w := range n.Stmt.Words {
+		if unnecessary(w) {
+			diags = append(diags, Diagnostic{
+				Pos:     w.Pos,
+				End:     n.wordEnd(i),
+				Message: fmt.Sprintf("unnecessary quotes around %s", w.Value),
+			})
+		}
+	}
+	return diags
+}
+
+// unnecessary reports if w is quoted but would read the same as a
+// bareword. Values that could expand variables or end a command without
+// quotes are left alone.
+func unnecessary(w *cmdconfig.Word) bool {
+	return (w.Quote == cmdconfig.SingleQuoted || w.Quote == cmdconfig.DoubleQuoted) &&
+		cmdconfig.IsBareword(w.Value) && !strings.ContainsAny(w.Value, "$;")
+}
+
+// TrailingWhitespace reports spaces and tabs at the end of a line, other
+// than in quoted text and heredocs where they are part of the value
+type TrailingWhitespace struct{}
+
+func (r *TrailingWhitespace) Name() string        { return "trailing-whitespace" }
+func (r *TrailingWhitespace) Description() string { return "whitespace at the end of a line" }
+
+func (r *TrailingWhitespace) Check(n *Node) []Diagnostic {
+	if n.Parent != nil {
+		return nil
+	}
+	var diags []Diagnostic
+	report := func(pos, end cmdconfig.Position) {
+		diags = append(diags, Diagnostic{Pos: pos, End: end, Message: "trailing whitespace"})
+	}
+	var lex func(l *cmdconfig.Lexer, top bool)
+	lex = func(l *cmdconfig.Lexer, top bool) {
+		var space *cmdconfig.Token
+		for {
+			tok, err := l.Next()
+			if err != nil {
+				// at the end of a body whitespace is the indentation of
+				// the closing brace. A body that is not cmdconfig is only
+				// checked up to its first error.
+				if space != nil && top {
+					report(space.Pos, space.End)
+				}
+				return
+			}
+			switch tok.Kind {
+			case cmdconfig.TokenNewline:
+				if space != nil {
+					report(space.Pos, space.End)
+				}
+			case cmdconfig.TokenComment:
+				if trimmed := strings.TrimRight(tok.Raw, " \t"); len(trimmed) < len(tok.Raw) {
+					pos := n.File.Position(tok.Pos.Offset + len(trimmed))
+					report(pos, tok.End)
+				}
+			case cmdconfig.TokenBody:
+				lex(l.Body(tok), false)
+			}
+			space = nil
+			if tok.Kind == cmdconfig.TokenWhitespace {
+				space = &tok
+			}
+		}
+	}
+	lex(cmdconfig.NewLexerFile(n.File.Name, n.File.Source), true)
+	return diags
+}
+
+// MixedIndent reports lines in a block indented with tabs where the block
+// uses spaces, or the other way round. The body of a block is dedented by
+// the indentation common to its lines, so mixing them leaves the text
+// indented.
+type MixedIndent struct{}
+
+func (r *MixedIndent) Name() string        { return "mixed-indent" }
+func (r *MixedIndent) Description() string { return "tabs and spaces mixed in a block's indentation" }
+
+func (r *MixedIndent) Check(n *Node) []Diagnostic {
+	if n.Parent == nil || !n.Command.HasBody() || n.Heredoc != "" {
+		return nil
+	}
+	var diags []Diagnostic
+	src := n.File.Source
+	var first byte // the indentation character of the block
+	start := n.BodyStart.Offset + 1
+	end := n.BodyEnd.Offset - 1
+	for i := start; i < end; i++ {
+		if src[i-1] != '\n' || nested(n, i) {
+			continue
+		}
+		j := i
+		for j < end && (src[j] == ' ' || src[j] == '\t') {
+			j++
+		}
+		// blank lines and the closing brace do not count for dedent
+		if j == i || j == end || src[j] == '\n' {
+			continue
+		}
+		indent := string(src[i:j])
+		switch {
+		case strings.Contains(indent, " ") && strings.Contains(indent, "\t"):
+			diags = append(diags, Diagnostic{Pos: n.File.Position(i), End: n.File.Position(j), Message: "indentation mixes tabs and spaces"})
+		case first == 0:
+			first = indent[0]
+		case indent[0] != first:
+			msg := "indented with tabs, the block uses spaces"
+			if first == '\t' {
+				msg = "indented with spaces, the block uses tabs"
+			}
+			diags = append(diags, Diagnostic{Pos: n.File.Position(i), End: n.File.Position(j), Message: msg})
+		}
+	}
+	return diags
+}
+
+// nested reports if the line starting at offset is inside the body of a
+// child of n, other than its last line, which holds the closing brace
+func nested(n *Node, offset int) bool {
+	for _, c := range n.Children {
+		if c.Command.HasBody() && c.BodyStart.Offset < offset && offset < c.BodyEnd.Offset {
+			end := offset
+			for end < c.BodyEnd.Offset && n.File.Source[end] != '\n' {
+				end++
+			}
+			if end < c.BodyEnd.Offset {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Nesting reports blocks nested more than Max deep
+//
+// Options:
+//
+//	max number
+type Nesting struct {
+	Max int
+}
+
+func (r *Nesting) Name() string        { return "nesting" }
+func (r *Nesting) Description() string { return "blocks nested too deeply" }
+
+func (r *Nesting) Configure(options []*cmdconfig.Node) error {
+	for _, o := range options {
+		if o.Name() != "max" {
+			return unknownOption(r, o)
+		}
+		max, err := optionInt(o)
+		if err != nil {
+			return err
+		}
+		r.Max = max
+	}
+	return nil
+}
+
+func (r *Nesting) Check(n *Node) []Diagnostic {
+	// report the outermost block that is too deep
+	if n.Depth != r.Max+1 || n.Children == nil || n.Stmt == nil {
+		return nil
+	}
+	end := n.File.Position(n.BodyStart.Offset + 1)
+	if len(n.Stmt.Words) > 0 {
+		end = n.wordEnd(len(n.Stmt.Words) - 1)
+	}
+	return []Diagnostic{{
+		Pos:     n.Pos,
+		End:     end,
+		Message: fmt.Sprintf("block nested %d deep, more than %d", n.Depth, r.Max),
+	}}
+}
+
+// UnusedSet reports set commands whose variable is not referenced by a
+// later command in the same block, or a block nested in it, before it is
+// set again
+type UnusedSet struct{}
+
+func (r *UnusedSet) Name() string        { return "unused-set" }
+func (r *UnusedSet) Description() string { return "variable set but never used" }
+
+func (r *UnusedSet) Check(n *Node) []Diagnostic {
+	var diags []Diagnostic
+	for i, c := range n.Nodes {
+		if c.Name() != "set" || len(c.Args) < 2 || c.Stmt == nil || len(c.Stmt.Words) < 2 {
+			continue
+		}
+		if !uses(n.Nodes[i+1:], c.Args[1]) {
+			diags = append(diags, Diagnostic{
+				Pos:     c.Stmt.Words[1].Pos,
+				End:     c.wordEnd(1),
+				Message: fmt.Sprintf("variable %s is set but not used", c.Args[1]),
+			})
+		}
+	}
+	return diags
+}
+
+// uses reports if nodes refer to the variable name before setting it again
+func uses(nodes []*Node, name string) bool {
+	for _, n := range nodes {
+		for _, arg := range n.Args {
+			if strings.Contains(arg, "${"+name+"}") || strings.Contains(arg, "${"+name+":") {
+				return true
+			}
+		}
+		if n.Name() == "set" && len(n.Args) > 1 && n.Args[1] == name {
+			return false
+		}
+		if uses(n.Nodes, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// walk calls fn for every command below n in the order they are written
+func walk(n *Node, fn func(n *Node)) {
+	for _, c := range n.Nodes {
+		if c.Stmt != nil {
+			fn(c)
+		}
+		walk(c, fn)
+	}
+}
@@ -0,0 +1,171 @@
+package cmdconfig
+
+import "slices"
+
+// MergeMode is how the commands of an overlay combine with the inherited
+// commands of the same name, see Merge
+type MergeMode int
+
+const (
+	// MergeDefault merges blocks by label and replaces other commands
+	MergeDefault MergeMode = iota
+
+	// MergeReplace replaces every inherited command of the same name with
+	// those of the overlay
+	MergeReplace
+
+	// MergeAppend keeps the inherited commands and adds those of the
+	// overlay after them
+	MergeAppend
+
+	// MergeByLabel pairs commands with the same arguments, such as
+	// "server web01". Paired blocks are merged recursively, other paired
+	// commands are replaced and unpaired ones are added.
+	MergeByLabel
+)
+
+// MergePolicy gives the MergeMode of directives by name, at any depth.
+// Directives not listed use MergeDefault.
+type MergePolicy map[string]MergeMode
+
+// Merge returns base with each overlay applied in turn, for layered
+// configs such as base.conf, prod.conf and local.conf. How each command of
+// an overlay combines with what it inherits is given by policy, which may
+// be nil. A command
+//
+//	unset name [label...]
+//
+// in an overlay deletes the inherited commands with those arguments, so
+// "unset listen" deletes every listen and "unset server web01" just that
+// block. Unset commands are not included in the result.
+//
+// The result shares nodes with the inputs, which are not modified. Nodes
+// keep their positions, so with documents read by Load or ParseFile the
+// position of each command says which file set it. A merged block has the
+// position of the block in base.
+func Merge(policy MergePolicy, base *Document, overlays ...*Document) (*Document, error) {
+	m := merger{policy: policy}
+	children, err := m.merge(nil, base.Children)
+	for _, o := range overlays {
+		if err != nil {
+			break
+		}
+		children, err = m.merge(children, o.Children)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Document{Children: children}, nil
+}
+
+type merger struct {
+	policy MergePolicy
+}
+
+// merge applies the commands of overlay to those inherited
+func (m *merger) merge(inherited, overlay []*Node) ([]*Node, error) {
+	out := slices.Clone(inherited)
+	// nodes that can be paired or replaced, those inherited and merged
+	// copies of them
+	old := map[*Node]bool{}
+	for _, n := range inherited {
+		old[n] = true
+	}
+	replaced := map[string]bool{}
+
+	for _, n := range overlay {
+		name := n.Name()
+		if name == "unset" {
+			if len(n.Args) < 2 {
+				return nil, errorf(n.Pos, "unset requires a directive name")
+			}
+			out = slices.DeleteFunc(out, func(c *Node) bool {
+				return len(c.Args) >= len(n.Args)-1 && slices.Equal(c.Args[:len(n.Args)-1], n.Args[1:])
+			})
+			continue
+		}
+
+		mode := m.policy[name]
+		if mode == MergeDefault {
+			mode = MergeReplace
+			if isBlock(n) {
+				mode = MergeByLabel
+			}
+		}
+		switch mode {
+		case MergeReplace:
+			if !replaced[name] {
+				replaced[name] = true
+				if i := slices.IndexFunc(out, func(c *Node) bool { return old[c] && c.Name() == name }); i >= 0 {
+					out = slices.DeleteFunc(out, func(c *Node) bool { return old[c] && c.Name() == name })
+					n, err := m.added(n)
+					if err != nil {
+						return nil, err
+					}
+					out = slices.Insert(out, i, n)
+					continue
+				}
+			}
+		case MergeByLabel:
+			i := slices.IndexFunc(out, func(c *Node) bool { return old[c] && slices.Equal(c.Args, n.Args) })
+			if i < 0 {
+				break
+			}
+			if !isBlock(n) || !isBlock(out[i]) {
+				n, err := m.added(n)
+				if err != nil {
+					return nil, err
+				}
+				out[i] = n
+				continue
+			}
+			children, err := m.merge(out[i].Children, n.Children)
+			if err != nil {
+				return nil, err
+			}
+			merged := *out[i]
+			merged.Children = children
+			// the body text is that of base alone
+			merged.Body, merged.bodyMap = "", nil
+			out[i] = &merged
+			old[&merged] = true
+			continue
+		}
+
+		// add after the last command of the same name, or at the end.
+		// The commands of base keep their order.
+		i := len(out)
+		if inherited != nil && slices.ContainsFunc(out, func(c *Node) bool { return c.Name() == name }) {
+			for out[i-1].Name() != name {
+				i--
+			}
+		}
+		n, err := m.added(n)
+		if err != nil {
+			return nil, err
+		}
+		out = slices.Insert(out, i, n)
+	}
+	return out, nil
+}
+
+// added returns n as it is added to the result without being merged. The
+// unset commands in the body of a block are applied and left out.
+func (m *merger) added(n *Node) (*Node, error) {
+	if !isBlock(n) {
+		return n, nil
+	}
+	children, err := m.merge(nil, n.Children)
+	if err != nil || slices.Equal(children, n.Children) {
+		return n, err
+	}
+	c := *n
+	c.Children = children
+	c.Body, c.bodyMap = "", nil
+	return &c, nil
+}
+
+// isBlock reports if n has a body of commands
+func isBlock(n *Node) bool {
+	return n.HasBody() && !n.Raw
+}
@@ -0,0 +1,111 @@
+package cmdconfig
+
+import (
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	base := `port 80
+listen a
+listen b
+server web01 {
+    root /srv
+    tls off
+}
+server web02 {
+    root /www
+}
+script <<EOF
+echo base
+EOF
+debug on
+`
+	tests := []struct {
+		policy   MergePolicy
+		overlays []string
+		want     string
+	}{
+		{nil, nil, base},
+		{nil, []string{"port 8080\nlisten c\nlisten d\nserver web01 {\n  tls on\n  cert x\n}\nserver web03 {}\nunset debug\n"},
+			"port 8080\nlisten c\nlisten d\nserver web01 {\n    root /srv\n    tls on\n    cert x\n}\nserver web02 {\n    root /www\n}\nserver web03 {}\nscript <<EOF\necho base\nEOF\n"},
+		{MergePolicy{"listen": MergeAppend, "server": MergeReplace}, []string{"listen c\nserver x {\n  root /x\n}\n"},
+			"port 80\nlisten a\nlisten b\nlisten c\nserver x {\n    root /x\n}\nscript <<EOF\necho base\nEOF\ndebug on\n"},
+		{MergePolicy{"listen": MergeByLabel}, []string{"listen b\nlisten z\nscript <<EOF\necho prod\nEOF\n", "unset server web01\nserver web02 {\n  unset root\n}\nport 1\n"},
+			"port 1\nlisten a\nlisten b\nlisten z\nserver web02 {}\nscript <<EOF\necho prod\nEOF\ndebug on\n"},
+		{nil, []string{"server web03 {\n  unset x\n  port 1\n  location / {\n    unset y\n  }\n}\n"},
+			"port 80\nlisten a\nlisten b\nserver web01 {\n    root /srv\n    tls off\n}\nserver web02 {\n    root /www\n}\nserver web03 {\n    port 1\n    location / {}\n}\nscript <<EOF\necho base\nEOF\ndebug on\n"},
+		{MergePolicy{"server": MergeReplace}, []string{"server x {\n  unset x\n}\n"},
+			"port 80\nlisten a\nlisten b\nserver x {}\nscript <<EOF\necho base\nEOF\ndebug on\n"},
+	}
+	for i, tc := range tests {
+		b, err := Parse([]byte(base))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var overlays []*Document
+		for _, o := range tc.overlays {
+			doc, err := Parse([]byte(o))
+			if err != nil {
+				t.Fatal(err)
+			}
+			overlays = append(overlays, doc)
+		}
+		doc, err := Merge(tc.policy, b, overlays...)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error %v", i, err)
+		}
+		if got := doc.Format("    "); got != tc.want {
+			t.Errorf("case %d: expected %q got %q", i, tc.want, got)
+		}
+		if got := b.Format("    "); got != base {
+			t.Errorf("case %d: base was modified: %q", i, got)
+		}
+	}
+}
+
+func TestMergeNewBlock(t *testing.T) {
+	base, _ := Parse([]byte("port 80\n"))
+	overlay, _ := Parse([]byte("server web03 {\n  unset x\n  port 1\n}\n"))
+	doc, err := Merge(nil, base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "port 80\nserver web03 {\n  port 1\n}\n"
+	if got := doc.Format("  "); got != want {
+		t.Errorf("expected %q got %q", want, got)
+	}
+
+	bad, _ := Parse([]byte("server web03 {\n  unset\n}\n"))
+	if _, err := Merge(nil, base, bad); err == nil || err.Error() != "unset requires a directive name at line 2, column 3" {
+		t.Errorf("expected unset error got %v", err)
+	}
+}
+
+func TestMergePositions(t *testing.T) {
+	p := Parser{}
+	base, _ := p.ParseFile("base.conf", []byte("server a {\n  port 80\n  host x\n}\n"))
+	prod, _ := p.ParseFile("prod.conf", []byte("\nserver a {\n  port 8080\n}\n"))
+	doc, err := Merge(nil, base, prod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := doc.Child("server")
+	tests := []struct {
+		node *Node
+		want string
+	}{
+		{server, "base.conf:1:1"},
+		{server.Child("port"), "prod.conf:3:3"},
+		{server.Child("host"), "base.conf:3:3"},
+	}
+	for i, tc := range tests {
+		if got := tc.node.Pos.String(); got != tc.want {
+			t.Errorf("case %d: expected %q got %q", i, tc.want, got)
+		}
+	}
+
+	bad, _ := Parse([]byte("\nunset\n"))
+	if _, err := Merge(nil, base, bad); err == nil || err.Error() != "unset requires a directive name at line 2, column 1" {
+		t.Errorf("expected unset error got %v", err)
+	}
+}
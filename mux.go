@@ -0,0 +1,220 @@
+package cmdconfig
+
+import (
+	"io"
+	"sort"
+	"strings"
+)
+
+// HandlerFunc handles a single command
+type HandlerFunc func(cmd *Command) error
+
+// BodyRule says if a directive takes a brace body
+type BodyRule int
+
+const (
+	BodyOptional  BodyRule = iota // a body may or may not be given
+	BodyRequired                  // the directive must have a body
+	BodyForbidden                 // the directive must not have a body
+)
+
+// Mux dispatches commands to handlers registered by directive name,
+// replacing the usual switch on Args[0] around Scanner.Next
+//
+//	mux := cmdconfig.NewMux()
+//	mux.Handle("port", func(cmd *cmdconfig.Command) error { ... }).Args(1, 1)
+//	err := mux.Parse(data)
+type Mux struct {
+	// IgnoreCase matches directive names without regard to case
+	IgnoreCase bool
+
+	routes map[string]*Route
+}
+
+// Route is a directive registered with a Mux. Its methods set the rules a
+// command must follow before the handler is called, and return the route
+// so they can be chained.
+type Route struct {
+	handler HandlerFunc
+	sub     *Mux
+	min     int
+	max     int
+	body    BodyRule
+}
+
+// NewMux returns an empty Mux. The zero value is also ready to use.
+func NewMux() *Mux {
+	return &Mux{routes: make(map[string]*Route)}
+}
+
+// Handle registers handler for the directive name, replacing any existing
+// route. The handler may be nil if the route only has a sub-mux.
+func (m *Mux) Handle(name string, handler HandlerFunc) *Route {
+	if m.routes == nil {
+		m.routes = make(map[string]*Route)
+	}
+	r := &Route{handler: handler, max: -1}
+	m.routes[name] = r
+	return r
+}
+
+// Args sets the minimum and maximum number of arguments, not counting the
+// directive name. A negative max means there is no limit.
+func (r *Route) Args(min, max int) *Route {
+	r.min, r.max = min, max
+	return r
+}
+
+// Body sets if the directive takes a brace body
+func (r *Route) Body(rule BodyRule) *Route {
+	r.body = rule
+	return r
+}
+
+// Sub dispatches the brace body of the directive to m, after the handler
+// is called
+func (r *Route) Sub(m *Mux) *Route {
+	r.sub = m
+	return r
+}
+
+// Parse dispatches each command in data
+func (m *Mux) Parse(data []byte) error {
+	return m.Run(NewScanner(data))
+}
+
+// Run dispatches each command from s until the end of input, stopping at
+// the first error. If s has error recovery enabled, errors from commands and
+// handlers are collected instead and returned as an ErrorList at the end.
+func (m *Mux) Run(s *Scanner) error {
+	if err := m.run(s); err != nil {
+		return err
+	}
+	if err := s.endErr(io.EOF); err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+func (m *Mux) run(s *Scanner) error {
+	for {
+		cmd, err := s.nextCommand()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := m.dispatch(s, cmd); err != nil {
+			if err := s.recover(err); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// RunBody dispatches each command in the brace body of cmd. It is for
+// handlers that set up state for a block, positions are those of the
+// original input. Commands built in code work too, with positions relative
+// to the body.
+func (m *Mux) RunBody(cmd *Command) error {
+	return m.Run(new(Scanner).bodyScanner(cmd))
+}
+
+func (m *Mux) dispatch(s *Scanner, cmd *Command) error {
+	if len(cmd.Args) == 0 {
+		return errorf(cmd.Pos, "block without a directive name")
+	}
+	name := cmd.Args[0]
+	r := m.lookup(name)
+	if r == nil {
+		if alt := m.suggest(name); alt != "" {
+			return errorf(cmd.Pos, "unknown directive %q, did you mean %q?", name, alt)
+		}
+		return errorf(cmd.Pos, "unknown directive %q", name)
+	}
+
+	n := len(cmd.Args) - 1
+	switch {
+	case n < r.min:
+		return errorf(cmd.Pos, "%s requires at least %d arguments, got %d", name, r.min, n)
+	case r.max >= 0 && n > r.max:
+		return errorf(cmd.ArgPos[r.max+1], "%s takes at most %d arguments, got %d", name, r.max, n)
+	case r.body == BodyRequired && !cmd.HasBody():
+		return errorf(cmd.End, "%s requires a body", name)
+	case r.body == BodyForbidden && cmd.HasBody():
+		return errorf(cmd.BodyStart, "%s does not take a body", name)
+	}
+
+	if r.handler != nil {
+		if err := r.handler(cmd); err != nil {
+			return err
+		}
+	}
+	if r.sub != nil && cmd.HasBody() {
+		return r.sub.run(s.bodyScanner(cmd))
+	}
+	return nil
+}
+
+func (m *Mux) lookup(name string) *Route {
+	if r, ok := m.routes[name]; ok {
+		return r
+	}
+	if m.IgnoreCase {
+		for key, r := range m.routes {
+			if strings.EqualFold(key, name) {
+				return r
+			}
+		}
+	}
+	return nil
+}
+
+// suggest returns the registered name closest to name, if it is close
+// enough to be a likely typo
+func (m *Mux) suggest(name string) string {
+	names := make([]string, 0, len(m.routes))
+	for key := range m.routes {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+	return closest(name, names, m.IgnoreCase)
+}
+
+// closest returns the entry of names closest to name, if it is close
+// enough to be a likely typo
+func closest(name string, names []string, ignoreCase bool) string {
+	best, bestDist := "", len(name)/3+1
+	for _, key := range names {
+		a, b := name, key
+		if ignoreCase {
+			a, b = strings.ToLower(a), strings.ToLower(b)
+		}
+		if d := levenshtein(a, b); d <= bestDist && (best == "" || d < bestDist) {
+			best, bestDist = key, d
+		}
+	}
+	return best
+}
+
+// levenshtein returns the edit distance between a and b
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
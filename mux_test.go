@@ -0,0 +1,148 @@
+package cmdconfig
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMux(t *testing.T) {
+	input := "port 8080\nserver web {\n  host example.com\n  listen a b\n}\n"
+
+	var got []string
+	record := func(cmd *Command) error {
+		got = append(got, cmd.Args...)
+		return nil
+	}
+	sub := NewMux()
+	sub.Handle("host", record).Args(1, 1)
+	sub.Handle("listen", record).Args(1, -1)
+
+	mux := NewMux()
+	mux.Handle("port", record).Args(1, 1).Body(BodyForbidden)
+	mux.Handle("server", record).Args(1, 1).Body(BodyRequired).Sub(sub)
+
+	if err := mux.Parse([]byte(input)); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	want := []string{"port", "8080", "server", "web", "host", "example.com", "listen", "a", "b"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v got %v", want, got)
+	}
+}
+
+func TestMuxErrors(t *testing.T) {
+	mux := NewMux()
+	mux.Handle("port", nil).Args(1, 1).Body(BodyForbidden)
+	mux.Handle("server", nil).Args(0, 1).Body(BodyRequired).Sub(NewMux())
+	mux.Handle("listen", nil).Args(2, -1)
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"prot 80", `unknown directive "prot", did you mean "port"? at line 1, column 1`},
+		{"xyzzy 80", `unknown directive "xyzzy" at line 1, column 1`},
+		{"Port 80", `unknown directive "Port", did you mean "port"? at line 1, column 1`},
+		{"\nport", "port requires at least 1 arguments, got 0 at line 2, column 1"},
+		{"port 80 81", "port takes at most 1 arguments, got 2 at line 1, column 9"},
+		{"port 80 {}", "port does not take a body at line 1, column 9"},
+		{"server a", "server requires a body at line 1, column 9"},
+		{"listen a", "listen requires at least 2 arguments, got 1 at line 1, column 1"},
+		{"server {\n  prot 80\n}", `unknown directive "prot" at line 2, column 3`},
+		{"{ a }", "block without a directive name at line 1, column 1"},
+	}
+	for i, tc := range tests {
+		err := mux.Parse([]byte(tc.input))
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("case %d: expected %q got %v", i, tc.want, err)
+		}
+	}
+}
+
+func TestMuxIgnoreCase(t *testing.T) {
+	count := 0
+	mux := &Mux{IgnoreCase: true}
+	mux.Handle("Port", func(cmd *Command) error {
+		count++
+		return nil
+	})
+	if err := mux.Parse([]byte("port 1\nPORT 2\nPort 3")); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if count != 3 {
+		t.Errorf("expected 3 calls got %d", count)
+	}
+	err := mux.Parse([]byte("PROT 1"))
+	if err == nil || err.Error() != `unknown directive "PROT", did you mean "Port"? at line 1, column 1` {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestMuxRunBody(t *testing.T) {
+	type server struct {
+		name, host string
+	}
+	var servers []*server
+
+	mux := NewMux()
+	mux.Handle("server", func(cmd *Command) error {
+		srv := &server{name: cmd.Args[1]}
+		servers = append(servers, srv)
+		sub := NewMux()
+		sub.Handle("host", func(cmd *Command) error {
+			srv.host = cmd.Args[1]
+			return nil
+		}).Args(1, 1)
+		return sub.RunBody(cmd)
+	}).Args(1, 1)
+
+	input := "server a {\n  host x\n}\nserver b {\n  host y\n}\nserver c {\n  host\n}"
+	err := mux.Parse([]byte(input))
+	if err == nil || err.Error() != "host requires at least 1 arguments, got 0 at line 8, column 3" {
+		t.Errorf("got %v", err)
+	}
+	if len(servers) != 3 || servers[0].host != "x" || servers[1].host != "y" {
+		t.Errorf("got %v", servers)
+	}
+
+	// commands built in code have their body scanned as well
+	var ports []string
+	sub := NewMux()
+	sub.Handle("port", func(cmd *Command) error {
+		ports = append(ports, cmd.Args[1])
+		return nil
+	})
+	err = sub.RunBody(&Command{Args: []string{"srv"}, Body: "port 80\nbogus 1\n"})
+	if err == nil || err.Error() != `unknown directive "bogus" at line 2, column 1` {
+		t.Errorf("got %v", err)
+	}
+	if len(ports) != 1 || ports[0] != "80" {
+		t.Errorf("got %v", ports)
+	}
+}
+
+func TestMuxRecover(t *testing.T) {
+	errFail := errors.New("fail")
+	mux := NewMux()
+	mux.Handle("a", nil).Args(0, 0)
+	mux.Handle("fail", func(cmd *Command) error { return errFail })
+
+	s := NewScanner([]byte("a 1\nb\na\n"))
+	s.RecoverErrors(0)
+	err := mux.Run(s)
+	var list ErrorList
+	if !errors.As(err, &list) || len(list) != 2 {
+		t.Fatalf("expected 2 errors got %v", err)
+	}
+	if list[1].Pos.Line != 2 {
+		t.Errorf("expected second error on line 2 got %v", list[1])
+	}
+
+	// errors from handlers that are not positioned stop the run
+	s = NewScanner([]byte("fail\na 1\n"))
+	s.RecoverErrors(0)
+	if err := mux.Run(s); err != errFail {
+		t.Errorf("expected errFail got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package cmdconfig
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"strconv"
@@ -35,16 +36,23 @@ func isSpace(b byte) bool     { return b == ' ' || b == '\t' }
 func isLeftBrace(b byte) bool { return b == '{' }
 func isNewLine(b byte) bool   { return b == '\n' }
 func isBackQuote(b byte) bool { return b == '`' }
+func isComment(b byte) bool   { return b == '#' }
 
 // Position represents a location in the input
 type Position struct {
-	Line   int // 1-based line number
-	Column int // 1-based column number
-	Offset int // 0-based byte offset
+	Line     int    // 1-based line number
+	Column   int    // 1-based column number
+	Offset   int    // 0-based byte offset
+	Filename string // file name, if known
 }
 
-// String returns a human-readable position
+// String returns a human-readable position. With a file name it is in the
+// file:line:column form used by compilers, which editors and CI tools turn
+// into links.
 func (p Position) String() string {
+	if p.Filename != "" {
+		return fmt.Sprintf("%s:%d:%d", p.Filename, p.Line, p.Column)
+	}
 	return fmt.Sprintf("line %d, column %d", p.Line, p.Column)
 }
 
@@ -54,16 +62,69 @@ type ScanError struct {
 	Msg string
 }
 
+// Error returns the message with its position. The position is left out
+// if it is not known, as for nodes built in code or read from JSON.
 func (e *ScanError) Error() string {
+	switch {
+	case e.Pos.Line == 0 && e.Pos.Filename != "":
+		return fmt.Sprintf("%s: %s", e.Pos.Filename, e.Msg)
+	case e.Pos.Line == 0:
+		return e.Msg
+	case e.Pos.Filename != "":
+		return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+	}
 	return fmt.Sprintf("%s at %s", e.Msg, e.Pos)
 }
 
+const (
+	// MaxBufferSize is the default maximum size of a single command,
+	// including its body, when scanning from an io.Reader
+	MaxBufferSize = 1024 * 1024
+
+	// readChunkSize is how much is requested from the reader at a time
+	readChunkSize = 4096
+)
+
+// ErrTooLong is returned by a reader based Scanner when a single command
+// does not fit in the buffer
+var ErrTooLong = errors.New("cmdconfig: command too long")
+
 type Scanner struct {
 	s          []byte
 	pos        int
 	line       int // 1-based line number
 	column     int // 1-based column number
 	baseOffset int // base offset for nested scanners
+	filename   string
+
+	// for scanners over a brace body, the position of each byte in the
+	// original input. The last entry is the closing brace.
+	posMap []Position
+
+	// the most recent brace body, used by NewFromScanner
+	lastBody string
+	lastMap  []Position
+
+	// the Body and RBrace tokens following an LBrace
+	queued []Token
+
+	// variable expansion, nil if disabled
+	lookup func(name string) (string, bool)
+
+	// an unquoted ';' ends a command
+	semicolons bool
+
+	// error recovery, errs is shared with nested scanners
+	errs      *ErrorList
+	maxErrors int
+	tokPos    int
+	tokLine   int
+	tokColumn int
+
+	// only used when reading incrementally
+	r      io.Reader
+	err    error // sticky read error, io.EOF when input is exhausted
+	maxBuf int
 }
 
 func NewScanner(in []byte) *Scanner {
@@ -76,26 +137,177 @@ func NewScanner(in []byte) *Scanner {
 	}
 }
 
-// NewFromScanner creates a new Scanner with position information inherited from parent
-// The new scanner starts at line/column 1 but tracks its offset relative to the parent's position
+// NewScannerFile creates a Scanner over data read from the file name.
+// Positions, including those of errors, carry the file name.
+func NewScannerFile(name string, data []byte) *Scanner {
+	s := NewScanner(data)
+	s.filename = name
+	return s
+}
+
+// NewReaderScanner creates a Scanner that reads its input incrementally
+// from r. Consumed input is discarded between commands, so memory use is
+// bounded by the largest single command rather than the size of the input.
+func NewReaderScanner(r io.Reader) *Scanner {
+	return &Scanner{
+		s:      make([]byte, 0, readChunkSize),
+		line:   1,
+		column: 1,
+		r:      r,
+		maxBuf: MaxBufferSize,
+	}
+}
+
+// Expand enables expansion of variable references in barewords and double
+// quoted strings, using lookup to find the value of each variable:
+//
+//	${VAR}            the value of VAR, an error if it is not set
+//	${VAR:-default}   the value of VAR, or default if it is unset or empty
+//	${VAR:?message}   the value of VAR, or an error with message if it is unset or empty
+//
+// Single and back quoted text is literal, and \$ is a literal '$'. Lookup
+// can be os.LookupEnv, or a function over a map or a secret store. Scanners
+// for brace bodies inherit it.
+func (s *Scanner) Expand(lookup func(name string) (string, bool)) {
+	s.lookup = lookup
+}
+
+// Semicolons sets if an unquoted ';' ends a command, so several commands
+// can share a line:
+//
+//	listen 80; listen 443; root /srv
+//	location / { proxy_pass a; timeout 5s }
+//
+// It is off by default, where ';' is an ordinary character. Scanners for
+// brace bodies inherit it.
+func (s *Scanner) Semicolons(on bool) {
+	s.semicolons = on
+}
+
+// Buffer sets the maximum size of a single command when reading from
+// an io.Reader. It has no effect on scanners created from a byte slice.
+func (s *Scanner) Buffer(max int) {
+	s.maxBuf = max
+}
+
+// NewFromScanner creates a new Scanner with position information, including the
+// file name, inherited from parent.
+// If in is the body most recently returned by the parent, positions reported by the
+// new scanner map exactly back to the parent's input, accounting for dedent and
+// brace escapes. Otherwise the new scanner starts at the parent's current line
+// and tracks its offset relative to the parent's position.
 func NewFromScanner(parent *Scanner, in []byte) *Scanner {
-	parentPos := parent.currentPos()
+	if parent.lastMap != nil && string(in) == parent.lastBody {
+		s := newBodyScanner(in, parent.lastMap)
+		s.lookup, s.semicolons = parent.lookup, parent.semicolons
+		return s
+	}
+	parentPos := parent.CurrentPos()
 	return &Scanner{
 		s:          in,
 		pos:        0,
+		filename:   parent.filename,
 		line:       parentPos.Line,   // Start from parent's current line
 		column:     1,                // Reset column since we're parsing new content
 		baseOffset: parentPos.Offset, // Track where this content starts in the original
+		lookup:     parent.lookup,
+		semicolons: parent.semicolons,
+	}
+}
+
+// newBodyScanner creates a Scanner over a brace body using the position
+// map returned by parseBrace
+func newBodyScanner(body []byte, posMap []Position) *Scanner {
+	start := posMap[0]
+	return &Scanner{
+		s:          body,
+		filename:   start.Filename,
+		line:       start.Line,
+		column:     start.Column,
+		baseOffset: start.Offset,
+		posMap:     posMap,
 	}
 }
 
-// currentPos returns the current position
-func (s *Scanner) currentPos() Position {
+// CurrentPos returns the current position of the scanner in the input.
+// After Next or NextCommand it is the position just past the command.
+func (s *Scanner) CurrentPos() Position {
+	if s.posMap != nil {
+		if s.pos < len(s.posMap) {
+			return s.posMap[s.pos]
+		}
+		return s.posMap[len(s.posMap)-1]
+	}
 	return Position{
-		Line:   s.line,
-		Column: s.column,
-		Offset: s.baseOffset + s.pos,
+		Line:     s.line,
+		Column:   s.column,
+		Offset:   s.baseOffset + s.pos,
+		Filename: s.filename,
+	}
+}
+
+// more reports if there is unread input, reading more from the
+// underlying reader if the buffer has been exhausted
+func (s *Scanner) more() bool {
+	for s.pos >= len(s.s) {
+		if s.r == nil || s.err != nil {
+			return false
+		}
+		s.fill()
+	}
+	return true
+}
+
+// fill reads the next chunk from the reader into the buffer
+func (s *Scanner) fill() {
+	if len(s.s) >= s.maxBuf {
+		s.err = ErrTooLong
+		return
+	}
+	if cap(s.s)-len(s.s) < readChunkSize {
+		size := 2*cap(s.s) + readChunkSize
+		if size > s.maxBuf {
+			size = s.maxBuf
+		}
+		buf := make([]byte, len(s.s), size)
+		copy(buf, s.s)
+		s.s = buf
 	}
+
+	// like bufio.Scanner, give up on readers that never make progress
+	for loop := 0; loop < 100; loop++ {
+		n, err := s.r.Read(s.s[len(s.s):cap(s.s)])
+		s.s = s.s[:len(s.s)+n]
+		if err != nil {
+			s.err = err
+			return
+		}
+		if n > 0 {
+			return
+		}
+	}
+	s.err = io.ErrNoProgress
+}
+
+// discard drops already consumed input from the buffer. It is only
+// safe to call between commands.
+func (s *Scanner) discard() {
+	if s.r == nil || s.pos == 0 {
+		return
+	}
+	n := copy(s.s, s.s[s.pos:])
+	s.s = s.s[:n]
+	s.baseOffset += s.pos
+	s.pos = 0
+}
+
+// readErr returns the underlying read error, if any, in preference to a
+// scan error, since the scan error is usually just a symptom of it
+func (s *Scanner) readErr(err error) error {
+	if s.err != nil && s.err != io.EOF {
+		return s.err
+	}
+	return err
 }
 
 // advance moves the scanner position forward by one character
@@ -113,61 +325,26 @@ func (s *Scanner) advance() {
 // errorAt creates a ScanError at the current position
 func (s *Scanner) errorAt(msg string) error {
 	return &ScanError{
-		Pos: s.currentPos(),
+		Pos: s.CurrentPos(),
 		Msg: msg,
 	}
 }
-func (s *Scanner) parseBareword() (string, error) {
-	out := ""
-	i := s.pos
-	for s.pos < len(s.s) {
-		b := s.s[s.pos]
-		switch {
-		case isSpace(b):
-			out += string(s.s[i:s.pos])
-			return out, nil
-		case isQuote1(b):
-			out += string(s.s[i:s.pos])
-			inner, err := s.parseQuote1()
-			if err != nil {
-				return out, err
-			}
-			i = s.pos
-			out += inner
-		case isQuote2(b):
-			out += string(s.s[i:s.pos])
-			inner, err := s.parseQuote2()
-			if err != nil {
-				return out, err
-			}
-			i = s.pos
-			out += inner
-		case b == '\n':
-			return out + string(s.s[i:s.pos]), nil
-		case b == '\\':
-			// Handle backslash escaping in barewords
-			out += string(s.s[i:s.pos])
-			escaped, err := s.parseBackslashEscape()
-			if err != nil {
-				return out, err
-			}
-			out += escaped
-			i = s.pos
-		default:
-			s.advance()
-		}
-	}
-	if out == "" {
-		// bareword till EOF
-		return string(s.s[i:]), nil
+
+// unterminated creates a ScanError for a quote, brace or heredoc starting
+// at start that runs to the end of the input. When recovering errors it is
+// reported at start, since every such error would otherwise be at the end.
+func (s *Scanner) unterminated(start Position, msg string) error {
+	if s.errs != nil {
+		return &ScanError{Pos: start, Msg: msg}
 	}
-	return out + string(s.s[i:]), nil
+	return s.errorAt(msg)
 }
 func (s *Scanner) parseBackQuote() (string, error) {
+	start := s.CurrentPos()
 	s.advance()
 	// first char after initial quote1
 	i := s.pos
-	for s.pos < len(s.s) {
+	for s.more() {
 		b := s.s[s.pos]
 		if b == '`' {
 			out := string(s.s[i:s.pos])
@@ -176,13 +353,14 @@ func (s *Scanner) parseBackQuote() (string, error) {
 		}
 		s.advance()
 	}
-	return "", s.errorAt("got EOF in back quote")
+	return "", s.unterminated(start, "got EOF in back quote")
 }
 func (s *Scanner) parseQuote1() (string, error) {
+	start := s.CurrentPos()
 	s.advance()
 	// first char after initial quote1
 	i := s.pos
-	for s.pos < len(s.s) {
+	for s.more() {
 		b := s.s[s.pos]
 		switch b {
 		case '\'':
@@ -193,20 +371,33 @@ func (s *Scanner) parseQuote1() (string, error) {
 			s.advance()
 		}
 	}
-	return "", s.errorAt("got EOF in single quote")
+	return "", s.unterminated(start, "got EOF in single quote")
 }
 func (s *Scanner) parseQuote2() (string, error) {
+	start := s.CurrentPos()
 	s.advance()
 	// first char after initial quote1
 	i := s.pos
 	out := ""
-	for s.pos < len(s.s) {
+	for s.more() {
 		b := s.s[s.pos]
 		switch b {
 		case '"':
 			out += string(s.s[i:s.pos])
 			s.advance()
 			return out, nil
+		case '$':
+			if s.lookup == nil {
+				s.advance()
+				continue
+			}
+			out += string(s.s[i:s.pos])
+			value, err := s.parseVar()
+			if err != nil {
+				return out, err
+			}
+			out += value
+			i = s.pos
 		case '\\':
 			// Handle backslash escaping in double quotes
 			out += string(s.s[i:s.pos])
@@ -220,19 +411,86 @@ func (s *Scanner) parseQuote2() (string, error) {
 			s.advance()
 		}
 	}
-	return "", s.errorAt("got EOF in double quote")
+	return "", s.unterminated(start, "got EOF in double quote")
+}
+
+// parseVar expands a ${...} variable reference, see Expand. A '$' not
+// followed by '{' is returned as is.
+func (s *Scanner) parseVar() (string, error) {
+	start := s.CurrentPos()
+	s.advance()
+	if !s.more() || s.s[s.pos] != '{' {
+		return "$", nil
+	}
+	s.advance()
+	i := s.pos
+	for s.more() && s.s[s.pos] != '}' && !isNewLine(s.s[s.pos]) {
+		s.advance()
+	}
+	if !s.more() || s.s[s.pos] != '}' {
+		return "", &ScanError{Pos: start, Msg: "unterminated variable reference"}
+	}
+	ref := string(s.s[i:s.pos])
+	s.advance()
+
+	name, op, arg := ref, "", ""
+	if j := strings.IndexByte(ref, ':'); j >= 0 {
+		name, op, arg = ref[:j], ref[j:min(j+2, len(ref))], ref[min(j+2, len(ref)):]
+	}
+	if !isVarName(name) || (op != "" && op != ":-" && op != ":?") {
+		return "", &ScanError{Pos: start, Msg: fmt.Sprintf("bad variable reference ${%s}", ref)}
+	}
+
+	value, ok := s.lookup(name)
+	switch {
+	case op == "" && !ok:
+		return "", &ScanError{Pos: start, Msg: fmt.Sprintf("undefined variable %q", name)}
+	case op == ":-" && value == "":
+		return arg, nil
+	case op == ":?" && value == "":
+		if arg == "" {
+			arg = "not set"
+		}
+		return "", &ScanError{Pos: start, Msg: name + ": " + arg}
+	}
+	return value, nil
+}
+
+// isVarName reports if name is a letter or underscore followed by letters,
+// digits and underscores
+func isVarName(name string) bool {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isWordChar(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isWordChar(b byte) bool {
+	return b == '_' || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9')
+}
+
+// skipComment consumes a '#' comment up to, but not including, the newline
+func (s *Scanner) skipComment() {
+	for s.more() && !isNewLine(s.s[s.pos]) {
+		s.advance()
+	}
 }
 
 // parseBackslashEscape handles backslash escaping for barewords and double quotes
 func (s *Scanner) parseBackslashEscape() (string, error) {
-	if s.pos >= len(s.s) {
+	if !s.more() {
 		return "", s.errorAt("got EOF after backslash")
 	}
 
 	// Skip the backslash
 	s.advance()
 
-	if s.pos >= len(s.s) {
+	if !s.more() {
 		return "", s.errorAt("got EOF after backslash")
 	}
 
@@ -263,14 +521,14 @@ func (s *Scanner) parseBackslashEscape() (string, error) {
 
 // parseBraceEscape handles minimal escaping for brace content (only braces and backslashes)
 func (s *Scanner) parseBraceEscape() (string, error) {
-	if s.pos >= len(s.s) {
+	if !s.more() {
 		return "", s.errorAt("got EOF after backslash")
 	}
 
 	// Skip the backslash
 	s.advance()
 
-	if s.pos >= len(s.s) {
+	if !s.more() {
 		return "", s.errorAt("got EOF after backslash")
 	}
 
@@ -291,43 +549,98 @@ func (s *Scanner) parseBraceEscape() (string, error) {
 	}
 }
 
-func (s *Scanner) parseBrace() (string, error) {
+// parseBrace returns the body of a brace block along with a map from each
+// byte of the body to its position in the input. The map has one extra
+// entry at the end for the closing brace.
+func (s *Scanner) parseBrace() (string, []Position, error) {
+	start := s.CurrentPos()
 	// skip opening brace
 	s.advance()
 	// first char after opening '{'
 	i := s.pos
 	out := ""
+	posMap := []Position{}
 	stack := 1
+	// the quote the body is in, if any. Quotes only decide what starts a
+	// comment or heredoc, braces count either way.
+	var quote byte
 
-	for s.pos < len(s.s) {
+	for s.more() {
 		b := s.s[s.pos]
 		switch b {
 		case '\\':
 			// Handle minimal backslash escaping in braces
 			out += string(s.s[i:s.pos])
+			bpos := s.CurrentPos()
 			escaped, err := s.parseBraceEscape()
 			if err != nil {
-				return out, err
+				return out, posMap, err
 			}
 			out += escaped
+			if quote == '\'' && escaped == "\\'" {
+				// a backslash is literal in single quotes
+				quote = 0
+			}
+			// an unescaped character maps to its backslash, so every byte
+			// of the input is covered by the map
+			posMap = append(posMap, bpos)
+			if len(escaped) == 2 {
+				// the escaped character follows the backslash on the same line
+				next := bpos
+				next.Column++
+				next.Offset++
+				posMap = append(posMap, next)
+			}
 			i = s.pos
+			continue
+		case '\'', '"', '`':
+			if quote == 0 {
+				quote = b
+			} else if quote == b {
+				quote = 0
+			}
+		case '<':
+			if prev := s.s[s.pos-1]; quote == 0 && (isSpace(prev) || isNewLine(prev) || prev == '{') && s.heredocLen() > 0 {
+				// copy heredocs as they are, they need not balance
+				pos, line, column := s.pos, s.line, s.column
+				if _, _, _, err := s.parseHeredoc(); err != nil {
+					return "", nil, err
+				}
+				end := s.pos
+				s.pos, s.line, s.column = pos, line, column
+				for s.pos < end {
+					posMap = append(posMap, s.CurrentPos())
+					s.advance()
+				}
+				continue
+			}
+		case '#':
+			if prev := s.s[s.pos-1]; quote == 0 && (isSpace(prev) || isNewLine(prev) || prev == '{') {
+				// copy comments as they are, braces in them do not count
+				for s.more() && !isNewLine(s.s[s.pos]) {
+					posMap = append(posMap, s.CurrentPos())
+					s.advance()
+				}
+				continue
+			}
 		case '{':
 			stack += 1
-			s.advance()
 		case '}':
 			stack -= 1
 			if stack == 0 {
 				out += string(s.s[i:s.pos])
+				posMap = append(posMap, s.CurrentPos())
 				s.advance()
 				// Apply dedent to remove common leading whitespace
-				return dedent(out), nil
+				body, posMap := dedentMap(out, posMap)
+				s.lastBody, s.lastMap = body, posMap
+				return body, posMap, nil
 			}
-			s.advance()
-		default:
-			s.advance()
 		}
+		posMap = append(posMap, s.CurrentPos())
+		s.advance()
 	}
-	return "", s.errorAt("got EOF in opening brace")
+	return "", nil, s.unterminated(start, "got EOF in opening brace")
 }
 
 // Next returns the arguments and the optional body, along with an error if any.
@@ -338,47 +651,178 @@ func (s *Scanner) parseBrace() (string, error) {
 // ex: foo bar
 //
 //	--> []stirng{"foo", "bar"}, ""
+//
+// With RecoverErrors, commands containing errors are skipped and the errors
+// are returned as an ErrorList at the end of the input in place of io.EOF.
 func (s *Scanner) Next() ([]string, string, error) {
-	args := []string{}
-	body := ""
+	cmd := Command{}
+	err := s.endErr(s.next(&cmd))
+	if err == io.EOF {
+		return nil, "", io.EOF
+	}
+	return cmd.Args, cmd.Body, err
+}
 
-	arg := ""
-	var err error
+// NextCommand is like Next but also returns the positions of the
+// command, each of its arguments and its body.
+// At the end of the input it returns nil and io.EOF.
+func (s *Scanner) NextCommand() (*Command, error) {
+	cmd, err := s.nextCommand()
+	return cmd, s.endErr(err)
+}
 
-	for s.pos < len(s.s) {
-		b := s.s[s.pos]
-		switch {
-		case isSpace(b):
-			s.advance()
-		case isBareword(b) || isQuote1(b) || isQuote2(b) || b == '\\':
-			arg, err = s.parseBareword()
-			if err != nil {
-				return args, body, err
+// nextCommand is NextCommand without replacing io.EOF by the collected
+// errors, for use on nested scanners sharing an ErrorList
+func (s *Scanner) nextCommand() (*Command, error) {
+	cmd := &Command{}
+	if err := s.next(cmd); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+// RecoverErrors enables error recovery. After an error the scanner skips
+// the rest of the line the bad token started on and continues with the
+// next command. Errors inside a brace body skip to its closing brace.
+// Scanning stops once max errors have been collected, max <= 0 means
+// there is no limit. Quotes, braces and heredocs that run to the end of the
+// input are reported where they start rather than at the end.
+func (s *Scanner) RecoverErrors(max int) {
+	s.errs = &ErrorList{}
+	s.maxErrors = max
+}
+
+// endErr replaces io.EOF with the collected errors, if any
+func (s *Scanner) endErr(err error) error {
+	if err == io.EOF && s.errs != nil && len(*s.errs) > 0 {
+		s.errs.Sort()
+		return *s.errs
+	}
+	return err
+}
+
+// recover records err if error recovery is enabled and err is a single
+// *ScanError. It returns nil if scanning can continue, otherwise err or
+// the collected errors once the limit is reached.
+func (s *Scanner) recover(err error) error {
+	scanErr, ok := err.(*ScanError)
+	if !ok || s.errs == nil {
+		return err
+	}
+	s.errs.Add(scanErr.Pos, scanErr.Msg)
+	if s.maxErrors > 0 && len(*s.errs) >= s.maxErrors {
+		s.errs.Sort()
+		return *s.errs
+	}
+	return nil
+}
+
+// next scans the next command into cmd, recovering from errors if enabled
+func (s *Scanner) next(cmd *Command) error {
+	for {
+		err := s.scanCommand(cmd)
+		if err == nil {
+			return nil
+		}
+		if err := s.recover(err); err != nil {
+			return err
+		}
+		s.resync()
+		*cmd = Command{}
+	}
+}
+
+// mark records the start of a token for resync
+func (s *Scanner) mark() {
+	s.tokPos, s.tokLine, s.tokColumn = s.pos, s.line, s.column
+}
+
+// resync moves back to the start of the last token and skips to the
+// end of its line
+func (s *Scanner) resync() {
+	s.pos, s.line, s.column = s.tokPos, s.tokLine, s.tokColumn
+	s.advance()
+	for s.more() && !isNewLine(s.s[s.pos]) {
+		s.advance()
+	}
+}
+
+// scanCommand scans the next command into cmd, joining adjacent word
+// tokens into arguments
+func (s *Scanner) scanCommand(cmd *Command) error {
+	cmd.Args = []string{}
+
+	s.discard()
+	var arg strings.Builder
+	var argPos Position
+	word := false // in the middle of an argument
+	for {
+		tok, err := s.token(word)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return s.readErr(err)
+		}
+		if tok.Kind.isWord() || (word && tok.Kind == TokenLineContinuation) {
+			if !word {
+				argPos = tok.Pos
+				word = true
 			}
-			args = append(args, arg)
-		case isBackQuote(b):
-			arg, err = s.parseBackQuote()
-			if err != nil {
-				return args, body, err
+			arg.WriteString(tok.Value)
+			cmd.End = tok.End
+			continue
+		}
+		if word {
+			cmd.addArg(arg.String(), argPos)
+			arg.Reset()
+			word = false
+		}
+
+		switch tok.Kind {
+		case TokenBackQuoted:
+			cmd.addArg(tok.Value, tok.Pos)
+			cmd.End = tok.End
+		case TokenNewline, TokenSemicolon:
+			// ends the command, or an empty one
+			if len(cmd.Args) > 0 {
+				return nil
 			}
-			args = append(args, arg)
-		case isLeftBrace(b):
-			body, err = s.parseBrace()
-			return args, body, err
-		case isNewLine(b):
-			s.advance()
-			if len(args) > 0 {
-				return args, body, nil
+			s.discard()
+		case TokenWhitespace, TokenComment:
+			// blank lines and comments before a command do not count
+			// against the buffer size
+			if len(cmd.Args) == 0 {
+				s.discard()
+			}
+		case TokenHeredoc, TokenLBrace:
+			cmd.BodyStart = tok.Pos
+			if len(cmd.Args) == 0 {
+				cmd.Pos = cmd.BodyStart
 			}
+			if tok.Kind == TokenLBrace {
+				tok, _ = s.token(false)
+				s.token(false)
+			}
+			cmd.Body, cmd.bodyMap, cmd.Heredoc = tok.Value, tok.posMap, tok.delim
+			cmd.BodyEnd = s.CurrentPos()
+			cmd.End = cmd.BodyEnd
+			return nil
 		}
-		// TODO: # comments
+	}
+	if word {
+		cmd.addArg(arg.String(), argPos)
+	}
+
+	if err := s.readErr(nil); err != nil {
+		return err
 	}
 
 	// nothing to do.. end of file
-	if len(args) == 0 {
-		return nil, "", io.EOF
+	if len(cmd.Args) == 0 {
+		return io.EOF
 	}
-	return args, "", nil
+	return nil
 }
 
 // isBarewordString checks if a string can be represented as a bareword (no quotes needed)
@@ -386,6 +830,12 @@ func isBarewordString(s string) bool {
 	if s == "" {
 		return false // empty strings need quotes
 	}
+	if isComment(s[0]) {
+		return false // would be read back as a comment
+	}
+	if NewScanner([]byte(s)).heredocLen() > 0 {
+		return false // would be read back as a heredoc marker
+	}
 
 	for i := 0; i < len(s); i++ {
 		b := s[i]
@@ -397,6 +847,12 @@ func isBarewordString(s string) bool {
 	return true
 }
 
+// IsBareword reports if s reads back unchanged without quotes, in which
+// case Format writes it as is
+func IsBareword(s string) bool {
+	return isBarewordString(s)
+}
+
 // quoteArg quotes an argument, handling braces that strconv.Quote doesn't escape
 func quoteArg(s string) string {
 	// Check if it contains braces that need escaping
@@ -441,6 +897,32 @@ func quoteArg(s string) string {
 	return strconv.Quote(s)
 }
 
+// formatArg returns arg as a bareword if possible, otherwise quoted. Args
+// with a ';' are quoted so the output also reads back with semicolons.
+func formatArg(arg string) string {
+	if isBarewordString(arg) && strings.IndexByte(arg, ';') < 0 {
+		return arg
+	}
+	return quoteArg(arg)
+}
+
+// escapeBrace escapes s so that it is read back unchanged from inside
+// a brace body, the inverse of parseBraceEscape
+func escapeBrace(s string) string {
+	if !strings.ContainsAny(s, "\\{}") {
+		return s
+	}
+	result := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\', '{', '}':
+			result.WriteByte('\\')
+		}
+		result.WriteByte(s[i])
+	}
+	return result.String()
+}
+
 // FormatIndent takes parsed arguments and body and returns a formatted command string
 // with each line of the body indented by the given prefix string
 func FormatIndent(args []string, body string, indent string) string {
@@ -448,16 +930,16 @@ func FormatIndent(args []string, body string, indent string) string {
 
 	// Format arguments
 	for _, arg := range args {
-		if isBarewordString(arg) {
-			parts = append(parts, arg)
-		} else {
-			parts = append(parts, quoteArg(arg))
-		}
+		parts = append(parts, formatArg(arg))
 	}
 
 	result := strings.Join(parts, " ")
 
-	// Add body if present
+	// Add body if present, as a heredoc if it would not read back from
+	// inside braces
+	if body != "" && !braceSafe(body) {
+		return result + " " + formatHeredoc(body)
+	}
 	if body != "" {
 		result += " {\n"
 
@@ -482,23 +964,74 @@ func FormatIndent(args []string, body string, indent string) string {
 // This implements a heuristic approach: only dedent if ALL non-empty lines
 // share the same leading whitespace prefix
 func dedent(s string) string {
+	out, _ := dedentMap(s, nil)
+	return out
+}
+
+// dedentMap is dedent that also removes the entries in posMap for the
+// removed whitespace. posMap may be nil.
+func dedentMap(s string, posMap []Position) (string, []Position) {
 	if s == "" {
-		return s
+		return s, posMap
 	}
 
 	lines := strings.Split(s, "\n")
 	if len(lines) <= 1 {
-		return s
+		return s, posMap
+	}
+	return stripIndent(lines, commonIndent(lines), posMap)
+}
+
+// stripIndent removes commonPrefix from the start of each non-empty line,
+// along with its entries in posMap, and joins the lines. posMap may be nil.
+func stripIndent(lines []string, commonPrefix string, posMap []Position) (string, []Position) {
+	// If no common prefix, return as-is
+	if commonPrefix == "" {
+		return strings.Join(lines, "\n"), posMap
 	}
 
+	// Remove common prefix from all lines
+	result := make([]string, len(lines))
+	prefixLen := len(commonPrefix)
+	var newMap []Position
+	offset := 0
+
+	for i, line := range lines {
+		skip := 0
+		if strings.TrimSpace(line) == "" {
+			// Keep empty lines as-is
+			result[i] = line
+		} else if len(line) >= prefixLen && line[:prefixLen] == commonPrefix {
+			// Remove common prefix
+			result[i] = line[prefixLen:]
+			skip = prefixLen
+		} else {
+			// This shouldn't happen if our logic is correct, but be safe
+			result[i] = line
+		}
+		if posMap != nil {
+			// positions for the line and its newline, minus the prefix
+			end := offset + len(line) + 1
+			newMap = append(newMap, posMap[offset+skip:end]...)
+			offset = end
+		}
+	}
+	if posMap != nil {
+		// the newline count and trailing entry line up, the last line
+		// took the closing brace entry as its "newline"
+		posMap = newMap
+	}
+
+	return strings.Join(result, "\n"), posMap
+}
+
+// commonIndent returns the leading whitespace shared by all non-empty lines
+func commonIndent(lines []string) string {
 	// Find non-empty lines and their leading whitespace
-	var nonEmptyLines []string
 	var leadingWhitespace []string
 
 	for _, line := range lines {
 		if strings.TrimSpace(line) != "" {
-			nonEmptyLines = append(nonEmptyLines, line)
-
 			// Extract leading whitespace
 			leadingWS := ""
 			for _, char := range line {
@@ -512,9 +1045,9 @@ func dedent(s string) string {
 		}
 	}
 
-	// If no non-empty lines, return as-is
-	if len(nonEmptyLines) == 0 {
-		return s
+	// If no non-empty lines, there is nothing in common
+	if len(leadingWhitespace) == 0 {
+		return ""
 	}
 
 	// Find the shortest common prefix among all leading whitespace
@@ -536,30 +1069,7 @@ func dedent(s string) string {
 		}
 		commonPrefix = newCommon
 	}
-
-	// If no common prefix, return as-is
-	if commonPrefix == "" {
-		return s
-	}
-
-	// Remove common prefix from all lines
-	result := make([]string, len(lines))
-	prefixLen := len(commonPrefix)
-
-	for i, line := range lines {
-		if strings.TrimSpace(line) == "" {
-			// Keep empty lines as-is
-			result[i] = line
-		} else if len(line) >= prefixLen && line[:prefixLen] == commonPrefix {
-			// Remove common prefix
-			result[i] = line[prefixLen:]
-		} else {
-			// This shouldn't happen if our logic is correct, but be safe
-			result[i] = line
-		}
-	}
-
-	return strings.Join(result, "\n")
+	return commonPrefix
 }
 
 // Format takes parsed arguments and body and returns a formatted command string
@@ -1,8 +1,13 @@
 package cmdconfig
 
 import (
+	"bytes"
+	"errors"
+	"io"
 	"reflect"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 func TestParse(t *testing.T) {
@@ -213,6 +218,50 @@ func TestParse(t *testing.T) {
 			args:  []string{"cmd"},
 			body:  " outer { inner } still inner } ",
 		},
+		{
+			// whole-line comment before command
+			input: "# a comment\nport 8080",
+			args:  []string{"port", "8080"},
+		},
+		{
+			// trailing comment
+			input: "port 8080 # http\nnext",
+			args:  []string{"port", "8080"},
+		},
+		{
+			// '#' inside a word is not a comment
+			input: "color a#b",
+			args:  []string{"color", "a#b"},
+		},
+		{
+			// quoted and escaped '#' are literal
+			input: `tag '#one' "#two" ` + "`#three` \\#four",
+			args:  []string{"tag", "#one", "#two", "#three", "#four"},
+		},
+		{
+			// comments inside brace body are passed through
+			input: "cmd { # inner\n a b }",
+			args:  []string{"cmd"},
+			body:  "# inner\na b ",
+		},
+		{
+			// braces in comments inside a body do not count
+			input: "server {\n  # a } note\n  port 80 # {\n}\nnext",
+			args:  []string{"server"},
+			body:  "\n# a } note\nport 80 # {\n",
+		},
+		{
+			// '#' in quotes inside a body is not a comment
+			input: "x { echo 'hi #1' \"#2\" `a #3` }\ny 1\n",
+			args:  []string{"x"},
+			body:  " echo 'hi #1' \"#2\" `a #3` ",
+		},
+		{
+			// a backslash does not escape a single quote
+			input: "x { a 'b\\' # }\n}\ny 1\n",
+			args:  []string{"x"},
+			body:  "a 'b\\' # }\n",
+		},
 	}
 
 	for i, tc := range tests {
@@ -338,6 +387,16 @@ func TestEdgeCases(t *testing.T) {
 			input: "single",
 			args:  []string{"single"},
 		},
+		{
+			// only comments
+			input: "# one\n  # two\n",
+			args:  nil,
+		},
+		{
+			// comment at EOF without newline
+			input: "cmd arg # done",
+			args:  []string{"cmd", "arg"},
+		},
 	}
 
 	for i, tc := range tests {
@@ -466,6 +525,16 @@ func TestRoundTrip(t *testing.T) {
 			args: []string{"path"},
 			body: "C:\\Windows\\System32",
 		},
+		{
+			name: "args starting with comment",
+			args: []string{"tag", "#one", "a#b"},
+			body: "",
+		},
+		{
+			name: "args like heredoc markers",
+			args: []string{"cmd", "<<EOF", "<<-END#x", "<<1"},
+			body: "",
+		},
 		{
 			name: "args with braces",
 			args: []string{"complex", "arg{with}braces"},
@@ -691,6 +760,21 @@ func TestDedent(t *testing.T) {
 				t.Errorf("dedent failed.\nInput: %q\nExpected: %q\nGot: %q",
 					tc.input, tc.expected, result)
 			}
+
+			// the position map must stay aligned with the result
+			posMap := make([]Position, len(tc.input)+1)
+			for i := range posMap {
+				posMap[i].Offset = i
+			}
+			_, posMap = dedentMap(tc.input, posMap)
+			if len(posMap) != len(result)+1 {
+				t.Fatalf("expected %d positions got %d", len(result)+1, len(posMap))
+			}
+			for i := 0; i < len(result); i++ {
+				if tc.input[posMap[i].Offset] != result[i] {
+					t.Errorf("position %d maps to %q, expected %q", i, tc.input[posMap[i].Offset], result[i])
+				}
+			}
 		})
 	}
 }
@@ -722,7 +806,7 @@ func TestNestedScannerPositions(t *testing.T) {
 	nestedScanner := NewFromScanner(parentScanner, []byte(body2))
 
 	// The nested scanner should start with line 2 (where the brace block was)
-	pos := nestedScanner.currentPos()
+	pos := nestedScanner.CurrentPos()
 	if pos.Line != 2 {
 		t.Errorf("Expected nested scanner to start at line 2, got line %d", pos.Line)
 	}
@@ -854,3 +938,303 @@ func TestPositionTracking(t *testing.T) {
 		t.Fatalf("expected [line3] but got %v", args3)
 	}
 }
+
+func TestReaderScanner(t *testing.T) {
+	input := strings.Repeat("name 'John' \"Brown\" # comment\n"+
+		"echo a\\ b \"say \\\"hi\\\"\" `back\nquote`\n"+
+		"long arg1 arg2 \\\n  arg3\n"+
+		"server web01 {\n  host \\{x\\}\n  nested { deep }\n}\n\n", 200)
+
+	readers := map[string]func(io.Reader) io.Reader{
+		"one byte": iotest.OneByteReader,
+		"half":     iotest.HalfReader,
+		"full":     func(r io.Reader) io.Reader { return r },
+	}
+
+	for name, wrap := range readers {
+		t.Run(name, func(t *testing.T) {
+			want := NewScanner([]byte(input))
+			got := NewReaderScanner(wrap(strings.NewReader(input)))
+			for n := 0; ; n++ {
+				wantArgs, wantBody, wantErr := want.Next()
+				gotArgs, gotBody, gotErr := got.Next()
+				if wantErr != gotErr {
+					t.Fatalf("command %d, expected error %v got %v", n, wantErr, gotErr)
+				}
+				if wantErr == io.EOF {
+					break
+				}
+				if !reflect.DeepEqual(wantArgs, gotArgs) || wantBody != gotBody {
+					t.Fatalf("command %d, expected %q %q got %q %q", n, wantArgs, wantBody, gotArgs, gotBody)
+				}
+				if want.CurrentPos() != got.CurrentPos() {
+					t.Fatalf("command %d, expected position %v got %v", n, want.CurrentPos(), got.CurrentPos())
+				}
+			}
+			if len(got.s) > 4*readChunkSize {
+				t.Errorf("buffer grew to %d bytes", len(got.s))
+			}
+		})
+	}
+}
+
+func TestReaderScannerErrors(t *testing.T) {
+	// scan errors keep their position
+	s := NewReaderScanner(iotest.OneByteReader(strings.NewReader("ok\n\n'unclosed")))
+	if _, _, err := s.Next(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, _, err := s.Next()
+	var scanErr *ScanError
+	if !errors.As(err, &scanErr) {
+		t.Fatalf("expected *ScanError got %T: %v", err, err)
+	}
+	if scanErr.Pos != (Position{Line: 3, Column: 10, Offset: 13}) {
+		t.Errorf("unexpected position %v", scanErr.Pos)
+	}
+
+	// read errors are returned as-is
+	boom := errors.New("boom")
+	s = NewReaderScanner(io.MultiReader(strings.NewReader("cmd 'arg"), iotest.ErrReader(boom)))
+	if _, _, err := s.Next(); err != boom {
+		t.Errorf("expected read error, got %v", err)
+	}
+
+	// a single command larger than the buffer
+	s = NewReaderScanner(bytes.NewReader([]byte("cmd " + strings.Repeat("x", 100))))
+	s.Buffer(64)
+	if _, _, err := s.Next(); err != ErrTooLong {
+		t.Errorf("expected ErrTooLong, got %v", err)
+	}
+
+	// comments and blank lines before a command are not part of it
+	header := strings.Repeat("# generated, do not edit\n\n   \n", 1000)
+	s = NewReaderScanner(strings.NewReader(header + "port 80\n"))
+	s.Buffer(64)
+	if args, _, err := s.Next(); err != nil || !equalStringSlices(args, []string{"port", "80"}) {
+		t.Errorf("expected [port 80], got %v %v", args, err)
+	}
+}
+
+func TestNestedScannerErrorPositions(t *testing.T) {
+	type test struct {
+		input string
+		pos   Position // of the error in the innermost body
+	}
+
+	tests := []test{
+		{
+			// dedented body, error on the third line of the file
+			input: "server web01 {\n    host a\n    port 'unclosed\n}",
+			pos:   Position{Line: 4, Column: 1, Offset: 45},
+		},
+		{
+			// brace escapes before the error are accounted for
+			input: "cmd {\n  a \\{ \\\\ b \\} c\n  \\\\x\"\n}",
+			pos:   Position{Line: 4, Column: 1, Offset: 30},
+		},
+	}
+
+	for i, tc := range tests {
+		parent := NewScanner([]byte(tc.input))
+		_, body, err := parent.Next()
+		if err != nil {
+			t.Fatalf("case %d, got error %v", i, err)
+		}
+		nested := NewFromScanner(parent, []byte(body))
+		var scanErr *ScanError
+		for err == nil {
+			_, _, err = nested.Next()
+		}
+		if !errors.As(err, &scanErr) {
+			t.Fatalf("case %d, expected *ScanError got %v", i, err)
+		}
+		if scanErr.Pos != tc.pos {
+			t.Errorf("case %d, expected error at %+v got %+v", i, tc.pos, scanErr.Pos)
+		}
+	}
+}
+
+func TestNestedScannerArgPositions(t *testing.T) {
+	input := "http {\n  server web01 {\n\tlisten x\\\\\\{80\\\\\\}\n\troot /srv\n  }\n}\n"
+	s := NewScanner([]byte(input))
+	_, body, _ := s.Next()
+
+	s = NewFromScanner(s, []byte(body))
+	_, body, _ = s.Next()
+
+	s = NewFromScanner(s, []byte(body))
+	for _, want := range []struct {
+		name string
+		pos  []Position
+	}{
+		{"listen", []Position{{Line: 3, Column: 2, Offset: 25}, {Line: 3, Column: 9, Offset: 32}}},
+		{"root", []Position{{Line: 4, Column: 2, Offset: 45}, {Line: 4, Column: 7, Offset: 50}}},
+	} {
+		cmd, err := s.NextCommand()
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if cmd.Name() != want.name {
+			t.Fatalf("expected %s got %v", want.name, cmd.Args)
+		}
+		if !reflect.DeepEqual(cmd.ArgPos, want.pos) {
+			t.Errorf("%s, expected %+v got %+v", want.name, want.pos, cmd.ArgPos)
+		}
+		if cmd.Name() == "listen" && cmd.Args[1] != "x{80}" {
+			t.Errorf("expected x{80} got %q", cmd.Args[1])
+		}
+		if !strings.HasPrefix(input[cmd.ArgPos[0].Offset:], want.name) {
+			t.Errorf("%s, offset does not point at the argument", want.name)
+		}
+	}
+}
+
+func TestScannerFile(t *testing.T) {
+	input := "server web {\n  host 'x\n}\n"
+	s := NewScannerFile("conf/app.conf", []byte(input))
+	_, body, err := s.Next()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// the body scanner maps back to the file
+	nested := NewFromScanner(s, []byte(body))
+	_, _, err = nested.Next()
+	if err == nil || err.Error() != "conf/app.conf:3:1: got EOF in single quote" {
+		t.Errorf("got %v", err)
+	}
+
+	// so does a scanner over unrelated text
+	nested = NewFromScanner(s, []byte("a b"))
+	cmd, err := nested.NextCommand()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got := cmd.Pos.String(); got != "conf/app.conf:3:1" {
+		t.Errorf("expected conf/app.conf:3:1 got %s", got)
+	}
+
+	// without a file name positions are unchanged
+	pos := Position{Line: 2, Column: 8}
+	if got := pos.String(); got != "line 2, column 8" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	vars := map[string]string{"HOST": "example.com", "PORT": "8080", "EMPTY": ""}
+	lookup := func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+
+	tests := []struct {
+		input string
+		want  []string
+		err   string
+	}{
+		{"listen ${HOST}:${PORT}", []string{"listen", "example.com:8080"}, ""},
+		{`url "http://${HOST}/a b"`, []string{"url", "http://example.com/a b"}, ""},
+		{"a '${HOST}' `${HOST}`", []string{"a", "${HOST}", "${HOST}"}, ""},
+		{`a \${HOST} "\${HOST}" $HOST $`, []string{"a", "${HOST}", "${HOST}", "$HOST", "$"}, ""},
+		{"a ${MISSING:-default value} ${EMPTY:-x} ${PORT:-1}", []string{"a", "default value", "x", "8080"}, ""},
+		{"a ${PORT:?port required}", []string{"a", "8080"}, ""},
+		{"a\nb ${MISSING}", nil, `undefined variable "MISSING" at line 2, column 3`},
+		{"a ${EMPTY:?must be set}", nil, "EMPTY: must be set at line 1, column 3"},
+		{"a ${MISSING:?}", nil, "MISSING: not set at line 1, column 3"},
+		{"a x${HOST", nil, "unterminated variable reference at line 1, column 4"},
+		{"a ${1X}", nil, "bad variable reference ${1X} at line 1, column 3"},
+		{"a ${X:+y}", nil, "bad variable reference ${X:+y} at line 1, column 3"},
+	}
+	for i, tc := range tests {
+		s := NewScanner([]byte(tc.input))
+		s.Expand(lookup)
+		args, _, err := s.Next()
+		for err == nil && tc.err != "" {
+			// errors may be on a later command
+			_, _, err = s.Next()
+		}
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("case %d: expected error %q got %v", i, tc.err, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(args, tc.want) {
+			t.Errorf("case %d: expected %q got %q, %v", i, tc.want, args, err)
+		}
+	}
+
+	// nested bodies are expanded with positions in the original input
+	p := Parser{Lookup: lookup}
+	doc, err := p.Parse([]byte("server {\n  listen ${PORT}\n  root ${ROOT}\n}\n"))
+	if err == nil || err.Error() != `undefined variable "ROOT" at line 3, column 8` {
+		t.Errorf("got %v", err)
+	}
+	doc, err = p.Parse([]byte("server {\n  listen ${PORT}\n}\n"))
+	if err != nil || doc.Child("server").Child("listen").Args[1] != "8080" {
+		t.Errorf("got %v", err)
+	}
+
+	// without Expand references are kept as written
+	args, _, _ := NewScanner([]byte("a ${HOST}")).Next()
+	if args[1] != "${HOST}" {
+		t.Errorf("got %q", args[1])
+	}
+}
+
+func TestSemicolons(t *testing.T) {
+	input := "listen 80; listen 443;root /srv\n;; location / { proxy_pass a; timeout 5s }; x 'a;b' \"c;d\" e\\;f\nlast"
+	s := NewScanner([]byte(input))
+	s.Semicolons(true)
+
+	var got [][]string
+	for {
+		args, body, err := s.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("got error %v", err)
+		}
+		got = append(got, args)
+		if body != "" {
+			inner := NewFromScanner(s, []byte(body))
+			for {
+				args, _, err := inner.Next()
+				if err != nil {
+					break
+				}
+				got = append(got, append([]string{">"}, args...))
+			}
+		}
+	}
+	want := [][]string{
+		{"listen", "80"},
+		{"listen", "443"},
+		{"root", "/srv"},
+		{"location", "/"},
+		{">", "proxy_pass", "a"},
+		{">", "timeout", "5s"},
+		{"x", "a;b", "c;d", "e;f"},
+		{"last"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q got %q", want, got)
+	}
+
+	// formatted args read back the same with semicolons on
+	args := []string{"x", "a;b", "c;"}
+	s = NewScanner([]byte(Format(args, "")))
+	s.Semicolons(true)
+	if got, _, err := s.Next(); err != nil || !reflect.DeepEqual(got, args) {
+		t.Errorf("expected %q got %q %v", args, got, err)
+	}
+
+	// off by default
+	args, _, _ = NewScanner([]byte("listen 80; listen 443")).Next()
+	if want := []string{"listen", "80;", "listen", "443"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("expected %q got %q", want, args)
+	}
+}
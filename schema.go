@@ -0,0 +1,402 @@
+package cmdconfig
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ArgType is the type of an argument in a Schema. Each type other than
+// TypeString is checked with the Command accessor of the same name.
+type ArgType string
+
+const (
+	TypeString   ArgType = "string"
+	TypeInt      ArgType = "int"
+	TypeUint16   ArgType = "uint16"
+	TypeBool     ArgType = "bool"
+	TypeDuration ArgType = "duration"
+	TypeFloat    ArgType = "float"
+	TypeBytes    ArgType = "bytes"
+	TypeURL      ArgType = "url"
+	TypeIP       ArgType = "ip"
+	TypeCIDR     ArgType = "cidr"
+)
+
+// argTypes are the types accepted by ParseSchema
+var argTypes = []ArgType{
+	TypeString, TypeInt, TypeUint16, TypeBool, TypeDuration,
+	TypeFloat, TypeBytes, TypeURL, TypeIP, TypeCIDR,
+}
+
+// Schema declares the directives allowed in a document or block
+type Schema struct {
+	Directives []*Directive
+}
+
+// Directive declares a single directive
+type Directive struct {
+	Name string
+
+	// Args are the arguments after the name, in order. Arguments past
+	// the end of Args use the last one.
+	Args []*Arg
+
+	// MinArgs and MaxArgs are the number of arguments allowed, a negative
+	// MaxArgs means no limit. If both are zero it is exactly len(Args).
+	MinArgs int
+	MaxArgs int
+
+	Required   bool // must appear at least once
+	Repeatable bool // may appear more than once
+
+	// Body says if the directive takes a body. If Block is set the body
+	// is validated against it.
+	Body  BodyRule
+	Block *Schema
+}
+
+// Arg declares the type and allowed values of an argument
+type Arg struct {
+	Type    ArgType  // TypeString if empty
+	Enum    []string // allowed values, if any
+	Pattern string   // regular expression the whole argument must match, if any
+
+	// Min and Max bound numeric arguments if not nil. Durations are in
+	// nanoseconds and sizes in bytes.
+	Min *float64
+	Max *float64
+}
+
+// ParseSchema reads a Schema written as cmdconfig. Each directive is
+// declared with the same fields as the Go types:
+//
+//	directive server {
+//	    required
+//	    repeatable
+//	    args 1 *           # at least one argument, * for no limit
+//	    arg string {
+//	        pattern [a-z]+
+//	    }
+//	    body required      # or optional, forbidden
+//	    block {
+//	        directive listen {
+//	            arg uint16 {
+//	                min 1
+//	                max 65535
+//	            }
+//	        }
+//	        directive mode {
+//	            arg string {
+//	                enum fast safe
+//	            }
+//	        }
+//	    }
+//	}
+//
+// Bounds of duration and bytes arguments are written as such, e.g. 30s
+// or 10MB.
+func ParseSchema(data []byte) (*Schema, error) {
+	schema := &Schema{}
+	if err := schemaMux(schema).Parse(data); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// ParseSchemaFile is like ParseSchema but the positions of errors carry
+// the file name
+func ParseSchemaFile(name string, data []byte) (*Schema, error) {
+	schema := &Schema{}
+	if err := schemaMux(schema).Run(NewScannerFile(name, data)); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// schemaMux returns a Mux that adds the directives it reads to schema
+func schemaMux(schema *Schema) *Mux {
+	mux := NewMux()
+	mux.Handle("directive", func(cmd *Command) error {
+		if schema.Lookup(cmd.Args[1]) != nil {
+			return errorf(cmd.ArgPos[1], "duplicate directive %s", cmd.Args[1])
+		}
+		d := &Directive{Name: cmd.Args[1]}
+		schema.Directives = append(schema.Directives, d)
+		return directiveMux(d).RunBody(cmd)
+	}).Args(1, 1)
+	return mux
+}
+
+// directiveMux returns a Mux for the body of a directive declaration
+func directiveMux(d *Directive) *Mux {
+	mux := NewMux()
+	mux.Handle("required", func(cmd *Command) error {
+		d.Required = true
+		return nil
+	}).Args(0, 0).Body(BodyForbidden)
+	mux.Handle("repeatable", func(cmd *Command) error {
+		d.Repeatable = true
+		return nil
+	}).Args(0, 0).Body(BodyForbidden)
+	mux.Handle("args", func(cmd *Command) error {
+		var err error
+		if d.MinArgs, err = cmd.Int(1); err != nil {
+			return err
+		}
+		d.MaxArgs = d.MinArgs
+		switch {
+		case len(cmd.Args) < 3:
+		case cmd.Args[2] == "*":
+			d.MaxArgs = -1
+		default:
+			d.MaxArgs, err = cmd.Int(2)
+		}
+		return err
+	}).Args(1, 2).Body(BodyForbidden)
+	mux.Handle("arg", func(cmd *Command) error {
+		a := &Arg{Type: ArgType(cmd.Args[1])}
+		if !slices.Contains(argTypes, a.Type) {
+			return errorf(cmd.ArgPos[1], "unknown type %q", cmd.Args[1])
+		}
+		d.Args = append(d.Args, a)
+		return argMux(a).RunBody(cmd)
+	}).Args(1, 1)
+	mux.Handle("body", func(cmd *Command) error {
+		switch cmd.Args[1] {
+		case "optional":
+			d.Body = BodyOptional
+		case "required":
+			d.Body = BodyRequired
+		case "forbidden":
+			d.Body = BodyForbidden
+		default:
+			return errorf(cmd.ArgPos[1], "invalid body rule %q, expected required, optional or forbidden", cmd.Args[1])
+		}
+		return nil
+	}).Args(1, 1).Body(BodyForbidden)
+	mux.Handle("block", func(cmd *Command) error {
+		d.Block = &Schema{}
+		return schemaMux(d.Block).RunBody(cmd)
+	}).Args(0, 0).Body(BodyRequired)
+	return mux
+}
+
+// argMux returns a Mux for the body of an argument declaration
+func argMux(a *Arg) *Mux {
+	// bound parses a min or max in the units of the argument type
+	bound := func(dst **float64) HandlerFunc {
+		return func(cmd *Command) error {
+			var v float64
+			var err error
+			switch a.Type {
+			case TypeDuration:
+				var d time.Duration
+				d, err = cmd.Duration(1)
+				v = float64(d)
+			case TypeBytes:
+				var n int64
+				n, err = cmd.Bytes(1)
+				v = float64(n)
+			default:
+				v, err = cmd.Float(1)
+			}
+			*dst = &v
+			return err
+		}
+	}
+
+	mux := NewMux()
+	mux.Handle("enum", func(cmd *Command) error {
+		a.Enum = append(a.Enum, cmd.Args[1:]...)
+		return nil
+	}).Args(1, -1).Body(BodyForbidden)
+	mux.Handle("pattern", func(cmd *Command) error {
+		if _, err := regexp.Compile(cmd.Args[1]); err != nil {
+			return errorf(cmd.ArgPos[1], "invalid pattern: %v", err)
+		}
+		a.Pattern = cmd.Args[1]
+		return nil
+	}).Args(1, 1).Body(BodyForbidden)
+	mux.Handle("min", bound(&a.Min)).Args(1, 1).Body(BodyForbidden)
+	mux.Handle("max", bound(&a.Max)).Args(1, 1).Body(BodyForbidden)
+	return mux
+}
+
+// Lookup returns the directive named name, or nil
+func (s *Schema) Lookup(name string) *Directive {
+	for _, d := range s.Directives {
+		if d.Name == name {
+			return d
+		}
+	}
+	return nil
+}
+
+// argCount returns the number of arguments allowed
+func (d *Directive) argCount() (minArgs, maxArgs int) {
+	if d.MinArgs == 0 && d.MaxArgs == 0 {
+		return len(d.Args), len(d.Args)
+	}
+	return d.MinArgs, d.MaxArgs
+}
+
+// Validate checks doc against schema, returning every violation as an
+// ErrorList, or nil if there are none
+func Validate(doc *Document, schema *Schema) error {
+	errs := ErrorList{}
+	start := Position{Line: 1, Column: 1}
+	if len(doc.Children) > 0 {
+		start.Filename = doc.Children[0].Pos.Filename
+	}
+	validateBlock(&errs, doc.Children, schema, "", start)
+	errs.Sort()
+	return errs.Err()
+}
+
+// validateBlock checks the commands in a block, parent is the name of the
+// enclosing directive and end where missing directives are reported
+func validateBlock(errs *ErrorList, nodes []*Node, schema *Schema, parent string, end Position) {
+	seen := make(map[string]*Node)
+	for _, n := range nodes {
+		name := n.Name()
+		d := schema.Lookup(name)
+		if d == nil {
+			msg := fmt.Sprintf("unknown directive %q", name)
+			if alt := closest(name, schema.names(), false); alt != "" {
+				msg += fmt.Sprintf(", did you mean %q?", alt)
+			}
+			errs.Add(n.Pos, msg)
+			continue
+		}
+		if first := seen[name]; first != nil && !d.Repeatable {
+			errs.Add(n.Pos, fmt.Sprintf("duplicate %s, first at %s", name, first.Pos))
+		} else if first == nil {
+			seen[name] = n
+		}
+		validateNode(errs, n, d)
+	}
+	for _, d := range schema.Directives {
+		if d.Required && seen[d.Name] == nil {
+			if parent == "" {
+				errs.Add(end, fmt.Sprintf("missing required directive %s", d.Name))
+			} else {
+				errs.Add(end, fmt.Sprintf("missing required directive %s in %s", d.Name, parent))
+			}
+		}
+	}
+}
+
+func validateNode(errs *ErrorList, n *Node, d *Directive) {
+	name := n.Name()
+	minArgs, maxArgs := d.argCount()
+	count := len(n.Args) - 1
+	switch {
+	case count < minArgs:
+		errs.Add(n.Pos, fmt.Sprintf("%s requires at least %d arguments, got %d", name, minArgs, count))
+	case maxArgs >= 0 && count > maxArgs:
+		errs.Add(n.argPos(maxArgs+1), fmt.Sprintf("%s takes at most %d arguments, got %d", name, maxArgs, count))
+	}
+	for i := 1; i < len(n.Args) && len(d.Args) > 0; i++ {
+		a := d.Args[min(i, len(d.Args))-1]
+		if err := a.validate(&n.Command, i); err != nil {
+			*errs = append(*errs, err.(*ScanError))
+		}
+	}
+
+	switch {
+	case d.Body == BodyRequired && !n.HasBody():
+		errs.Add(n.End, fmt.Sprintf("%s requires a body", name))
+	case d.Body == BodyForbidden && n.HasBody():
+		errs.Add(n.BodyStart, fmt.Sprintf("%s does not take a body", name))
+	case d.Block != nil && n.HasBody() && !n.Raw:
+		validateBlock(errs, n.Children, d.Block, name, n.BodyEnd)
+	}
+}
+
+// validate checks argument i of c, returning a *ScanError
+func (a *Arg) validate(c *Command, i int) error {
+	value, numeric, err := a.parse(c, i)
+	if err != nil {
+		return err
+	}
+	arg, pos, name := c.Args[i], c.argPos(i), c.Name()
+
+	if len(a.Enum) > 0 && !slices.Contains(a.Enum, arg) {
+		return errorf(pos, "invalid value %q for %s, expected one of %s", arg, name, strings.Join(a.Enum, ", "))
+	}
+	if a.Pattern != "" {
+		re, err := regexp.Compile("^(?:" + a.Pattern + ")$")
+		if err != nil {
+			return errorf(pos, "invalid pattern %q for %s in schema: %v", a.Pattern, name, err)
+		}
+		if !re.MatchString(arg) {
+			return errorf(pos, "invalid value %q for %s, does not match %s", arg, name, a.Pattern)
+		}
+	}
+	if numeric {
+		if a.Min != nil && value < *a.Min {
+			return errorf(pos, "%s for %s is less than the minimum %s", arg, name, formatBound(a.Type, *a.Min))
+		}
+		if a.Max != nil && value > *a.Max {
+			return errorf(pos, "%s for %s is more than the maximum %s", arg, name, formatBound(a.Type, *a.Max))
+		}
+	}
+	return nil
+}
+
+// parse checks the type of argument i, returning its value if the type
+// is numeric
+func (a *Arg) parse(c *Command, i int) (value float64, numeric bool, err error) {
+	switch a.Type {
+	case "", TypeString:
+		return 0, false, nil
+	case TypeInt:
+		n, err := c.Int(i)
+		return float64(n), true, err
+	case TypeUint16:
+		n, err := c.Uint16(i)
+		return float64(n), true, err
+	case TypeFloat:
+		f, err := c.Float(i)
+		return f, true, err
+	case TypeDuration:
+		d, err := c.Duration(i)
+		return float64(d), true, err
+	case TypeBytes:
+		n, err := c.Bytes(i)
+		return float64(n), true, err
+	case TypeBool:
+		_, err = c.Bool(i)
+	case TypeURL:
+		_, err = c.URL(i)
+	case TypeIP:
+		_, err = c.IP(i)
+	case TypeCIDR:
+		_, err = c.CIDR(i)
+	default:
+		err = errorf(c.argPos(i), "unknown type %q for %s in schema", a.Type, c.Name())
+	}
+	return 0, false, err
+}
+
+// formatBound formats a range bound in the units of the type
+func formatBound(t ArgType, v float64) string {
+	if t == TypeDuration {
+		return time.Duration(v).String()
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func (s *Schema) names() []string {
+	names := make([]string, len(s.Directives))
+	for i, d := range s.Directives {
+		names[i] = d.Name
+	}
+	sort.Strings(names)
+	return names
+}
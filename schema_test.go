@@ -0,0 +1,204 @@
+package cmdconfig
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testSchema = `
+directive port {
+    required
+    arg uint16 {
+        min 1024
+    }
+}
+directive mode {
+    arg string {
+        enum fast safe
+    }
+}
+directive timeout {
+    arg duration {
+        max 1m
+    }
+}
+directive limit {
+    arg bytes {
+        max 1MB
+    }
+}
+directive allow {
+    repeatable
+    args 1 *
+    arg cidr
+}
+directive name {
+    arg string {
+        pattern [a-z]+
+    }
+}
+directive server {
+    arg string
+    body required
+    block {
+        directive host {
+            required
+            arg string
+        }
+        directive tls {
+            arg bool
+            body forbidden
+        }
+    }
+}
+`
+
+func TestParseSchema(t *testing.T) {
+	schema, err := ParseSchema([]byte(testSchema))
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	port := schema.Lookup("port")
+	if port == nil || !port.Required || len(port.Args) != 1 || port.Args[0].Type != TypeUint16 || *port.Args[0].Min != 1024 {
+		t.Errorf("unexpected port directive %+v", port)
+	}
+	if mode := schema.Lookup("mode"); !reflect.DeepEqual(mode.Args[0].Enum, []string{"fast", "safe"}) {
+		t.Errorf("unexpected enum %v", mode.Args[0].Enum)
+	}
+	if timeout := schema.Lookup("timeout"); *timeout.Args[0].Max != float64(time.Minute) {
+		t.Errorf("unexpected duration bound %v", *timeout.Args[0].Max)
+	}
+	if limit := schema.Lookup("limit"); *limit.Args[0].Max != 1e6 {
+		t.Errorf("unexpected bytes bound %v", *limit.Args[0].Max)
+	}
+	if allow := schema.Lookup("allow"); !allow.Repeatable || allow.MinArgs != 1 || allow.MaxArgs != -1 {
+		t.Errorf("unexpected allow directive %+v", allow)
+	}
+	server := schema.Lookup("server")
+	if server.Body != BodyRequired || server.Block == nil || server.Block.Lookup("host") == nil {
+		t.Errorf("unexpected server directive %+v", server)
+	}
+}
+
+func TestParseSchemaErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"directive a\ndirective a", "duplicate directive a at line 2, column 11"},
+		{"directive a {\n  arg number\n}", `unknown type "number" at line 2, column 7`},
+		{"directive a {\n  body maybe\n}", `invalid body rule "maybe", expected required, optional or forbidden at line 2, column 8`},
+		{"directive a {\n  args x\n}", `invalid int "x" for args: invalid syntax at line 2, column 8`},
+		{"directive a {\n  arg string {\n    pattern [\n  }\n}", "invalid pattern: error parsing regexp: missing closing ]: `[` at line 3, column 13"},
+		{"directive a {\n  arg duration {\n    min 5\n  }\n}", `invalid duration "5" for min at line 3, column 9`},
+		{"directive a {\n  requird\n}", `unknown directive "requird", did you mean "required"? at line 2, column 3`},
+	}
+	for i, tc := range tests {
+		_, err := ParseSchema([]byte(tc.input))
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("case %d: expected %q got %v", i, tc.want, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	schema, err := ParseSchema([]byte(testSchema))
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+
+	valid := "port 8080\nmode fast\ntimeout 30s\nlimit 512KB\nallow 10.0.0.0/8 ::1/128\nallow 192.168.0.0/16\nname web\nserver a {\n  host example.com\n  tls on\n}\n"
+	doc, err := Parse([]byte(valid))
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if err := Validate(doc, schema); err != nil {
+		t.Errorf("got error %v", err)
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"mode fast", "missing required directive port at line 1, column 1"},
+		{"port 8080\nprot 80", `unknown directive "prot", did you mean "port"? at line 2, column 1`},
+		{"port 8080\nport 8081", "duplicate port, first at line 1, column 1 at line 2, column 1"},
+		{"port http", `invalid uint16 "http" for port: invalid syntax at line 1, column 6`},
+		{"port 80", "80 for port is less than the minimum 1024 at line 1, column 6"},
+		{"port 8080\nmode slow", `invalid value "slow" for mode, expected one of fast, safe at line 2, column 6`},
+		{"port 8080\ntimeout 2m", "2m for timeout is more than the maximum 1m0s at line 2, column 9"},
+		{"port 8080\nlimit 2MB", "2MB for limit is more than the maximum 1000000 at line 2, column 7"},
+		{"port 8080\nallow", "allow requires at least 1 arguments, got 0 at line 2, column 1"},
+		{"port 8080\nallow 10.0.0.0/8 10.0.0.1", `invalid CIDR "10.0.0.1" for allow at line 2, column 18`},
+		{"port 8080\nname Web", `invalid value "Web" for name, does not match [a-z]+ at line 2, column 6`},
+		{"port 8080 8081", "port takes at most 1 arguments, got 2 at line 1, column 11"},
+		{"port 8080\nserver a", "server requires a body at line 2, column 9"},
+		{"port 8080\nserver a {\n  tls on\n}", "missing required directive host in server at line 4, column 2"},
+		{"port 8080\nserver a {\n  host b\n  tls on { x }\n}", "tls does not take a body at line 4, column 10"},
+		{"port 8080\nserver a {\n  host b\n  tls maybe\n}", `invalid bool "maybe" for tls at line 4, column 7`},
+	}
+	for i, tc := range tests {
+		doc, err := Parse([]byte(tc.input))
+		if err != nil {
+			t.Fatalf("case %d: got error %v", i, err)
+		}
+		err = Validate(doc, schema)
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("case %d: expected %q got %v", i, tc.want, err)
+		}
+	}
+}
+
+func TestValidateAll(t *testing.T) {
+	schema := &Schema{Directives: []*Directive{
+		{Name: "port", Required: true, Args: []*Arg{{Type: TypeInt}}},
+		{Name: "host", Args: []*Arg{{}}},
+	}}
+	doc, err := Parse([]byte("host a b\nhost c\nport x\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs ErrorList
+	if !errors.As(Validate(doc, schema), &errs) {
+		t.Fatalf("expected an ErrorList")
+	}
+	want := []string{
+		"host takes at most 1 arguments, got 2 at line 1, column 8",
+		"duplicate host, first at line 1, column 1 at line 2, column 1",
+		`invalid int "x" for port: invalid syntax at line 3, column 6`,
+	}
+	var got []string
+	for _, e := range errs {
+		got = append(got, e.Error())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q got %q", want, got)
+	}
+}
+
+func TestValidateWithoutPositions(t *testing.T) {
+	schema, err := ParseSchema([]byte("directive port {\n    arg uint16\n}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fromJSON Document
+	if err := fromJSON.UnmarshalJSON([]byte(`[{"args":["port","1","2"]}]`)); err != nil {
+		t.Fatal(err)
+	}
+	built := &Document{Children: []*Node{{Command: Command{Args: []string{"port", "http"}}}}}
+
+	tests := []struct {
+		doc  *Document
+		want string
+	}{
+		{&fromJSON, "port takes at most 1 arguments, got 2"},
+		{built, `invalid uint16 "http" for port: invalid syntax`},
+	}
+	for i, tc := range tests {
+		if err := Validate(tc.doc, schema); err == nil || err.Error() != tc.want {
+			t.Errorf("case %d: expected %q got %v", i, tc.want, err)
+		}
+	}
+}
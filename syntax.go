@@ -0,0 +1,448 @@
+package cmdconfig
+
+import (
+	"io"
+	"strconv"
+	"strings"
+)
+
+// QuoteKind is how an argument was written
+type QuoteKind int
+
+const (
+	Bareword     QuoteKind = iota // no quotes, possibly with backslash escapes
+	SingleQuoted                  // 'text'
+	DoubleQuoted                  // "text"
+	BackQuoted                    // `text`
+	Mixed                         // several parts, e.g. name="mary ann"
+)
+
+var quoteNames = [...]string{
+	Bareword:     "Bareword",
+	SingleQuoted: "SingleQuoted",
+	DoubleQuoted: "DoubleQuoted",
+	BackQuoted:   "BackQuoted",
+	Mixed:        "Mixed",
+}
+
+func (k QuoteKind) String() string {
+	if k >= 0 && int(k) < len(quoteNames) {
+		return quoteNames[k]
+	}
+	return "QuoteKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// SyntaxTree is a lossless concrete syntax tree. Unlike a Document it keeps
+// every byte of the input: whitespace, blank lines, comments, how each
+// argument was quoted and escaped. Bytes returns the input unchanged, and
+// after an edit only the edited parts are re-written.
+type SyntaxTree struct {
+	Stmts   []*Stmt
+	Trailer string // whitespace and comments after the last statement
+}
+
+// Stmt is a single command
+type Stmt struct {
+	Leading  string // newline, blank lines, comment lines and indentation before the command
+	Words    []*Word
+	Block    *Block // nil if there is no body
+	Trailing string // whitespace and comment after the command, up to the newline
+	Pos      Position
+
+	depth int // number of enclosing blocks
+}
+
+// Word is a single argument
+type Word struct {
+	Space string    // whitespace before the word
+	Raw   string    // as written, including quotes and escapes
+	Value string    // as returned by Scanner.Next
+	Quote QuoteKind // how the word was quoted
+	Pos   Position
+}
+
+// Block is a brace body
+type Block struct {
+	Space   string // whitespace between the last word and the opening brace
+	Open    string // the opening brace and any indentation removed by dedent
+	Stmts   []*Stmt
+	Trailer string // whitespace and comments before the closing brace
+	Close   string // the closing brace
+
+	// Raw holds the body as written if it could not be parsed or is a
+	// heredoc, in which case Stmts and Trailer are empty. For a heredoc
+	// Open is the marker line and Close the delimiter line.
+	Raw string
+
+	depth int // depth of the statements in the block
+}
+
+// ParseSyntax parses data into a lossless SyntaxTree. Syntax errors at the
+// top level are returned as a *ScanError. A brace body that does not parse
+// is kept as Raw text instead, since bodies need not be cmdconfig.
+func ParseSyntax(data []byte) (*SyntaxTree, error) {
+	stmts, trailer, err := buildStmts(NewScanner(data), data, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &SyntaxTree{Stmts: stmts, Trailer: trailer}, nil
+}
+
+// buildStmts mirrors Scanner.scanCommand, recording the raw text between
+// tokens. Body scanners map positions back to src, so consecutive spans
+// cover every byte, including escapes and indentation removed from bodies.
+func buildStmts(s *Scanner, src []byte, depth int) ([]*Stmt, string, error) {
+	stmts := []*Stmt{}
+	cur := &Stmt{depth: depth}
+	var afterBlock *Stmt // trailing comments after '}' belong to its statement
+	start := s.CurrentPos().Offset
+
+	// pending returns the whitespace and comments up to offset end
+	pending := func(end int) string {
+		text := string(src[start:end])
+		start = end
+		return text
+	}
+	// begin attaches leading text to the statement or word starting at pos
+	begin := func(pos Position) string {
+		afterBlock = nil
+		if len(cur.Words) == 0 && cur.Block == nil {
+			cur.Leading = pending(pos.Offset)
+			cur.Pos = pos
+			return ""
+		}
+		return pending(pos.Offset)
+	}
+
+	var w *Word // the word being read
+	wordEnd := 0
+	endWord := func() {
+		if w != nil {
+			w.Raw = pending(wordEnd)
+			w.Quote = quoteKind(w.Raw)
+			cur.Words = append(cur.Words, w)
+			w = nil
+		}
+	}
+	for {
+		tok, err := s.token(w != nil)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		if tok.Kind.isWord() || (w != nil && tok.Kind == TokenLineContinuation) {
+			if w == nil {
+				w = &Word{Space: begin(tok.Pos), Pos: tok.Pos}
+			}
+			w.Value += tok.Value
+			wordEnd = tok.End.Offset
+			continue
+		}
+		endWord()
+
+		switch tok.Kind {
+		case TokenNewline:
+			if len(cur.Words) > 0 {
+				cur.Trailing = pending(tok.Pos.Offset)
+				stmts = append(stmts, cur)
+				cur = &Stmt{depth: depth}
+			} else if afterBlock != nil {
+				afterBlock.Trailing = pending(tok.Pos.Offset)
+				afterBlock = nil
+			}
+		case TokenBackQuoted:
+			w = &Word{Space: begin(tok.Pos), Pos: tok.Pos, Value: tok.Value}
+			wordEnd = tok.End.Offset
+			endWord()
+		case TokenHeredoc:
+			block := &Block{Space: begin(tok.Pos), depth: depth + 1}
+			if cur.Pos.Line == 0 {
+				cur.Pos = tok.Pos
+			}
+			// split into the marker line, the text and the delimiter line
+			text := pending(tok.End.Offset)
+			i, j := strings.IndexByte(text, '\n')+1, strings.LastIndexByte(text, '\n')+1
+			block.Open, block.Close = text[:i], text[j:]
+			if j > i {
+				block.Raw = text[i:j]
+			}
+
+			cur.Block = block
+			stmts = append(stmts, cur)
+			afterBlock = cur
+			cur = &Stmt{depth: depth}
+		case TokenLBrace:
+			block := &Block{Space: begin(tok.Pos), depth: depth + 1}
+			if cur.Pos.Line == 0 {
+				cur.Pos = tok.Pos
+			}
+			body, _ := s.token(false)
+			closing, _ := s.token(false)
+			open, end := body.posMap[0].Offset, closing.Pos.Offset
+			block.Open = pending(open)
+			inner := newBodyScanner([]byte(body.Value), body.posMap)
+			block.Stmts, block.Trailer, err = buildStmts(inner, src, depth+1)
+			if err != nil {
+				block.Stmts, block.Trailer = nil, ""
+				block.Raw = string(src[open:end])
+			}
+			start = end
+			block.Close = pending(closing.End.Offset)
+
+			cur.Block = block
+			stmts = append(stmts, cur)
+			afterBlock = cur
+			cur = &Stmt{depth: depth}
+		}
+	}
+	endWord()
+	if err := s.readErr(nil); err != nil {
+		return nil, "", err
+	}
+
+	end := s.CurrentPos().Offset
+	if len(cur.Words) > 0 {
+		cur.Trailing = pending(end)
+		stmts = append(stmts, cur)
+	} else if afterBlock != nil {
+		afterBlock.Trailing = pending(end)
+	}
+	return stmts, pending(end), nil
+}
+
+// quoteKind works out how raw, a single argument, was quoted
+func quoteKind(raw string) QuoteKind {
+	kind := Bareword
+	parts := 0
+	for i := 0; i < len(raw); i++ {
+		parts++
+		switch raw[i] {
+		case '\'', '`':
+			kind = SingleQuoted
+			if raw[i] == '`' {
+				kind = BackQuoted
+			}
+			i += strings.IndexByte(raw[i+1:], raw[i]) + 1
+		case '"':
+			kind = DoubleQuoted
+			for i++; i < len(raw) && raw[i] != '"'; i++ {
+				if raw[i] == '\\' {
+					i++
+				}
+			}
+		default:
+			kind = Bareword
+			for i < len(raw) && !isQuote1(raw[i]) && !isQuote2(raw[i]) {
+				if raw[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			// back up to the quote, the loop moves past it
+			i--
+		}
+	}
+	if parts > 1 {
+		return Mixed
+	}
+	return kind
+}
+
+// Bytes returns the tree as text. An unedited tree returns the original input.
+func (t *SyntaxTree) Bytes() []byte {
+	b := strings.Builder{}
+	writeStmts(&b, t.Stmts)
+	b.WriteString(t.Trailer)
+	return []byte(b.String())
+}
+
+// String returns the tree as text
+func (t *SyntaxTree) String() string {
+	return string(t.Bytes())
+}
+
+func writeStmts(b *strings.Builder, stmts []*Stmt) {
+	for _, st := range stmts {
+		b.WriteString(st.Leading)
+		for _, w := range st.Words {
+			b.WriteString(w.Space)
+			b.WriteString(w.Raw)
+		}
+		if blk := st.Block; blk != nil {
+			b.WriteString(blk.Space)
+			b.WriteString(blk.Open)
+			writeStmts(b, blk.Stmts)
+			b.WriteString(blk.Trailer)
+			b.WriteString(blk.Raw)
+			b.WriteString(blk.Close)
+		}
+		b.WriteString(st.Trailing)
+	}
+}
+
+// Args returns the value of each word, as Scanner.Next would
+func (st *Stmt) Args() []string {
+	args := make([]string, len(st.Words))
+	for i, w := range st.Words {
+		args[i] = w.Value
+	}
+	return args
+}
+
+// Name returns the value of the first word, or "" if there are none
+func (st *Stmt) Name() string {
+	if len(st.Words) == 0 {
+		return ""
+	}
+	return st.Words[0].Value
+}
+
+// SetArg sets argument i to value, keeping the original quoting style if
+// it can represent the new value. If i is the number of words a new
+// argument is appended.
+func (st *Stmt) SetArg(i int, value string) {
+	if i == len(st.Words) {
+		st.Words = append(st.Words, &Word{Space: " ", Quote: Bareword})
+	}
+	w := st.Words[i]
+	w.Value = value
+	w.Raw = formatWord(value, w.Quote, st.depth)
+}
+
+// formatWord returns value quoted in the style of kind if possible, and
+// escaped for a body at the given depth
+func formatWord(value string, kind QuoteKind, depth int) string {
+	var raw string
+	switch {
+	case kind == SingleQuoted && value != "" && !strings.Contains(value, "'"):
+		raw = "'" + value + "'"
+	case kind == BackQuoted && value != "" && !strings.Contains(value, "`"):
+		raw = "`" + value + "`"
+	case kind == DoubleQuoted:
+		raw = quoteArg(value)
+	default:
+		raw = formatArg(value)
+	}
+	for j := 0; j < depth; j++ {
+		raw = escapeBrace(raw)
+	}
+	return raw
+}
+
+// Find returns the first top level statement named name, or nil
+func (t *SyntaxTree) Find(name string) *Stmt {
+	return findStmt(t.Stmts, name)
+}
+
+// InsertCommand inserts a new command with the given arguments at index i
+// of the top level statements, indented like its neighbours
+func (t *SyntaxTree) InsertCommand(i int, args []string) *Stmt {
+	return insertStmt(&t.Stmts, &t.Trailer, i, args, 0, "")
+}
+
+// Delete removes statement st, including its block and any comment on the
+// same line. It reports if st was found.
+func (t *SyntaxTree) Delete(st *Stmt) bool {
+	return deleteStmt(&t.Stmts, &t.Trailer, st)
+}
+
+// Find returns the first statement in the block named name, or nil
+func (b *Block) Find(name string) *Stmt {
+	return findStmt(b.Stmts, name)
+}
+
+// InsertCommand inserts a new command with the given arguments at index i
+// of the block, indented like its neighbours
+func (b *Block) InsertCommand(i int, args []string) *Stmt {
+	indent := "    "
+	if j := strings.LastIndexByte(b.Trailer, '\n'); j >= 0 {
+		// indentation of the closing brace, plus one level
+		indent = b.Trailer[j+1:] + indent
+	}
+	if !strings.Contains(b.Trailer, "\n") {
+		b.Trailer = "\n" + b.Trailer
+	}
+	return insertStmt(&b.Stmts, &b.Trailer, i, args, b.depth, indent)
+}
+
+// Delete removes statement st from the block, including its own block and
+// any comment on the same line. It reports if st was found.
+func (b *Block) Delete(st *Stmt) bool {
+	return deleteStmt(&b.Stmts, &b.Trailer, st)
+}
+
+func findStmt(stmts []*Stmt, name string) *Stmt {
+	for _, st := range stmts {
+		if st.Name() == name {
+			return st
+		}
+	}
+	return nil
+}
+
+// indentOf returns the indentation on the last line of leading text
+func indentOf(leading string) string {
+	return leading[strings.LastIndexByte(leading, '\n')+1:]
+}
+
+func insertStmt(stmts *[]*Stmt, trailer *string, i int, args []string, depth int, indent string) *Stmt {
+	list := *stmts
+	st := &Stmt{depth: depth}
+	switch {
+	case i > 0:
+		// on the line after the previous statement
+		st.Leading = "\n" + indentOf(list[i-1].Leading)
+	case len(list) > 0:
+		// take over the leading text of the first statement
+		next := list[0]
+		st.Leading = next.Leading
+		next.Leading = "\n" + indentOf(next.Leading)
+	case depth > 0:
+		st.Leading = "\n" + indent
+	case *trailer != "" && !strings.HasPrefix(*trailer, "\n"):
+		// only comments in the file, keep them on their own line
+		*trailer = "\n" + *trailer
+	}
+	for j, arg := range args {
+		st.SetArg(j, arg)
+	}
+	if len(st.Words) > 0 {
+		st.Words[0].Space = ""
+	}
+	*stmts = append(list[:i], append([]*Stmt{st}, list[i:]...)...)
+	return st
+}
+
+func deleteStmt(stmts *[]*Stmt, trailer *string, st *Stmt) bool {
+	list := *stmts
+	for i, s := range list {
+		if s != st {
+			continue
+		}
+		// keep blank lines and comments above the statement's own line
+		keep := ""
+		if j := strings.LastIndexByte(st.Leading, '\n'); j >= 0 {
+			keep = st.Leading[:j]
+		}
+		if i+1 < len(list) {
+			next := list[i+1]
+			if st.depth == 0 && !strings.Contains(st.Leading, "\n") {
+				// it was on the first line of the file
+				next.Leading = strings.TrimPrefix(next.Leading, "\n")
+			}
+			next.Leading = keep + next.Leading
+		} else {
+			*trailer = keep + *trailer
+		}
+		*stmts = append(list[:i], list[i+1:]...)
+		return true
+	}
+	return false
+}
+
+// IsHeredoc reports if the block is a heredoc rather than a brace body
+func (b *Block) IsHeredoc() bool {
+	return strings.HasPrefix(b.Open, "<<")
+}
@@ -0,0 +1,222 @@
+package cmdconfig
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSyntaxTreeLossless(t *testing.T) {
+	inputs := []string{
+		"",
+		"\n\n",
+		"# only a comment",
+		"name John Brown",
+		"   name   'John'   \"Brown\"   # trailing  \n\n\n",
+		"# header\n\nname a\n  # indented comment\nport 80 # http\n",
+		"server web01 {\n    host a\n\n    # comment\n    location /api {\n\tproxy_pass b\n    }\n} # end\nnext\n",
+		"cmd { config \\{ key: value \\} }\n",
+		"cmd {  a\n  b \\\\x\n  }",
+		"a b {} c d {x}\n{ bare }\n",
+		"echo a\\ b \"say \\\"hi\\\"\" `back\nquote` name=\"mary ann\"\n",
+		"long a b \\\n   c\n",
+		"script {\n  echo 'unbalanced\n}\n",
+		"a\r\nb\r\n",
+	}
+	for i, input := range inputs {
+		tree, err := ParseSyntax([]byte(input))
+		if err != nil {
+			t.Fatalf("case %d, unexpected error %v", i, err)
+		}
+		if got := string(tree.Bytes()); got != input {
+			t.Errorf("case %d, expected %q got %q", i, input, got)
+		}
+	}
+}
+
+func TestSyntaxTreeMatchesScanner(t *testing.T) {
+	input := "name 'John' \"Br\\\"own\" `x`\nserver a {\n  host b\\{c\\}d\n  a=\"b c\"'d' e\\ f # x\n}\n"
+	tree, err := ParseSyntax([]byte(input))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	doc, err := Parse([]byte(input))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	var compare func(stmts []*Stmt, nodes []*Node)
+	compare = func(stmts []*Stmt, nodes []*Node) {
+		if len(stmts) != len(nodes) {
+			t.Fatalf("expected %d statements got %d", len(nodes), len(stmts))
+		}
+		for i, st := range stmts {
+			if !reflect.DeepEqual(st.Args(), nodes[i].Args) {
+				t.Errorf("expected %q got %q", nodes[i].Args, st.Args())
+			}
+			if st.Pos != nodes[i].Pos {
+				t.Errorf("%s, expected %v got %v", st.Name(), nodes[i].Pos, st.Pos)
+			}
+			for j, w := range st.Words {
+				if w.Pos != nodes[i].ArgPos[j] {
+					t.Errorf("%s, expected %v got %v", w.Value, nodes[i].ArgPos[j], w.Pos)
+				}
+			}
+			if st.Block != nil {
+				compare(st.Block.Stmts, nodes[i].Children)
+			}
+		}
+	}
+	compare(tree.Stmts, doc.Children)
+}
+
+func TestQuoteKind(t *testing.T) {
+	tests := map[string]QuoteKind{
+		"abc":            Bareword,
+		"a\\ b":          Bareword,
+		"a\\'b":          Bareword,
+		"'abc'":          SingleQuoted,
+		"\"a\\\"b\"":     DoubleQuoted,
+		"`a b`":          BackQuoted,
+		"name=\"a b\"":   Mixed,
+		"'a'\"b\"":       Mixed,
+		"\"a\"b":         Mixed,
+		"'it'\\''s'":     Mixed,
+		"\"a\\\\\"":      DoubleQuoted,
+		"\"x'y\"":        DoubleQuoted,
+		"'x\"y'":         SingleQuoted,
+		"a#b":            Bareword,
+		"\"\"":           DoubleQuoted,
+		"\"with space\"": DoubleQuoted,
+	}
+	for raw, want := range tests {
+		if got := quoteKind(raw); got != want {
+			t.Errorf("%s, expected %v got %v", raw, want, got)
+		}
+	}
+	if got := Mixed.String(); got != "Mixed" {
+		t.Errorf("expected Mixed got %s", got)
+	}
+	if got := QuoteKind(9).String(); got != "QuoteKind(9)" {
+		t.Errorf("expected QuoteKind(9) got %s", got)
+	}
+}
+
+func TestSyntaxTreeEdit(t *testing.T) {
+	input := `# config
+name 'old name'  # keep me
+port 80
+
+server web01 {
+    host "a"
+    # upstreams
+    upstream x y
+} # server
+`
+	tree, err := ParseSyntax([]byte(input))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	tree.Find("name").SetArg(1, "new name")
+	tree.Find("port").SetArg(1, "8080")
+	server := tree.Find("server")
+	server.Block.Find("host").SetArg(1, "b{c}")
+	server.Block.Find("upstream").SetArg(3, "z")
+	server.Block.InsertCommand(0, []string{"listen", "443"})
+	server.Block.Delete(server.Block.Find("upstream"))
+	tree.InsertCommand(2, []string{"debug", "on"})
+	tree.InsertCommand(len(tree.Stmts), []string{"last", "x y"})
+
+	want := `# config
+name 'new name'  # keep me
+port 8080
+debug on
+
+server web01 {
+    listen 443
+    host "b\\\{c\\\}"
+    # upstreams
+} # server
+last "x y"
+`
+	if got := tree.String(); got != want {
+		t.Fatalf("expected:\n%s\ngot:\n%s", want, got)
+	}
+
+	// the edited text parses to the edited values
+	doc, err := Parse(tree.Bytes())
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if host := doc.Child("server").Child("host"); host.Args[1] != "b{c}" {
+		t.Errorf("expected b{c} got %q", host.Args[1])
+	}
+}
+
+func TestSyntaxTreeEditEdges(t *testing.T) {
+	tests := []struct {
+		input string
+		edit  func(tree *SyntaxTree)
+		want  string
+	}{
+		{
+			input: "a 1\nb 2\n",
+			edit:  func(tree *SyntaxTree) { tree.Delete(tree.Find("a")) },
+			want:  "b 2\n",
+		},
+		{
+			input: "a 1\nb 2",
+			edit:  func(tree *SyntaxTree) { tree.Delete(tree.Find("b")) },
+			want:  "a 1",
+		},
+		{
+			input: "a 1\n",
+			edit:  func(tree *SyntaxTree) { tree.InsertCommand(0, []string{"first"}) },
+			want:  "first\na 1\n",
+		},
+		{
+			input: "# just a comment\n",
+			edit:  func(tree *SyntaxTree) { tree.InsertCommand(0, []string{"a"}) },
+			want:  "a\n# just a comment\n",
+		},
+		{
+			input: "",
+			edit:  func(tree *SyntaxTree) { tree.InsertCommand(0, []string{"a"}) },
+			want:  "a",
+		},
+		{
+			input: "  block {}\n",
+			edit: func(tree *SyntaxTree) {
+				tree.Find("block").Block.InsertCommand(0, []string{"x"})
+			},
+			want: "  block {\n    x\n}\n",
+		},
+		{
+			input: "block {\n  # comment\n  x 1\n}\n",
+			edit: func(tree *SyntaxTree) {
+				b := tree.Find("block").Block
+				b.Delete(b.Find("x"))
+			},
+			want: "block {\n  # comment\n}\n",
+		},
+		{
+			input: "a `cmd` \"q\" 'single'\n",
+			edit: func(tree *SyntaxTree) {
+				st := tree.Find("a")
+				st.SetArg(1, "new cmd")
+				st.SetArg(2, "q2")
+				st.SetArg(3, "it's")
+			},
+			want: "a `new cmd` \"q2\" \"it's\"\n",
+		},
+	}
+	for i, tc := range tests {
+		tree, err := ParseSyntax([]byte(tc.input))
+		if err != nil {
+			t.Fatalf("case %d, unexpected error %v", i, err)
+		}
+		tc.edit(tree)
+		if got := tree.String(); got != tc.want {
+			t.Errorf("case %d, expected %q got %q", i, tc.want, got)
+		}
+	}
+}
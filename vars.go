@@ -0,0 +1,57 @@
+package cmdconfig
+
+// scope holds the variables set in a block, see Parser.Variables
+type scope struct {
+	vars   map[string]string
+	parent *scope
+
+	// lookup is used for names that are not set in any scope
+	lookup func(name string) (string, bool)
+}
+
+// scope returns the top level scope, or nil if variables are not enabled
+func (l *loader) scope() *scope {
+	if !l.p.Variables {
+		return nil
+	}
+	return &scope{lookup: l.p.Lookup}
+}
+
+// child returns the scope of a block nested in sc
+func (sc *scope) child() *scope {
+	if sc == nil {
+		return nil
+	}
+	return &scope{parent: sc, lookup: sc.lookup}
+}
+
+// get returns the value of name from the innermost scope that sets it
+func (sc *scope) get(name string) (string, bool) {
+	for c := sc; c != nil; c = c.parent {
+		if v, ok := c.vars[name]; ok {
+			return v, true
+		}
+	}
+	if sc.lookup == nil {
+		return "", false
+	}
+	return sc.lookup(name)
+}
+
+// set handles a set command
+func (sc *scope) set(cmd *Command) error {
+	if cmd.HasBody() {
+		return errorf(cmd.BodyStart, "set does not take a body")
+	}
+	if len(cmd.Args) != 3 {
+		return errorf(cmd.Pos, "set requires a name and a value, got %d arguments", len(cmd.Args)-1)
+	}
+	if !isVarName(cmd.Args[1]) {
+		return errorf(cmd.ArgPos[1], "invalid variable name %q", cmd.Args[1])
+	}
+	if sc.vars == nil {
+		sc.vars = make(map[string]string)
+	}
+	sc.vars[cmd.Args[1]] = cmd.Args[2]
+	return nil
+}
@@ -0,0 +1,102 @@
+package cmdconfig
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestVariables(t *testing.T) {
+	input := `set host example.com
+set port 80
+listen ${host}:${port}
+server {
+    set port 8080
+    set url http://${host}:${port}/
+    listen ${port}
+    inner {
+        url ${url}
+    }
+}
+listen ${port}
+home ${HOME}
+`
+	env := func(name string) (string, bool) {
+		if name == "HOME" {
+			return "/home/me", true
+		}
+		return "", false
+	}
+	p := Parser{Variables: true, Lookup: env}
+	doc, err := p.Parse([]byte(input))
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	want := `listen example.com:80
+server {
+    listen 8080
+    inner {
+        url http://example.com:8080/
+    }
+}
+listen 80
+home /home/me
+`
+	if got := doc.Format("    "); got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestVariablesErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"a ${x}\nset x 1", `undefined variable "x" at line 1, column 3`},
+		{"b {\n set x 1\n}\na ${x}", `undefined variable "x" at line 4, column 3`},
+		{"set x", "set requires a name and a value, got 1 arguments at line 1, column 1"},
+		{"set x 1 {}", "set does not take a body at line 1, column 9"},
+		{"set 1x 1", `invalid variable name "1x" at line 1, column 5`},
+	}
+	for i, tc := range tests {
+		p := Parser{Variables: true}
+		_, err := p.Parse([]byte(tc.input))
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("case %d: expected %q got %v", i, tc.want, err)
+		}
+	}
+
+	// set is an ordinary command unless Variables is enabled
+	doc, err := Parse([]byte("set x 1\na ${x}"))
+	if err != nil || len(doc.Children) != 2 || doc.Children[1].Args[1] != "${x}" {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestVariablesRecover(t *testing.T) {
+	p := Parser{Variables: true, MaxErrors: -1}
+	doc, err := p.Parse([]byte("set x\nset y 1\na ${y} ${x}\nb ${y}\n"))
+	list, ok := err.(ErrorList)
+	if !ok || len(list) != 2 {
+		t.Fatalf("expected 2 errors got %v", err)
+	}
+	if len(doc.Children) != 1 || doc.Children[0].Name() != "b" {
+		t.Errorf("got %q", doc.Format(" "))
+	}
+}
+
+func TestVariablesInclude(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.conf": {Data: []byte("set root /srv\ninclude vars.conf\nsite {\n  include site.conf\n}\nlog ${logdir}\n")},
+		"vars.conf": {Data: []byte("set logdir ${root}/log\n")},
+		"site.conf": {Data: []byte("set root /www\nroot ${root}\n")},
+	}
+	p := Parser{Variables: true}
+	doc, err := p.Load(fsys, "main.conf")
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	want := "site {\n root /www\n}\nlog /srv/log\n"
+	if got := doc.Format(" "); got != want {
+		t.Errorf("expected %q got %q", want, got)
+	}
+}